@@ -0,0 +1,68 @@
+package metricspb
+
+import (
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/utils"
+	"google.golang.org/protobuf/proto"
+)
+
+func FromModel(m model.Metrics) *Metric {
+	res := &Metric{
+		Id:     m.ID,
+		Type:   m.MType,
+		Delta:  m.Delta,
+		Value:  m.Value,
+		Labels: m.Labels,
+		Count:  m.Count,
+		Sum:    m.Sum,
+		Hash:   m.Hash,
+	}
+	for _, b := range m.Buckets {
+		res.Buckets = append(res.Buckets, &Bucket{Le: b.UpperBound, Count: b.Count})
+	}
+	for _, q := range m.Quantiles {
+		res.Quantiles = append(res.Quantiles, &Quantile{Quantile: q.Quantile, Value: q.Value})
+	}
+
+	return res
+}
+
+func (x *Metric) ToModel() model.Metrics {
+	res := model.Metrics{
+		ID:     x.GetId(),
+		MType:  x.GetType(),
+		Delta:  x.Delta,
+		Value:  x.Value,
+		Labels: x.GetLabels(),
+		Count:  x.Count,
+		Sum:    x.Sum,
+		Hash:   x.GetHash(),
+	}
+	for _, b := range x.GetBuckets() {
+		res.Buckets = append(res.Buckets, model.Bucket{UpperBound: b.GetLe(), Count: b.GetCount()})
+	}
+	for _, q := range x.GetQuantiles() {
+		res.Quantiles = append(res.Quantiles, model.Quantile{Quantile: q.GetQuantile(), Value: q.GetValue()})
+	}
+
+	return res
+}
+
+// Sign считает HMAC-SHA256 метрики без поля hash в детерминированной сериализации.
+func Sign(m *Metric, key string) (string, error) {
+	unsigned := proto.Clone(m).(*Metric)
+	unsigned.Hash = ""
+
+	return SignMessage(unsigned, key)
+}
+
+// SignMessage считает HMAC-SHA256 сообщения целиком в детерминированной сериализации.
+// Так подписываются запросы без собственного поля hash, подпись передаётся в метаданных.
+func SignMessage(msg proto.Message, key string) (string, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+
+	return utils.GenerateSHA256(string(data), key), nil
+}
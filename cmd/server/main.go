@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/rsa"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
@@ -9,20 +11,28 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/7StaSH7/gometrics/internal/auth"
 	"github.com/7StaSH7/gometrics/internal/config"
 	dbconfig "github.com/7StaSH7/gometrics/internal/config/db"
-	databaserepository "github.com/7StaSH7/gometrics/internal/repository/db"
+	"github.com/7StaSH7/gometrics/internal/config/tlsconfig"
+	"github.com/7StaSH7/gometrics/internal/encryption"
+	"github.com/7StaSH7/gometrics/internal/replay"
+	"github.com/7StaSH7/gometrics/internal/repository"
+	_ "github.com/7StaSH7/gometrics/internal/repository/bolt"
+	dbrepository "github.com/7StaSH7/gometrics/internal/repository/db"
+	_ "github.com/7StaSH7/gometrics/internal/repository/storage"
 
 	healthhandler "github.com/7StaSH7/gometrics/internal/handler/health"
 	metricshandler "github.com/7StaSH7/gometrics/internal/handler/metrics"
+	rpchandler "github.com/7StaSH7/gometrics/internal/handler/rpc"
 	"github.com/7StaSH7/gometrics/internal/logger"
 	"github.com/7StaSH7/gometrics/internal/middleware"
-	storagerepositsory "github.com/7StaSH7/gometrics/internal/repository/storage"
 	metricsservice "github.com/7StaSH7/gometrics/internal/service/metrics"
-	"github.com/7StaSH7/gometrics/internal/storage"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 func main() {
@@ -31,7 +41,19 @@ func main() {
 	}
 }
 
-func initDeps(ctx context.Context) (*config.ServerConfig, *gin.Engine, metricsservice.MetricsService) {
+type deps struct {
+	cfg     *config.ServerConfig
+	router  *gin.Engine
+	service metricsservice.MetricsService
+	backend repository.Backend
+	keys    auth.KeyStore
+	// hashKey — общий ключ подписи; с ключами агентов не используется, подпись уже проверена
+	hashKey string
+	// guard общий для HTTP и gRPC: nonce нельзя повторить и через другой транспорт
+	guard *replay.Guard
+}
+
+func initDeps(ctx context.Context) (*deps, error) {
 	cfg, psqlCfg := config.NewServerConfig()
 
 	router := gin.New()
@@ -40,29 +62,83 @@ func initDeps(ctx context.Context) (*config.ServerConfig, *gin.Engine, metricsse
 
 	logger.Initialize(cfg.LogLevel)
 	router.Use(middleware.RequestLogger)
+	router.Use(middleware.TrustedSubnetMiddleware(cfg.TrustedSubnets()))
+
+	var privateKey *rsa.PrivateKey
+	if cfg.CryptoKey != "" {
+		key, err := encryption.LoadPrivateKey(cfg.CryptoKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load crypto key: %w", err)
+		}
+		privateKey = key
+	}
+	router.Use(middleware.DecryptMiddleware(privateKey))
 
 	router.Use(middleware.GzipMiddleware)
 	router.Use(gin.Recovery())
 
-	stor := storage.NewStorage(cfg)
-
-	psqlPool, err := dbconfig.NewPostgresDriver(ctx, psqlCfg)
+	keys, err := agentKeys(ctx, cfg, psqlCfg)
 	if err != nil {
-		logger.Log.Error("psql connection error", zap.Error(err))
+		return nil, fmt.Errorf("cannot load agent keys: %w", err)
 	}
+	guard := replay.NewGuard(cfg.ReplayWindow, cfg.NonceCache)
+	router.Use(middleware.AgentAuthMiddleware(keys, guard))
 
-	storRep := storagerepositsory.NewMemStorageRepository(stor)
-	dbRep := databaserepository.NewDatabaseRepository(psqlPool)
+	hashKey := cfg.Key
+	if keys != nil {
+		hashKey = ""
+	}
 
-	mSer := metricsservice.New(storRep, dbRep)
+	backend, err := openStorage(ctx, cfg, psqlCfg)
+	if err != nil {
+		return nil, err
+	}
+	logger.Log.Info("storage backend selected", zap.String("storage", cfg.Storage))
 
-	mHan := metricshandler.New(mSer, cfg.Key)
-	hHan := healthhandler.New(psqlPool)
+	mSer := metricsservice.New(backend, cfg.Retention(), cfg.Buckets(), cfg.Dedup())
+
+	mHan := metricshandler.New(mSer, hashKey, guard)
+	hHan := healthhandler.New(backend.Health)
 
 	mHan.Register(router)
 	hHan.Register(router)
 
-	return cfg, router, mSer
+	return &deps{cfg: cfg, router: router, service: mSer, backend: backend, keys: keys, hashKey: hashKey, guard: guard}, nil
+}
+
+// openStorage открывает хранилище -s. Без него сервер, как и раньше, пишет в базу
+// по адресу -d, а если база недоступна при старте — в файл -f. Прежде сервер
+// переключался между базой и памятью на каждом запросе; теперь выбор делается один раз.
+func openStorage(ctx context.Context, cfg *config.ServerConfig, psqlCfg *dbconfig.PostgresConfig) (repository.Backend, error) {
+	opts := repository.Options{Server: cfg, Postgres: psqlCfg}
+	if cfg.Storage != "" {
+		return repository.New(ctx, cfg.Storage, opts)
+	}
+
+	if psqlCfg.URL != "" {
+		backend, err := repository.New(ctx, "postgres", opts)
+		if err == nil {
+			cfg.Storage = "postgres"
+			return backend, nil
+		}
+		logger.Log.Warn("cannot connect to postgres, falling back to file storage", zap.Error(err))
+	}
+	cfg.Storage = "file"
+
+	return repository.New(ctx, cfg.Storage, opts)
+}
+
+// agentKeys загружает ключи агентов из файла или из таблицы agent_keys.
+// Без настройки возвращает nil: все агенты пишут в арендатора по умолчанию.
+func agentKeys(ctx context.Context, cfg *config.ServerConfig, psqlCfg *dbconfig.PostgresConfig) (auth.KeyStore, error) {
+	switch cfg.AgentKeys {
+	case "":
+		return nil, nil
+	case "postgres":
+		return dbrepository.NewKeyStore(ctx, psqlCfg)
+	default:
+		return auth.NewFileKeyStore(cfg.AgentKeys)
+	}
 }
 
 func run() error {
@@ -71,11 +147,32 @@ func run() error {
 
 	g, gCtx := errgroup.WithContext(ctx)
 
-	cfg, router, ser := initDeps(gCtx)
+	d, err := initDeps(gCtx)
+	if err != nil {
+		return err
+	}
+	cfg, ser := d.cfg, d.service
+	defer func() {
+		if err := d.backend.Close(); err != nil {
+			logger.Log.Error("cannot close storage", zap.Error(err))
+		}
+	}()
+	if d.keys != nil {
+		defer d.keys.Close()
+	}
+
+	var tlsCfg *tls.Config
+	if cfg.TLSCert != "" {
+		tlsCfg, err = tlsconfig.Server(cfg.TLSCert, cfg.TLSKey, cfg.TLSClientCA)
+		if err != nil {
+			return fmt.Errorf("cannot load tls certificate: %w", err)
+		}
+	}
 
 	srv := &http.Server{
-		Addr:    cfg.Address,
-		Handler: router,
+		TLSConfig: tlsCfg,
+		Addr:      cfg.Address,
+		Handler:   d.router,
 		BaseContext: func(_ net.Listener) context.Context {
 			return gCtx
 		},
@@ -83,13 +180,22 @@ func run() error {
 
 	if cfg.StoreInterval != 0 {
 		g.Go(func() error {
-			return ser.Store(gCtx, cfg.Restore, cfg.StoreInterval)
+			return ser.Store(gCtx, cfg.StoreInterval)
+		})
+	}
+
+	if cfg.RetentionRaw > 0 || cfg.BatchTTL > 0 {
+		g.Go(func() error {
+			return ser.Compact(gCtx, cfg.CompactInterval)
 		})
 	}
 
 	g.Go(func() error {
-		logger.Log.Info("server started", zap.String("address", cfg.Address))
+		logger.Log.Info("server started", zap.String("address", cfg.Address), zap.Bool("tls", tlsCfg != nil))
 
+		if tlsCfg != nil {
+			return srv.ListenAndServeTLS("", "")
+		}
 		return srv.ListenAndServe()
 	})
 
@@ -99,6 +205,33 @@ func run() error {
 		return srv.Shutdown(context.Background())
 	})
 
+	if cfg.GRPCAddress != "" {
+		opts := rpchandler.TrustedSubnet(cfg.TrustedSubnets())
+		opts = append(opts, rpchandler.AgentAuth(d.keys, d.guard)...)
+		if tlsCfg != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+		}
+		grpcSrv := grpc.NewServer(opts...)
+		rpchandler.New(ser, d.hashKey, d.guard).Register(grpcSrv)
+
+		g.Go(func() error {
+			lis, err := net.Listen("tcp", cfg.GRPCAddress)
+			if err != nil {
+				return err
+			}
+			logger.Log.Info("grpc server started", zap.String("address", cfg.GRPCAddress))
+
+			return grpcSrv.Serve(lis)
+		})
+
+		g.Go(func() error {
+			<-gCtx.Done()
+			grpcSrv.GracefulStop()
+
+			return nil
+		})
+	}
+
 	if err := g.Wait(); err != nil {
 		logger.Log.Info("exit reason", zap.Error(err))
 	}
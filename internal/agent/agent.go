@@ -2,47 +2,62 @@ package agent
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"math/rand/v2"
-	"runtime"
+	"maps"
+	"os"
+	"slices"
 	"sync"
 	"time"
 
+	"github.com/7StaSH7/gometrics/internal/agent/collector"
+	"github.com/7StaSH7/gometrics/internal/agent/push"
+	"github.com/7StaSH7/gometrics/internal/agent/spool"
+	"github.com/7StaSH7/gometrics/internal/agent/statsd"
 	"github.com/7StaSH7/gometrics/internal/config"
 	"github.com/7StaSH7/gometrics/internal/logger"
 	"github.com/7StaSH7/gometrics/internal/model"
-	"github.com/7StaSH7/gometrics/internal/utils"
-	"github.com/shirou/gopsutil/v4/cpu"
-	"github.com/shirou/gopsutil/v4/mem"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
-	"resty.dev/v3"
 )
 
-type Gauge float64
-type Counter int64
-
-type MetricsMap map[string]any
-
 type Agent struct {
-	client  *resty.Client
-	baseURL string
+	sender sender
+	// queue — очередь неотправленных пачек на диске, nil без QueueDir
+	queue *spool.Queue
+	// collectors — включённые сборщики по именам
+	collectors map[string]collector.Collector
+	// statsd — приёмник метрик приложений, nil без StatsdAddr и StatsdSocket
+	statsd *statsd.Server
+	// push — приём JSON от приложений хоста, nil без PushAddr
+	push *push.Server
 
 	ctx context.Context
 	cfg *config.AgentConfig
 	g   *errgroup.Group
 
-	metrics   MetricsMap
-	mu        sync.Mutex
-	pollCount int64
-	ms        runtime.MemStats
+	// gauges — последние значения gauge и summary по источнику и ключу серии
+	gauges map[string]map[string]model.Metrics
+	// counters — приращения counter и histogram по ключу серии, которые сервер ещё не подтвердил.
+	// Пачка забирает их при отправке и возвращает, если отправка не удалась.
+	counters map[string]model.Metrics
+	// isolated — ключи histogram из push API и statsd: каждая уходит своей пачкой
+	isolated map[string]struct{}
+	// pending — пачки без очереди, отправка которых не удалась. Сервер мог их
+	// применить, поэтому они повторяются без изменений и с тем же идентификатором.
+	pending []spool.Batch
+	labels  model.Labels
+	mu      sync.Mutex
 }
 
+// Источники gauge, присланных приложениями: их значения не заменяются набором.
+const (
+	pushSource   = "push"
+	statsdSource = "statsd"
+)
+
 type AgentInterface interface {
-	GetRuntimeMetrics() error
-	GetGopsutilMetrics() error
+	Collect(ctx context.Context, name string, c collector.Collector) error
 	SendMetrics() error
 	SendMetricsBatch() error
 	Close() error
@@ -50,187 +65,431 @@ type AgentInterface interface {
 }
 
 func New(ctx context.Context, group *errgroup.Group, cfg *config.AgentConfig) AgentInterface {
-	client := resty.New().
-		AddRetryConditions(
-			func(res *resty.Response, err error) bool {
-				if res == nil {
-					return true
-				}
-				if err != nil {
-					return true
-				}
-				return false
-			},
-		).
-		SetContext(ctx).
-		SetRetryStrategy(
-			func(resp *resty.Response, _ error) (time.Duration, error) {
-				select {
-				case <-ctx.Done():
-					return 0, ctx.Err()
-				default:
-				}
-				var delay time.Duration
-				switch resp.Request.Attempt {
-				case 1:
-					delay = 1 * time.Second
-				case 2:
-					delay = 3 * time.Second
-				case 3:
-					delay = 5 * time.Second
-				default:
-					delay = 5 * time.Second
-				}
-				logger.Log.Info("retrying", zap.Duration("delay", delay))
-				return delay, nil
-			}).
-		SetAllowNonIdempotentRetry(true).
-		SetRetryCount(3).
-		SetRetryWaitTime(1 * time.Second).
-		SetRetryMaxWaitTime(5 * time.Second)
-
-	return &Agent{
-		client:  client,
-		baseURL: fmt.Sprintf("http://%s", cfg.Address),
-		cfg:     cfg,
-
-		metrics: make(MetricsMap),
-		ctx:     ctx,
-		g:       group,
+	labels, err := agentLabels(cfg.Labels)
+	if err != nil {
+		logger.Log.Error("bad labels, sending metrics without them", zap.Error(err))
+	}
+
+	collectors := make(map[string]collector.Collector)
+	for _, name := range cfg.EnabledCollectors() {
+		c, err := collector.New(name, cfg)
+		if err != nil {
+			logger.Log.Panic("cannot create collector", zap.String("collector", name), zap.Error(err))
+		}
+		collectors[name] = c
+	}
+
+	var s sender
+	switch cfg.Transport {
+	case TransportGRPC:
+		s, err = newGRPCSender(ctx, cfg)
+	default:
+		s, err = newHTTPSender(ctx, cfg)
+	}
+	if err != nil {
+		logger.Log.Panic("cannot create sender", zap.String("transport", cfg.Transport), zap.Error(err))
 	}
+
+	var queue *spool.Queue
+	if cfg.QueueDir != "" {
+		queue, err = spool.Open(spool.Options{
+			Dir:     cfg.QueueDir,
+			MaxSize: cfg.QueueMaxSize,
+			MaxAge:  cfg.QueueMaxAge,
+			Drop:    cfg.QueueDrop,
+		})
+		if err != nil {
+			logger.Log.Panic("cannot open send queue", zap.String("dir", cfg.QueueDir), zap.Error(err))
+		}
+	}
+
+	var statsdServer *statsd.Server
+	if cfg.StatsdAddr != "" || cfg.StatsdSocket != "" {
+		statsdServer, err = statsd.Listen(cfg)
+		if err != nil {
+			logger.Log.Panic("cannot start statsd listener", zap.Error(err))
+		}
+	}
+
+	a := &Agent{
+		sender:     s,
+		queue:      queue,
+		collectors: collectors,
+		statsd:     statsdServer,
+		cfg:        cfg,
+
+		gauges:   make(map[string]map[string]model.Metrics),
+		counters: make(map[string]model.Metrics),
+		isolated: make(map[string]struct{}),
+		labels:   labels,
+		ctx:      ctx,
+		g:        group,
+	}
+
+	if cfg.PushAddr != "" {
+		a.push, err = push.Listen(cfg.PushAddr, a.merge)
+		if err != nil {
+			logger.Log.Panic("cannot start push api", zap.Error(err))
+		}
+	}
+
+	return a
 }
 
-func (a *Agent) SendMetrics() error {
+// Collect опрашивает сборщик name и запоминает снятые значения до следующей отправки.
+// Gauge сборщика заменяются набором из опроса целиком: серии, которые пропали
+// (отмонтированный диск, удалённый интерфейс, метрика цели scrape), больше
+// не отправляются. Неудачный опрос оставляет прежние значения.
+func (a *Agent) Collect(ctx context.Context, name string, c collector.Collector) error {
+	metrics, err := c.Collect(ctx)
+	if err != nil {
+		return err
+	}
+	a.update(name, metrics, true)
+
+	return nil
+}
+
+// merge запоминает значения, присланные в push API. Gauge приложений
+// не заменяются набором: каждое приложение присылает только свои серии.
+// Summary — снимок приложения, поэтому, как gauge, отправляется последний.
+func (a *Agent) merge(metrics []model.Metrics) {
+	a.update(pushSource, metrics, false)
+}
+
+// update запоминает значения источника source до следующей отправки: gauge заменяется
+// (с replace — весь набор источника), приращения counter и histogram прибавляются
+// к неотправленным.
+func (a *Agent) update(source string, metrics []model.Metrics, replace bool) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	for name, value := range a.metrics {
-		switch v := value.(type) {
-		case Gauge:
-			if err := a.sendOneMetric(model.Gauge, name, float64(v)); err != nil {
-				return fmt.Errorf("error sending gauge metric %s: %+v", name, err)
-			}
-		case Counter:
-			if err := a.sendOneMetric(model.Counter, name, int64(v)); err != nil {
-				return fmt.Errorf("error sending counter metric %s: %+v", name, err)
+	gauges := a.gauges[source]
+	if gauges == nil || replace {
+		gauges = make(map[string]model.Metrics)
+		a.gauges[source] = gauges
+	}
+
+	for _, m := range metrics {
+		m.Labels = a.seriesLabels(m.Labels)
+		key := model.SeriesKey(m.ID, m.Labels)
+
+		switch {
+		case m.MType == model.Gauge && m.Value != nil,
+			m.MType == model.Summary && m.Count != nil && m.Sum != nil:
+			gauges[key] = m
+		case m.MType == model.Counter && m.Delta != nil,
+			m.MType == model.Histogram && m.Count != nil && m.Sum != nil:
+			if (source == pushSource || source == statsdSource) && m.MType == model.Histogram {
+				a.isolated[key] = struct{}{}
 			}
+			a.addPending(key, m)
+		default:
+			logger.Log.Debug("collector metric is skipped, only gauges, counters and histograms are supported",
+				zap.String("id", m.ID), zap.String("type", m.MType))
 		}
 	}
+}
+
+// seriesLabels дополняет лейблы метрики лейблами агента. Лейблы сборщика важнее.
+func (a *Agent) seriesLabels(labels model.Labels) model.Labels {
+	if len(labels) == 0 {
+		return a.labels
+	}
+
+	merged := maps.Clone(a.labels)
+	if merged == nil {
+		merged = make(model.Labels, len(labels))
+	}
+	maps.Copy(merged, labels)
+
+	return merged.Normalize()
+}
+
+// SendMetrics отправляет метрики по одной. Приращения счётчиков, которые
+// не успели уйти до ошибки, остаются и уйдут со следующей отправкой.
+func (a *Agent) SendMetrics() error {
+	a.mu.Lock()
+	gauges := a.currentGauges()
+	a.mu.Unlock()
+
+	counters := a.takeCounters()
+
+	for _, m := range gauges {
+		if err := a.sender.sendOne(m); err != nil {
+			a.restoreCounters(counters)
+			return fmt.Errorf("error sending gauge metric %s: %+v", m.ID, err)
+		}
+	}
+	for key, m := range counters {
+		if err := a.sender.sendOne(m); err != nil {
+			a.restoreCounters(counters)
+			return fmt.Errorf("error sending counter metric %s: %+v", m.ID, err)
+		}
+		delete(counters, key)
+	}
 
 	return nil
 }
 
+// SendMetricsBatch отправляет текущие значения одной пачкой вместе с метриками,
+// которые приложения прислали по statsd с прошлой отправки. С очередью пачка
+// сначала ложится на диск, а затем очередь отправляется целиком по порядку:
+// пачки, не ушедшие во время недоступности сервера, уйдут первыми.
+// Без очереди неотправленная пачка остаётся в памяти и повторяется как есть,
+// а новые приращения копятся до её доставки и уходят следующей пачкой.
+// Пачка, которую сервер отверг, выбрасывается.
 func (a *Agent) SendMetricsBatch() error {
+	if a.statsd != nil {
+		// statsd отдаёт только изменившиеся gauge, поэтому они не заменяются набором
+		metrics, err := a.statsd.Collect(a.ctx)
+		if err != nil {
+			logger.Log.Error("collect statsd metrics error", zap.Error(err))
+		}
+		a.update(statsdSource, metrics, false)
+	}
+
+	if a.queue == nil {
+		if err := a.resendPending(); err != nil {
+			return fmt.Errorf("error resending metrics: %w", err)
+		}
+	}
+
+	counters := a.takeCounters()
+	batches, err := a.batches(counters)
+	if err != nil {
+		a.restoreCounters(counters)
+		if a.queue == nil {
+			return err
+		}
+		logger.Log.Error("cannot queue metrics, counters kept for next batch", zap.Error(err))
+	}
+
+	if a.queue == nil {
+		for i, b := range batches {
+			if err := a.deliver(b); err != nil {
+				a.keepPending(batches[i:]...)
+				return fmt.Errorf("error sending metrics: %w", err)
+			}
+		}
+		return nil
+	}
+
+	for i, b := range batches {
+		if err := a.queue.Push(b); err != nil {
+			a.restoreBatches(batches[i:])
+			logger.Log.Error("cannot queue metrics, counters kept for next batch", zap.Error(err))
+			break
+		}
+	}
+
+	if err := a.queue.Drain(a.deliver); err != nil {
+		return fmt.Errorf("error sending metrics, %d batches queued: %w", a.queue.Len(), err)
+	}
+
+	return nil
+}
+
+// deliver отправляет пачку из очереди или из pending. Пачку, которую сервер
+// отверг, повторять бессмысленно: она выбрасывается, чтобы не держать остальные.
+func (a *Agent) deliver(b spool.Batch) error {
+	err := a.sendBatchMetrics(b.ID, b.Metrics)
+	if errors.Is(err, errRejected) {
+		logger.Log.Error("server rejected batch, dropping it", zap.String("batch", b.ID), zap.Error(err))
+		return nil
+	}
+
+	return err
+}
+
+// resendPending повторяет неотправленные пачки по порядку. При ошибке
+// эта и следующие пачки остаются до следующей отправки.
+func (a *Agent) resendPending() error {
+	a.mu.Lock()
+	pending := a.pending
+	a.pending = nil
+	a.mu.Unlock()
+
+	for i, b := range pending {
+		if err := a.deliver(b); err != nil {
+			a.keepPending(pending[i:]...)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// keepPending оставляет пачки для повтора раньше пачек, не ушедших за это время.
+func (a *Agent) keepPending(batches ...spool.Batch) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	metricsBatch := make([]model.Metrics, 0, len(a.metrics))
-	for name, value := range a.metrics {
-		switch v := value.(type) {
-		case Gauge:
-			val := float64(v)
-			metricsBatch = append(metricsBatch, model.Metrics{
-				ID:    name,
-				MType: model.Gauge,
-				Value: &val,
-			})
-		case Counter:
-			delta := int64(v)
-			metricsBatch = append(metricsBatch, model.Metrics{
-				ID:    name,
-				MType: model.Counter,
-				Delta: &delta,
-			})
+	a.pending = append(slices.Clone(batches), a.pending...)
+}
+
+// batches собирает пачки для отправки: текущие значения и приращения counters
+// уходят одной пачкой, а каждая histogram из push API и statsd — отдельной. Границы
+// их корзин задаёт приложение или -statsd-buckets, и пачку с границами, которые не
+// совпали с хранимыми, сервер отвергает целиком: выброшена будет только эта серия.
+func (a *Agent) batches(counters map[string]model.Metrics) ([]spool.Batch, error) {
+	metrics := a.batch(counters)
+
+	var (
+		common []model.Metrics
+		groups [][]model.Metrics
+	)
+	a.mu.Lock()
+	for _, m := range metrics {
+		if _, ok := a.isolated[model.SeriesKey(m.ID, m.Labels)]; ok && m.MType == model.Histogram {
+			groups = append(groups, []model.Metrics{m})
+			continue
 		}
+		common = append(common, m)
+	}
+	a.mu.Unlock()
+	if len(common) > 0 {
+		groups = append([][]model.Metrics{common}, groups...)
 	}
 
-	if len(metricsBatch) > 0 {
-		if err := a.sendBatchMetrics(metricsBatch); err != nil {
-			return fmt.Errorf("error sending metrics %+v", err)
+	batches := make([]spool.Batch, 0, len(groups))
+	for _, g := range groups {
+		batchID, err := newBatchID()
+		if err != nil {
+			return nil, err
 		}
+		batches = append(batches, spool.Batch{ID: batchID, Metrics: g})
 	}
 
-	return nil
+	return batches, nil
 }
 
-func (a *Agent) GetRuntimeMetrics() error {
-	runtime.ReadMemStats(&a.ms)
+// batch собирает в пачку текущие значения gauge и приращения счётчиков counters.
+func (a *Agent) batch(counters map[string]model.Metrics) []model.Metrics {
 	a.mu.Lock()
 	defer a.mu.Unlock()
-	a.metrics["Alloc"] = Gauge(a.ms.Alloc)
-	a.metrics["BuckHashSys"] = Gauge(a.ms.BuckHashSys)
-	a.metrics["Frees"] = Gauge(a.ms.Frees)
-	a.metrics["GCCPUFraction"] = Gauge(a.ms.GCCPUFraction)
-	a.metrics["GCSys"] = Gauge(a.ms.GCSys)
-	a.metrics["HeapAlloc"] = Gauge(a.ms.HeapAlloc)
-	a.metrics["HeapIdle"] = Gauge(a.ms.HeapIdle)
-	a.metrics["HeapInuse"] = Gauge(a.ms.HeapInuse)
-	a.metrics["HeapObjects"] = Gauge(a.ms.HeapObjects)
-	a.metrics["HeapReleased"] = Gauge(a.ms.HeapReleased)
-	a.metrics["HeapSys"] = Gauge(a.ms.HeapSys)
-	a.metrics["LastGC"] = Gauge(a.ms.LastGC)
-	a.metrics["Lookups"] = Gauge(a.ms.Lookups)
-	a.metrics["MCacheInuse"] = Gauge(a.ms.MCacheInuse)
-	a.metrics["MCacheSys"] = Gauge(a.ms.MCacheSys)
-	a.metrics["MSpanInuse"] = Gauge(a.ms.MSpanInuse)
-	a.metrics["MSpanSys"] = Gauge(a.ms.MSpanSys)
-	a.metrics["Mallocs"] = Gauge(a.ms.Mallocs)
-	a.metrics["NextGC"] = Gauge(a.ms.NextGC)
-	a.metrics["NumForcedGC"] = Gauge(a.ms.NumForcedGC)
-	a.metrics["NumGC"] = Gauge(a.ms.NumGC)
-	a.metrics["OtherSys"] = Gauge(a.ms.OtherSys)
-	a.metrics["PauseTotalNs"] = Gauge(a.ms.PauseTotalNs)
-	a.metrics["StackInuse"] = Gauge(a.ms.StackInuse)
-	a.metrics["StackSys"] = Gauge(a.ms.StackSys)
-	a.metrics["Sys"] = Gauge(a.ms.Sys)
-	a.metrics["TotalAlloc"] = Gauge(a.ms.TotalAlloc)
-	a.metrics["RandomValue"] = Gauge(rand.Float64())
-	a.pollCount++
-	a.metrics["PollCount"] = Counter(a.pollCount)
 
-	return nil
+	metricsBatch := a.currentGauges()
+	for _, m := range counters {
+		metricsBatch = append(metricsBatch, m)
+	}
+
+	return metricsBatch
 }
 
-func (a *Agent) GetGopsutilMetrics() error {
-	v, err := mem.VirtualMemory()
-	if err != nil {
-		return err
+// currentGauges возвращает последние значения gauge и summary всех источников. Вызывается под a.mu.
+func (a *Agent) currentGauges() []model.Metrics {
+	var gauges []model.Metrics
+	for _, source := range a.gauges {
+		for _, m := range source {
+			gauges = append(gauges, m)
+		}
 	}
-	c, err := cpu.Percent(0, true)
-	if err != nil {
-		return err
+
+	return gauges
+}
+
+// addPending прибавляет приращение counter или histogram к неотправленному. Вызывается под a.mu.
+func (a *Agent) addPending(key string, m model.Metrics) {
+	stored, ok := a.counters[key]
+	if !ok || stored.MType != m.MType {
+		a.counters[key] = m
+		return
+	}
+
+	switch m.MType {
+	case model.Counter:
+		delta := *stored.Delta + *m.Delta
+		stored.Delta = &delta
+	case model.Histogram:
+		if err := model.MergeHistogram(&stored, m); err != nil {
+			// границы корзин сменились: старые наблюдения с новыми уже не сложить
+			logger.Log.Warn("histogram buckets changed, dropping unsent observations", zap.String("id", m.ID))
+			stored = m
+		}
 	}
+	a.counters[key] = stored
+}
 
+// takeCounters забирает накопленные приращения counter и histogram для отправки.
+// Пока пачка в пути, новые опросы копят приращения заново, поэтому
+// параллельная отправка не пошлёт одно и то же приращение дважды.
+func (a *Agent) takeCounters() map[string]model.Metrics {
 	a.mu.Lock()
 	defer a.mu.Unlock()
-	a.metrics["TotalMemory"] = Gauge(v.Total)
-	a.metrics["FreeMemory"] = Gauge(v.Free)
-	for i, cpuUtil := range c {
-		a.metrics[fmt.Sprintf("CPUutilization%d", i)] = Gauge(cpuUtil)
+
+	taken := make(map[string]model.Metrics, len(a.counters))
+	for key, m := range a.counters {
+		if (m.Delta != nil && *m.Delta != 0) || (m.Count != nil && *m.Count != 0) {
+			taken[key] = m
+		}
 	}
+	clear(a.counters)
 
-	return nil
+	return taken
+}
+
+// restoreBatches возвращает приращения пачек, которые не легли в очередь.
+func (a *Agent) restoreBatches(batches []spool.Batch) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, b := range batches {
+		for _, m := range b.Metrics {
+			if m.MType == model.Counter || m.MType == model.Histogram {
+				a.addPending(model.SeriesKey(m.ID, m.Labels), m)
+			}
+		}
+	}
+}
+
+// restoreCounters возвращает приращения неотправленной пачки: они уйдут со следующей.
+func (a *Agent) restoreCounters(counters map[string]model.Metrics) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for key, m := range counters {
+		a.addPending(key, m)
+	}
 }
 
+// Start опрашивает каждый включённый сборщик со своим интервалом
+// и раз в ReportInterval ставит отправку в очередь заданий.
 func (a *Agent) Start(sendJobs chan func() error) {
-	a.g.Go(func() error {
-		t := time.NewTicker(time.Duration(a.cfg.PollInterval) * time.Second)
-		defer t.Stop()
+	for name, c := range a.collectors {
+		interval := a.cfg.CollectorInterval(name)
+		logger.Log.Info("collector started", zap.String("collector", name), zap.Duration("interval", interval))
 
-		for {
-			select {
-			case <-a.ctx.Done():
-				return a.ctx.Err()
-			case <-t.C:
-				if err := a.GetGopsutilMetrics(); err != nil {
-					logger.Log.Error("get gopsutil metrics error", zap.Error(err))
-				}
-				if err := a.GetRuntimeMetrics(); err != nil {
-					logger.Log.Error("get runtime metrics error", zap.Error(err))
+		a.g.Go(func() error {
+			t := time.NewTicker(interval)
+			defer t.Stop()
+
+			for {
+				select {
+				case <-a.ctx.Done():
+					return a.ctx.Err()
+				case <-t.C:
+					if err := a.Collect(a.ctx, name, c); err != nil {
+						logger.Log.Error("collect metrics error", zap.String("collector", name), zap.Error(err))
+					}
 				}
 			}
-		}
-	})
+		})
+	}
+
+	if a.statsd != nil {
+		logger.Log.Info("statsd listener started", zap.Any("addrs", a.statsd.Addrs()))
+		a.g.Go(func() error {
+			return a.statsd.Serve(a.ctx)
+		})
+	}
+
+	if a.push != nil {
+		logger.Log.Info("push api started", zap.Stringer("addr", a.push.Addr()))
+		a.g.Go(func() error {
+			return a.push.Serve(a.ctx)
+		})
+	}
 
 	a.g.Go(func() error {
 		ticker := time.NewTicker(time.Duration(a.cfg.ReportInterval) * time.Second)
@@ -250,74 +509,28 @@ func (a *Agent) Start(sendJobs chan func() error) {
 	})
 }
 
-func (a *Agent) Close() error {
-	return a.client.Close()
-}
-
-func (a *Agent) sendOneMetric(mType, name string, value any) error {
-	body := model.Metrics{ID: name}
-	switch mType {
-	case model.Counter:
-		body.MType = model.Counter
-		v, ok := value.(int64)
-		if !ok {
-			return errors.New("int64 not ok")
-		}
-		body.Delta = &v
-	case model.Gauge:
-		body.MType = model.Gauge
-		v, ok := value.(float64)
-		if !ok {
-			return errors.New("float64 not ok")
-		}
-		body.Value = &v
-	}
-
-	jsonData, err := json.Marshal(body)
+// agentLabels разбирает лейблы из конфига и по умолчанию добавляет host.
+func agentLabels(raw string) (model.Labels, error) {
+	labels, err := model.ParseLabels(raw)
 	if err != nil {
-		return fmt.Errorf("failed to marshal JSON: %w", err)
+		return nil, err
 	}
-	logger.Log.Info("send request with body", zap.String("body", string(jsonData)))
-
-	url := fmt.Sprintf("%s/update/", a.baseURL)
-	req := a.client.NewRequest().
-		SetBody(body).
-		SetHeader("Content-Type", "application/json").
-		SetHeader("Accept-Encoding", "gzip")
 
-	if a.cfg.Key != "" {
-		hash := utils.GenerateSHA256(string(jsonData), a.cfg.Key)
-		req.SetHeader("HashSHA256", hash)
-	}
-
-	if _, err := req.Post(url); err != nil {
-		return err
+	if _, ok := labels["host"]; !ok {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return labels.Normalize(), err
+		}
+		labels["host"] = hostname
 	}
 
-	return nil
+	return labels.Normalize(), nil
 }
 
-func (a *Agent) sendBatchMetrics(metrics []model.Metrics) error {
-	jsonData, err := json.Marshal(metrics)
-	if err != nil {
-		return fmt.Errorf("failed to marshal JSON: %w", err)
-	}
-	logger.Log.Info("send request with body", zap.String("body", string(jsonData)))
-
-	url := fmt.Sprintf("%s/updates/", a.baseURL)
-	req := a.client.NewRequest().
-		SetBody(metrics).
-		SetHeader("Content-Type", "application/json").
-		SetHeader("Accept-Encoding", "gzip")
-
-	if a.cfg.Key != "" {
-		hash := utils.GenerateSHA256(string(jsonData), a.cfg.Key)
-		req.SetHeader("HashSHA256", hash)
-	}
-
-	if _, err := req.Post(url); err != nil {
-		return err
-	}
+func (a *Agent) Close() error {
+	return a.sender.close()
+}
 
-	return nil
+func (a *Agent) sendBatchMetrics(batchID string, metrics []model.Metrics) error {
+	return a.sender.sendBatch(batchID, metrics)
 }
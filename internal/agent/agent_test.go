@@ -0,0 +1,513 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/7StaSH7/gometrics/internal/agent/collector"
+	"github.com/7StaSH7/gometrics/internal/agent/spool"
+	"github.com/7StaSH7/gometrics/internal/agent/statsd"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errDown = errors.New("connection refused")
+
+// fakeSender складывает доставленные приращения счётчиков и число наблюдений
+// гистограмм и, как сервер, не применяет пачку с тем же идентификатором дважды.
+type fakeSender struct {
+	mu   sync.Mutex
+	fail func(m model.Metrics) error
+	// lost — пачка применяется, но ответ до агента не доходит
+	lost         bool
+	counters     map[string]int64
+	observations map[string]int64
+	applied      map[string]bool
+	batches      []string
+}
+
+func newFakeSender() *fakeSender {
+	return &fakeSender{
+		counters:     make(map[string]int64),
+		observations: make(map[string]int64),
+		applied:      make(map[string]bool),
+	}
+}
+
+func (s *fakeSender) sendOne(m model.Metrics) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fail != nil {
+		if err := s.fail(m); err != nil {
+			return err
+		}
+	}
+	if m.MType == model.Counter {
+		s.counters[m.ID] += *m.Delta
+	}
+
+	return nil
+}
+
+func (s *fakeSender) sendBatch(batchID string, metrics []model.Metrics) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range metrics {
+		if s.fail != nil {
+			if err := s.fail(m); err != nil {
+				return err
+			}
+		}
+	}
+	if s.applied[batchID] {
+		return nil
+	}
+	s.applied[batchID] = true
+	for _, m := range metrics {
+		switch m.MType {
+		case model.Counter:
+			s.counters[m.ID] += *m.Delta
+		case model.Histogram:
+			s.observations[m.ID] += *m.Count
+		}
+	}
+	s.batches = append(s.batches, batchID)
+
+	if s.lost {
+		return errDown
+	}
+
+	return nil
+}
+
+func (s *fakeSender) close() error {
+	return nil
+}
+
+func (s *fakeSender) setFail(fail func(m model.Metrics) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fail = fail
+}
+
+func (s *fakeSender) setLost(lost bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lost = lost
+}
+
+func (s *fakeSender) counter(name string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.counters[name]
+}
+
+func (s *fakeSender) observed(name string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.observations[name]
+}
+
+// collectFunc — сборщик, значения которого задаёт тест.
+type collectFunc func() []model.Metrics
+
+func (f collectFunc) Collect(_ context.Context) ([]model.Metrics, error) {
+	return f(), nil
+}
+
+func newTestAgent(s sender) *Agent {
+	return &Agent{
+		sender:   s,
+		gauges:   make(map[string]map[string]model.Metrics),
+		counters: make(map[string]model.Metrics),
+		isolated: make(map[string]struct{}),
+	}
+}
+
+func poll(t *testing.T, a *Agent, n int) {
+	c := collectFunc(func() []model.Metrics {
+		return []model.Metrics{
+			collector.Gauge("Alloc", 1, nil),
+			collector.Counter("PollCount", 1, nil),
+		}
+	})
+	for i := 0; i < n; i++ {
+		require.NoError(t, a.Collect(context.Background(), "poll", c))
+	}
+}
+
+func add(t *testing.T, a *Agent, name string, delta int64) {
+	require.NoError(t, a.Collect(context.Background(), "add", collectFunc(func() []model.Metrics {
+		return []model.Metrics{collector.Counter(name, delta, nil)}
+	})))
+}
+
+func TestSendMetricsBatchDelta(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps func(t *testing.T, a *Agent, s *fakeSender)
+		want  int64
+	}{
+		{
+			name: "only new polls are sent",
+			steps: func(t *testing.T, a *Agent, s *fakeSender) {
+				poll(t, a, 3)
+				require.NoError(t, a.SendMetricsBatch())
+				poll(t, a, 2)
+				require.NoError(t, a.SendMetricsBatch())
+			},
+			want: 5,
+		},
+		{
+			name: "nothing polled since last report",
+			steps: func(t *testing.T, a *Agent, s *fakeSender) {
+				poll(t, a, 3)
+				require.NoError(t, a.SendMetricsBatch())
+				require.NoError(t, a.SendMetricsBatch())
+			},
+			want: 3,
+		},
+		{
+			name: "failed report is kept for the next one",
+			steps: func(t *testing.T, a *Agent, s *fakeSender) {
+				poll(t, a, 2)
+				s.setFail(func(model.Metrics) error { return errDown })
+				assert.Error(t, a.SendMetricsBatch())
+				poll(t, a, 1)
+				assert.Error(t, a.SendMetricsBatch())
+				assert.Equal(t, int64(0), s.counter("PollCount"))
+
+				s.setFail(nil)
+				poll(t, a, 1)
+				require.NoError(t, a.SendMetricsBatch())
+			},
+			want: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeSender()
+			a := newTestAgent(s)
+
+			tt.steps(t, a, s)
+			assert.Equal(t, tt.want, s.counter("PollCount"))
+		})
+	}
+}
+
+func TestSendMetricsBatchStatsd(t *testing.T) {
+	s := newFakeSender()
+	a := newTestAgent(s)
+	a.statsd = &statsd.Server{Aggregator: statsd.NewAggregator([]float64{10, 100})}
+
+	receive := func(lines ...string) {
+		for _, line := range lines {
+			sample, err := statsd.Parse(line)
+			require.NoError(t, err)
+			a.statsd.Add(sample)
+		}
+	}
+
+	receive("hits:2|c", "latency:5|ms", "latency:50|ms")
+	s.setFail(func(model.Metrics) error { return errDown })
+	assert.Error(t, a.SendMetricsBatch())
+
+	// наблюдения неотправленной пачки складываются с новыми
+	receive("hits:1|c", "latency:500|ms")
+	s.setFail(nil)
+	require.NoError(t, a.SendMetricsBatch())
+	assert.Equal(t, int64(3), s.counter("hits"))
+	assert.Equal(t, int64(3), s.observed("latency"))
+
+	require.NoError(t, a.SendMetricsBatch())
+	assert.Equal(t, int64(3), s.counter("hits"))
+	assert.Equal(t, int64(3), s.observed("latency"))
+}
+
+func TestSendMetricsBatchIsolatesStatsdHistograms(t *testing.T) {
+	s := newFakeSender()
+	a := newTestAgent(s)
+	a.statsd = &statsd.Server{Aggregator: statsd.NewAggregator([]float64{10, 100})}
+
+	for _, line := range []string{"hits:2|c", "latency:5|ms", "size:50|h", "temp:21|g"} {
+		sample, err := statsd.Parse(line)
+		require.NoError(t, err)
+		a.statsd.Add(sample)
+	}
+	poll(t, a, 1)
+
+	// границы -statsd-buckets не совпали с хранимыми на сервере для latency
+	s.setFail(func(m model.Metrics) error {
+		if m.ID == "latency" {
+			return errRejected
+		}
+		return nil
+	})
+	require.NoError(t, a.SendMetricsBatch())
+
+	assert.Len(t, s.batches, 2)
+	assert.Zero(t, s.observed("latency"))
+	assert.Equal(t, int64(1), s.observed("size"))
+	assert.Equal(t, int64(2), s.counter("hits"))
+	assert.Equal(t, int64(1), s.counter("PollCount"))
+	assert.Empty(t, a.pending)
+}
+
+func TestMergePushed(t *testing.T) {
+	s := newFakeSender()
+	a := newTestAgent(s)
+	a.labels = model.Labels{"host": "web-1"}
+
+	// приложение присылает приращения между опросами агента, они складываются с собранными
+	add(t, a, "Requests", 2)
+	a.merge([]model.Metrics{
+		collector.Counter("Requests", 3, nil),
+		collector.Counter("Requests", 5, model.Labels{"route": "/a"}),
+	})
+
+	metrics := a.batch(a.takeCounters())
+	deltas := make(map[string]int64)
+	for _, m := range metrics {
+		deltas[model.SeriesKey(m.ID, m.Labels)] = *m.Delta
+	}
+	assert.Equal(t, map[string]int64{
+		`Requests{host="web-1"}`:            5,
+		`Requests{host="web-1",route="/a"}`: 5,
+	}, deltas)
+}
+
+func TestSendMetricsPartialFailure(t *testing.T) {
+	s := newFakeSender()
+	a := newTestAgent(s)
+	add(t, a, "Requests", 10)
+	poll(t, a, 2)
+
+	// PollCount уходит, Requests — нет
+	s.setFail(func(m model.Metrics) error {
+		if m.ID == "Requests" {
+			return errDown
+		}
+		return nil
+	})
+	assert.Error(t, a.SendMetrics())
+
+	poll(t, a, 1)
+	add(t, a, "Requests", 5)
+	s.setFail(nil)
+	require.NoError(t, a.SendMetrics())
+
+	assert.Equal(t, int64(3), s.counter("PollCount"))
+	assert.Equal(t, int64(15), s.counter("Requests"))
+}
+
+func TestSendMetricsBatchLostReply(t *testing.T) {
+	s := newFakeSender()
+	a := newTestAgent(s)
+
+	// сервер применил пачку, но агент получил ошибку
+	s.setLost(true)
+	poll(t, a, 2)
+	assert.Error(t, a.SendMetricsBatch())
+	assert.Equal(t, int64(2), s.counter("PollCount"))
+
+	// сервер недоступен: пачка ждёт, новые опросы копятся отдельно
+	s.setLost(false)
+	s.setFail(func(model.Metrics) error { return errDown })
+	poll(t, a, 3)
+	assert.Error(t, a.SendMetricsBatch())
+
+	// та же пачка уходит повторно и не применяется, новые приращения — следующей пачкой
+	s.setFail(nil)
+	poll(t, a, 1)
+	require.NoError(t, a.SendMetricsBatch())
+	assert.Equal(t, int64(6), s.counter("PollCount"))
+	require.Len(t, s.batches, 2)
+	assert.NotEqual(t, s.batches[0], s.batches[1])
+	assert.Empty(t, a.pending)
+}
+
+func TestSendMetricsBatchRejected(t *testing.T) {
+	s := newFakeSender()
+	a := newTestAgent(s)
+
+	// отвергнутая пачка выбрасывается и не возвращается в приращения
+	s.setFail(func(model.Metrics) error { return errRejected })
+	poll(t, a, 2)
+	require.NoError(t, a.SendMetricsBatch())
+	assert.Empty(t, a.pending)
+
+	s.setFail(nil)
+	poll(t, a, 1)
+	require.NoError(t, a.SendMetricsBatch())
+	assert.Equal(t, int64(1), s.counter("PollCount"))
+}
+
+func TestSendMetricsBatchIsolatesPushedHistograms(t *testing.T) {
+	s := newFakeSender()
+	a := newTestAgent(s)
+
+	latency := model.Observation(0.3, []float64{0.1, 1})
+	latency.ID = "Latency"
+	other := model.Observation(2, []float64{5})
+	other.ID = "Other"
+	count, sum := int64(2), 0.5
+	rpc := model.Metrics{ID: "RPC", MType: model.Summary, Count: &count, Sum: &sum}
+	a.merge([]model.Metrics{latency, other, rpc, collector.Counter("Requests", 1, nil)})
+	poll(t, a, 1)
+
+	// границы Latency не совпали с хранимыми на сервере
+	s.setFail(func(m model.Metrics) error {
+		if m.ID == "Latency" {
+			return errRejected
+		}
+		return nil
+	})
+	require.NoError(t, a.SendMetricsBatch())
+
+	assert.Len(t, s.batches, 2)
+	assert.Zero(t, s.observed("Latency"))
+	assert.Equal(t, int64(1), s.observed("Other"))
+	assert.Equal(t, int64(1), s.counter("Requests"))
+	assert.Equal(t, int64(1), s.counter("PollCount"))
+	assert.Empty(t, a.pending)
+
+	// summary приложения отправляется последним снимком, как gauge
+	assert.Contains(t, a.batch(nil), rpc)
+}
+
+func TestSendMetricsBatchQueued(t *testing.T) {
+	s := newFakeSender()
+	a := newTestAgent(s)
+	queue, err := spool.Open(spool.Options{Dir: t.TempDir(), MaxSize: 1 << 20, Drop: spool.DropOldest})
+	require.NoError(t, err)
+	a.queue = queue
+
+	// пачка, легшая в очередь, считается переданной: следующая несёт только новые опросы
+	s.setFail(func(model.Metrics) error { return errDown })
+	poll(t, a, 2)
+	assert.Error(t, a.SendMetricsBatch())
+	poll(t, a, 3)
+	assert.Error(t, a.SendMetricsBatch())
+	assert.Equal(t, 2, queue.Len())
+
+	s.setFail(nil)
+	require.NoError(t, a.SendMetricsBatch())
+	assert.Equal(t, int64(5), s.counter("PollCount"))
+	assert.Equal(t, 0, queue.Len())
+
+	// отвергнутая сервером пачка выбрасывается и не держит очередь
+	s.setFail(func(model.Metrics) error { return errRejected })
+	poll(t, a, 1)
+	require.NoError(t, a.SendMetricsBatch())
+	assert.Equal(t, 0, queue.Len())
+}
+
+func TestSendMetricsBatchConcurrent(t *testing.T) {
+	const workers, reports = 4, 50
+
+	s := newFakeSender()
+	a := newTestAgent(s)
+
+	var calls int
+	s.setFail(func(m model.Metrics) error {
+		// каждая третья пачка падает целиком
+		if m.ID != "PollCount" {
+			return nil
+		}
+		calls++
+		if calls%3 == 0 {
+			return errDown
+		}
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < reports; i++ {
+				poll(t, a, 1)
+				_ = a.SendMetricsBatch()
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.setFail(nil)
+	require.NoError(t, a.SendMetricsBatch())
+	assert.Equal(t, int64(workers*reports), s.counter("PollCount"))
+}
+
+func TestCollectReplacesGauges(t *testing.T) {
+	a := newTestAgent(newFakeSender())
+
+	devices := []string{"sda", "sdb"}
+	disk := collectFunc(func() []model.Metrics {
+		var metrics []model.Metrics
+		for _, d := range devices {
+			metrics = append(metrics, collector.Gauge("DiskFree", 10, model.Labels{"device": d}))
+		}
+		return metrics
+	})
+	net := collectFunc(func() []model.Metrics {
+		return []model.Metrics{collector.Gauge("NetUp", 1, model.Labels{"interface": "eth0"})}
+	})
+	require.NoError(t, a.Collect(context.Background(), "disk", disk))
+	require.NoError(t, a.Collect(context.Background(), "net", net))
+	a.merge([]model.Metrics{collector.Gauge("QueueLen", 3, nil)})
+
+	// sdb отмонтирован: его серия больше не отправляется, серии других источников остаются
+	devices = []string{"sda"}
+	require.NoError(t, a.Collect(context.Background(), "disk", disk))
+
+	var keys []string
+	for _, m := range a.batch(a.takeCounters()) {
+		keys = append(keys, model.SeriesKey(m.ID, m.Labels))
+	}
+	assert.ElementsMatch(t, []string{
+		`DiskFree{device="sda"}`,
+		`NetUp{interface="eth0"}`,
+		`QueueLen`,
+	}, keys)
+}
+
+func TestCollectLabels(t *testing.T) {
+	s := newFakeSender()
+	a := newTestAgent(s)
+	a.labels = model.Labels{"host": "web-1", "dc": "eu"}
+
+	c := collectFunc(func() []model.Metrics {
+		return []model.Metrics{
+			collector.Gauge("DiskFree", 10, model.Labels{"device": "sda"}),
+			collector.Gauge("DiskFree", 20, model.Labels{"device": "sdb", "dc": "us"}),
+			collector.Counter("Requests", 1, nil),
+			{ID: "Latency", MType: model.Histogram},
+		}
+	})
+	require.NoError(t, a.Collect(context.Background(), "disk", c))
+	require.NoError(t, a.Collect(context.Background(), "disk", c))
+
+	labels := make(map[string]model.Labels)
+	for _, m := range a.batch(a.takeCounters()) {
+		labels[model.SeriesKey(m.ID, m.Labels)] = m.Labels
+		if m.ID == "Requests" {
+			assert.Equal(t, int64(2), *m.Delta)
+		}
+	}
+	assert.Equal(t, map[string]model.Labels{
+		`DiskFree{dc="eu",device="sda",host="web-1"}`: {"host": "web-1", "dc": "eu", "device": "sda"},
+		`DiskFree{dc="us",device="sdb",host="web-1"}`: {"host": "web-1", "dc": "us", "device": "sdb"},
+		`Requests{dc="eu",host="web-1"}`:              {"host": "web-1", "dc": "eu"},
+	}, labels)
+}
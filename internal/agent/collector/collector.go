@@ -0,0 +1,78 @@
+// Package collector — источники метрик агента. Сборщик регистрируется под именем
+// через Register (обычно из init своего пакета, который подключается к агенту
+// пустым импортом) и включается списком AgentConfig.Collectors.
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/model"
+)
+
+var ErrUnknownCollector = errors.New("unknown collector")
+
+// Collector снимает значения метрик. Агент вызывает Collect с интервалом,
+// заданным для этого сборщика, и не вызывает его параллельно с самим собой.
+type Collector interface {
+	// Collect возвращает gauge с текущим значением и counter с приращением
+	// с прошлого вызова. Лейблы метрик дополняют лейблы агента.
+	Collect(ctx context.Context) ([]model.Metrics, error)
+}
+
+type Factory func(cfg *config.AgentConfig) (Collector, error)
+
+var (
+	mu        sync.RWMutex
+	factories = make(map[string]Factory)
+)
+
+// Register делает сборщик доступным по имени. Вызывается из init пакета сборщика.
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("collector %q registered twice", name))
+	}
+	factories[name] = factory
+}
+
+func New(name string, cfg *config.AgentConfig) (Collector, error) {
+	mu.RLock()
+	factory, ok := factories[name]
+	mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w %q, available: %v", ErrUnknownCollector, name, Names())
+	}
+
+	return factory(cfg)
+}
+
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Gauge возвращает gauge-метрику со значением value.
+func Gauge(name string, value float64, labels model.Labels) model.Metrics {
+	return model.Metrics{ID: name, MType: model.Gauge, Value: &value, Labels: labels}
+}
+
+// Counter возвращает counter-метрику с приращением delta.
+func Counter(name string, delta int64, labels model.Labels) model.Metrics {
+	return model.Metrics{ID: name, MType: model.Counter, Delta: &delta, Labels: labels}
+}
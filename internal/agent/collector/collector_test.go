@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	assert.Subset(t, Names(), []string{"disk", "gopsutil", "net", "process", "prometheus", "runtime", "system"})
+
+	_, err := New("nope", &config.AgentConfig{})
+	assert.ErrorIs(t, err, ErrUnknownCollector)
+
+	assert.Panics(t, func() {
+		Register("runtime", newRuntimeCollector)
+	})
+}
+
+func TestRuntimeCollector(t *testing.T) {
+	c, err := New("runtime", &config.AgentConfig{})
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		metrics, err := c.Collect(context.Background())
+		require.NoError(t, err)
+
+		byID := make(map[string]model.Metrics, len(metrics))
+		for _, m := range metrics {
+			byID[m.ID] = m
+		}
+		require.Contains(t, byID, "PollCount")
+		// каждый опрос — одно приращение, а не накопленное значение
+		assert.Equal(t, int64(1), *byID["PollCount"].Delta)
+		require.Contains(t, byID, "HeapAlloc")
+		assert.Positive(t, *byID["HeapAlloc"].Value)
+	}
+}
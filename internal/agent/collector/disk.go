@@ -0,0 +1,164 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/logger"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"go.uber.org/zap"
+)
+
+// sectorSize — размер сектора в /proc/diskstats, не зависит от устройства.
+const sectorSize = 512
+
+func init() {
+	Register("disk", newDiskCollector)
+}
+
+type fsUsage struct {
+	total, free, avail uint64
+}
+
+// diskCollector снимает заполненность файловых систем из /proc/mounts
+// и ввод-вывод блочных устройств из /proc/diskstats.
+type diskCollector struct {
+	proc   procFS
+	statfs func(path string) (fsUsage, error)
+	io     *cumulative
+}
+
+func newDiskCollector(cfg *config.AgentConfig) (Collector, error) {
+	return &diskCollector{proc: procFS(cfg.ProcRoot), statfs: statfs, io: newCumulative()}, nil
+}
+
+func (c *diskCollector) Collect(_ context.Context) ([]model.Metrics, error) {
+	usage, err := c.usage()
+	if err != nil {
+		return nil, err
+	}
+	io, err := c.stats()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(usage, io...), nil
+}
+
+// usage снимает заполненность файловых систем на блочных устройствах.
+// Точка монтирования, которую не удалось опросить, пропускается.
+func (c *diskCollector) usage() ([]model.Metrics, error) {
+	mounts, root, err := c.mounts()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read mounts: %w", err)
+	}
+
+	var metrics []model.Metrics
+	seen := make(map[string]bool)
+	for _, f := range mounts {
+		if len(f) < 2 || !strings.HasPrefix(f[0], "/dev/") {
+			continue
+		}
+		mount := unescapeMount(f[1])
+		if seen[mount] {
+			continue
+		}
+		seen[mount] = true
+
+		u, err := c.statfs(filepath.Join(root, mount))
+		if err != nil {
+			logger.Log.Debug("cannot stat filesystem", zap.String("mount", mount), zap.Error(err))
+			continue
+		}
+
+		used := u.total - u.free
+		percent := 0.0
+		if used+u.avail > 0 {
+			// как df: место, зарезервированное для root, не считается доступным
+			percent = float64(used) / float64(used+u.avail) * 100
+		}
+
+		labels := model.Labels{"device": f[0], "mount": mount}
+		metrics = append(metrics,
+			Gauge("DiskTotal", float64(u.total), labels),
+			Gauge("DiskUsed", float64(used), labels),
+			Gauge("DiskAvailable", float64(u.avail), labels),
+			Gauge("DiskUsedPercent", percent, labels),
+		)
+	}
+
+	return metrics, nil
+}
+
+// mounts возвращает таблицу монтирования хоста и корень, от которого считаются
+// её пути. Агент в контейнере видит свои точки монтирования, поэтому берётся
+// таблица init (PID 1), а пути разрешаются через <proc>/1/root. Без доступа
+// к корню init (агент запущен не от root) остаются таблица и пути самого агента.
+func (c *diskCollector) mounts() ([][]string, string, error) {
+	root := c.proc.path("1", "root")
+	if _, err := os.Stat(root + "/"); err == nil {
+		if mounts, err := c.proc.lines("1", "mounts"); err == nil {
+			return mounts, root, nil
+		}
+	}
+
+	mounts, err := c.proc.lines("mounts")
+
+	return mounts, "/", err
+}
+
+// stats снимает приращения операций и байт ввода-вывода по устройствам.
+func (c *diskCollector) stats() (metrics []model.Metrics, err error) {
+	lines, err := c.proc.lines("diskstats")
+	if err != nil {
+		return nil, fmt.Errorf("cannot read diskstats: %w", err)
+	}
+	defer func() { c.io.finish(err) }()
+
+	for _, f := range lines {
+		if len(f) < 10 || isVirtualDisk(f[2]) {
+			continue
+		}
+
+		device := f[2]
+		labels := model.Labels{"device": device}
+		for _, s := range []struct {
+			name  string
+			field int
+			scale uint64
+		}{
+			{"DiskReads", 3, 1},
+			{"DiskReadBytes", 5, sectorSize},
+			{"DiskWrites", 7, 1},
+			{"DiskWriteBytes", 9, sectorSize},
+		} {
+			v, err := parseUint(f[s.field])
+			if err != nil {
+				return nil, fmt.Errorf("bad diskstats line for %s: %w", device, err)
+			}
+			if delta, ok := c.io.delta(device+"\x00"+s.name, v*s.scale); ok {
+				metrics = append(metrics, Counter(s.name, delta, labels))
+			}
+		}
+	}
+
+	return metrics, nil
+}
+
+// isVirtualDisk отсеивает устройства без своего носителя.
+func isVirtualDisk(name string) bool {
+	for _, prefix := range []string{"loop", "ram", "zram"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unescapeMount раскодирует пробельные символы, которые /proc/mounts пишет восьмеричными кодами.
+var unescapeMount = strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`).Replace
@@ -0,0 +1,43 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/mem"
+)
+
+func init() {
+	Register("gopsutil", newGopsutilCollector)
+}
+
+// gopsutilCollector снимает память и загрузку процессоров хоста через gopsutil.
+type gopsutilCollector struct{}
+
+func newGopsutilCollector(_ *config.AgentConfig) (Collector, error) {
+	return gopsutilCollector{}, nil
+}
+
+func (gopsutilCollector) Collect(ctx context.Context) ([]model.Metrics, error) {
+	v, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c, err := cpu.PercentWithContext(ctx, 0, true)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := []model.Metrics{
+		Gauge("TotalMemory", float64(v.Total), nil),
+		Gauge("FreeMemory", float64(v.Free), nil),
+	}
+	for i, cpuUtil := range c {
+		metrics = append(metrics, Gauge(fmt.Sprintf("CPUutilization%d", i), cpuUtil, nil))
+	}
+
+	return metrics, nil
+}
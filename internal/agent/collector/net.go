@@ -0,0 +1,71 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/model"
+)
+
+func init() {
+	Register("net", newNetCollector)
+}
+
+// netCollector снимает приращения трафика и ошибок сетевых интерфейсов из /proc/net/dev.
+type netCollector struct {
+	proc procFS
+	io   *cumulative
+}
+
+func newNetCollector(cfg *config.AgentConfig) (Collector, error) {
+	return &netCollector{proc: procFS(cfg.ProcRoot), io: newCumulative()}, nil
+}
+
+// netFields — номера столбцов /proc/net/dev после имени интерфейса.
+var netFields = []struct {
+	name  string
+	field int
+}{
+	{"NetRxBytes", 0},
+	{"NetRxPackets", 1},
+	{"NetRxErrors", 2},
+	{"NetTxBytes", 8},
+	{"NetTxPackets", 9},
+	{"NetTxErrors", 10},
+}
+
+func (c *netCollector) Collect(_ context.Context) (metrics []model.Metrics, err error) {
+	data, err := c.proc.read("net", "dev")
+	if err != nil {
+		return nil, fmt.Errorf("cannot read net/dev: %w", err)
+	}
+	defer func() { c.io.finish(err) }()
+
+	for _, line := range strings.Split(string(data), "\n") {
+		// заголовок таблицы разделён "|", строки интерфейсов — двоеточием
+		iface, values, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		iface = strings.TrimSpace(iface)
+		f := strings.Fields(values)
+		if len(f) < 16 {
+			return nil, fmt.Errorf("bad net/dev line for %s", iface)
+		}
+
+		labels := model.Labels{"interface": iface}
+		for _, s := range netFields {
+			v, err := parseUint(f[s.field])
+			if err != nil {
+				return nil, fmt.Errorf("bad net/dev line for %s: %w", iface, err)
+			}
+			if delta, ok := c.io.delta(iface+"\x00"+s.name, v); ok {
+				metrics = append(metrics, Counter(s.name, delta, labels))
+			}
+		}
+	}
+
+	return metrics, nil
+}
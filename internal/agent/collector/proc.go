@@ -0,0 +1,87 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// userHZ — единица времени процессора в /proc, одинаковая для всех архитектур Linux.
+const userHZ = 100
+
+// procFS читает файлы procfs от корня root, чтобы агент в контейнере
+// мог смотреть на /proc хоста, а тесты — на подготовленное дерево.
+type procFS string
+
+func (p procFS) path(elem ...string) string {
+	return filepath.Join(append([]string{string(p)}, elem...)...)
+}
+
+func (p procFS) read(elem ...string) ([]byte, error) {
+	return os.ReadFile(p.path(elem...))
+}
+
+// lines возвращает непустые строки файла, разбитые на поля по пробелам.
+func (p procFS) lines(elem ...string) ([][]string, error) {
+	data, err := p.read(elem...)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines [][]string
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			lines = append(lines, fields)
+		}
+	}
+
+	return lines, nil
+}
+
+func parseUint(s string) (uint64, error) {
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// cumulative переводит накопленные с загрузки значения /proc в приращения с прошлого опроса.
+// Ключи, которые пропали из очередного опроса (отключённый диск, удалённый интерфейс), забываются.
+type cumulative struct {
+	prev, cur map[string]uint64
+}
+
+func newCumulative() *cumulative {
+	return &cumulative{prev: make(map[string]uint64), cur: make(map[string]uint64)}
+}
+
+// delta запоминает value и возвращает приращение. Первое значение ключа
+// только запоминается: накопленное с загрузки не отправляется как приращение.
+// Если значение уменьшилось, счётчик сбросили, и приращением считается всё значение.
+func (c *cumulative) delta(key string, value uint64) (int64, bool) {
+	c.cur[key] = value
+
+	prev, ok := c.prev[key]
+	if !ok {
+		return 0, false
+	}
+	if value < prev {
+		return int64(value), true
+	}
+
+	return int64(value - prev), true
+}
+
+// done завершает опрос: следующий будет считать приращения от значений этого.
+func (c *cumulative) done() {
+	c.prev, c.cur = c.cur, c.prev
+	clear(c.cur)
+}
+
+// finish завершает опрос, как done, если err == nil. Опрос, прерванный ошибкой,
+// отбрасывается: следующий считает приращения от последнего успешного.
+func (c *cumulative) finish(err error) {
+	if err != nil {
+		clear(c.cur)
+		return
+	}
+	c.done()
+}
@@ -0,0 +1,309 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testdata/proc/t0 и t1 — два последовательных снимка /proc одной машины.
+const (
+	procT0 = "testdata/proc/t0"
+	procT1 = "testdata/proc/t1"
+)
+
+// collectSeries опрашивает сборщик и возвращает значения метрик по ключу серии.
+func collectSeries(t *testing.T, c Collector) map[string]float64 {
+	t.Helper()
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	series := make(map[string]float64, len(metrics))
+	for _, m := range metrics {
+		key := model.SeriesKey(m.ID, m.Labels)
+		require.NotContains(t, series, key)
+		switch m.MType {
+		case model.Gauge:
+			series[key] = *m.Value
+		case model.Counter:
+			series[key] = float64(*m.Delta)
+		}
+	}
+
+	return series
+}
+
+// setRoot переключает сборщик на другой снимок /proc.
+func setRoot(c Collector, root string) {
+	switch c := c.(type) {
+	case *diskCollector:
+		c.proc = procFS(root)
+	case *netCollector:
+		c.proc = procFS(root)
+	case *systemCollector:
+		c.proc = procFS(root)
+	case *processCollector:
+		c.proc = procFS(root)
+	}
+}
+
+func key(id string, labels ...string) string {
+	l := make(model.Labels)
+	for i := 0; i+1 < len(labels); i += 2 {
+		l[labels[i]] = labels[i+1]
+	}
+
+	return model.SeriesKey(id, l.Normalize())
+}
+
+func TestProcCollectors(t *testing.T) {
+	tests := []struct {
+		name      string
+		collector string
+		cfg       config.AgentConfig
+		setup     func(c Collector)
+		// first и second — ожидаемые метрики после опроса t0 и затем t1
+		first  map[string]float64
+		second map[string]float64
+	}{
+		{
+			name:      "disk usage and io",
+			collector: "disk",
+			setup: func(c Collector) {
+				c.(*diskCollector).statfs = func(path string) (fsUsage, error) {
+					switch path {
+					case "/":
+						return fsUsage{total: 1000, free: 300, avail: 200}, nil
+					case "/mnt/my data":
+						return fsUsage{}, errors.New("permission denied")
+					}
+					return fsUsage{}, errors.New("unexpected mount " + path)
+				}
+			},
+			first: map[string]float64{
+				key("DiskTotal", "device", "/dev/sda1", "mount", "/"):       1000,
+				key("DiskUsed", "device", "/dev/sda1", "mount", "/"):        700,
+				key("DiskAvailable", "device", "/dev/sda1", "mount", "/"):   200,
+				key("DiskUsedPercent", "device", "/dev/sda1", "mount", "/"): 700.0 / 900 * 100,
+			},
+			second: map[string]float64{
+				key("DiskTotal", "device", "/dev/sda1", "mount", "/"):       1000,
+				key("DiskUsed", "device", "/dev/sda1", "mount", "/"):        700,
+				key("DiskAvailable", "device", "/dev/sda1", "mount", "/"):   200,
+				key("DiskUsedPercent", "device", "/dev/sda1", "mount", "/"): 700.0 / 900 * 100,
+				key("DiskReads", "device", "sda"):                           10,
+				key("DiskReadBytes", "device", "sda"):                       100 * 512,
+				key("DiskWrites", "device", "sda"):                          10,
+				key("DiskWriteBytes", "device", "sda"):                      400 * 512,
+				key("DiskReads", "device", "sda1"):                          5,
+				key("DiskReadBytes", "device", "sda1"):                      100 * 512,
+				key("DiskWrites", "device", "sda1"):                         10,
+				key("DiskWriteBytes", "device", "sda1"):                     400 * 512,
+			},
+		},
+		{
+			name:      "network interfaces",
+			collector: "net",
+			first:     map[string]float64{},
+			second: map[string]float64{
+				key("NetRxBytes", "interface", "lo"):   500,
+				key("NetRxPackets", "interface", "lo"): 5,
+				key("NetRxErrors", "interface", "lo"):  0,
+				key("NetTxBytes", "interface", "lo"):   500,
+				key("NetTxPackets", "interface", "lo"): 5,
+				key("NetTxErrors", "interface", "lo"):  0,
+				// счётчики приёма eth0 сброшены: приращение — всё новое значение
+				key("NetRxBytes", "interface", "eth0"):   300,
+				key("NetRxPackets", "interface", "eth0"): 3,
+				key("NetRxErrors", "interface", "eth0"):  0,
+				key("NetTxBytes", "interface", "eth0"):   500000,
+				key("NetTxPackets", "interface", "eth0"): 500,
+				key("NetTxErrors", "interface", "eth0"):  2,
+			},
+		},
+		{
+			name:      "load, files and context switches",
+			collector: "system",
+			first: map[string]float64{
+				key("LoadAverage1"):  0.52,
+				key("LoadAverage5"):  1.25,
+				key("LoadAverage15"): 2,
+				key("ProcsRunning"):  3,
+				key("ProcsTotal"):    345,
+				key("OpenFiles"):     2000,
+				key("MaxFiles"):      9223372036854775807,
+			},
+			second: map[string]float64{
+				key("LoadAverage1"):    0.52,
+				key("LoadAverage5"):    1.25,
+				key("LoadAverage15"):   2,
+				key("ProcsRunning"):    3,
+				key("ProcsTotal"):      345,
+				key("OpenFiles"):       2000,
+				key("MaxFiles"):        9223372036854775807,
+				key("ContextSwitches"): 250,
+			},
+		},
+		{
+			name:      "processes",
+			collector: "process",
+			cfg:       config.AgentConfig{Processes: "nginx, (sd-pam),very-long-process-name,absent"},
+			setup: func(c Collector) {
+				start := time.Unix(1700000000, 0)
+				calls := 0
+				c.(*processCollector).now = func() time.Time {
+					calls++
+					return start.Add(time.Duration(calls-1) * 10 * time.Second)
+				}
+			},
+			first: map[string]float64{
+				key("ProcessCount", "process", "nginx"):                  2,
+				key("ProcessRSS", "process", "nginx"):                    2 * 2048 * 1024,
+				key("ProcessCount", "process", "(sd-pam)"):               1,
+				key("ProcessRSS", "process", "(sd-pam)"):                 10240 * 1024,
+				key("ProcessCount", "process", "very-long-process-name"): 1,
+				key("ProcessRSS", "process", "very-long-process-name"):   100 * 1024,
+				key("ProcessCount", "process", "absent"):                 0,
+				key("ProcessRSS", "process", "absent"):                   0,
+			},
+			second: map[string]float64{
+				// 101 завершился, 102 только появился: загрузку даёт только 100,
+				// 200 тиков за 10 секунд
+				key("ProcessCount", "process", "nginx"):                  2,
+				key("ProcessRSS", "process", "nginx"):                    2 * 2048 * 1024,
+				key("ProcessCPU", "process", "nginx"):                    20,
+				key("ProcessCount", "process", "(sd-pam)"):               1,
+				key("ProcessRSS", "process", "(sd-pam)"):                 10240 * 1024,
+				key("ProcessCPU", "process", "(sd-pam)"):                 10,
+				key("ProcessCount", "process", "very-long-process-name"): 1,
+				key("ProcessRSS", "process", "very-long-process-name"):   100 * 1024,
+				key("ProcessCPU", "process", "very-long-process-name"):   0,
+				key("ProcessCount", "process", "absent"):                 0,
+				key("ProcessRSS", "process", "absent"):                   0,
+				key("ProcessCPU", "process", "absent"):                   0,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.ProcRoot = procT0
+			c, err := New(tt.collector, &cfg)
+			require.NoError(t, err)
+			if tt.setup != nil {
+				tt.setup(c)
+			}
+
+			assert.InDeltaMapValues(t, tt.first, collectSeries(t, c), 1e-9)
+
+			setRoot(c, procT1)
+			assert.InDeltaMapValues(t, tt.second, collectSeries(t, c), 1e-9)
+		})
+	}
+}
+
+func TestProcCollectorsErrors(t *testing.T) {
+	for _, name := range []string{"disk", "net", "system"} {
+		t.Run(name, func(t *testing.T) {
+			c, err := New(name, &config.AgentConfig{ProcRoot: t.TempDir()})
+			require.NoError(t, err)
+
+			_, err = c.Collect(context.Background())
+			assert.Error(t, err)
+		})
+	}
+
+	t.Run("process without list", func(t *testing.T) {
+		c, err := New("process", &config.AgentConfig{ProcRoot: t.TempDir()})
+		require.NoError(t, err)
+
+		metrics, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, metrics)
+	})
+}
+
+func TestDiskHostRoot(t *testing.T) {
+	proc := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(proc, "1", "root"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(proc, "1", "mounts"), []byte("/dev/sda1 /data ext4 rw 0 0\n"), 0600))
+	// таблица самого агента в контейнере
+	require.NoError(t, os.WriteFile(filepath.Join(proc, "mounts"), []byte("overlay / overlay rw 0 0\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(proc, "diskstats"), nil, 0600))
+
+	c, err := New("disk", &config.AgentConfig{ProcRoot: proc})
+	require.NoError(t, err)
+	var paths []string
+	c.(*diskCollector).statfs = func(path string) (fsUsage, error) {
+		paths = append(paths, path)
+		return fsUsage{total: 100, free: 50, avail: 50}, nil
+	}
+
+	series := collectSeries(t, c)
+	assert.Equal(t, []string{filepath.Join(proc, "1", "root", "data")}, paths)
+	assert.Contains(t, series, key("DiskTotal", "device", "/dev/sda1", "mount", "/data"))
+}
+
+func TestNetCollectorBadLine(t *testing.T) {
+	proc := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(proc, "net"), 0700))
+	write := func(lines ...string) {
+		data := "Inter-|   Receive\n face |bytes\n" + strings.Join(lines, "\n") + "\n"
+		require.NoError(t, os.WriteFile(filepath.Join(proc, "net", "dev"), []byte(data), 0600))
+	}
+	line := func(iface string, rx int) string {
+		return fmt.Sprintf("%s: %d 1 0 0 0 0 0 0 %d 1 0 0 0 0 0 0", iface, rx, rx)
+	}
+
+	c, err := New("net", &config.AgentConfig{ProcRoot: proc})
+	require.NoError(t, err)
+
+	write(line("eth0", 100), line("eth1", 100))
+	collectSeries(t, c)
+
+	// eth0 разобран, eth1 — нет: опрос целиком не учитывается
+	write(line("eth0", 150), "eth1: garbage")
+	_, err = c.Collect(context.Background())
+	require.Error(t, err)
+
+	write(line("eth0", 200), line("eth1", 300))
+	series := collectSeries(t, c)
+	assert.Equal(t, 100.0, series[key("NetRxBytes", "interface", "eth0")])
+	assert.Equal(t, 200.0, series[key("NetRxBytes", "interface", "eth1")])
+}
+
+func TestCumulative(t *testing.T) {
+	c := newCumulative()
+
+	_, ok := c.delta("a", 10)
+	assert.False(t, ok, "first value is a baseline")
+	c.done()
+
+	d, ok := c.delta("a", 15)
+	assert.True(t, ok)
+	assert.Equal(t, int64(5), d)
+	_, ok = c.delta("b", 1)
+	assert.False(t, ok)
+	c.done()
+
+	d, ok = c.delta("a", 3)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), d, "reset counter")
+	c.done()
+
+	// b пропал в прошлом опросе и снова считается новым
+	_, ok = c.delta("b", 2)
+	assert.False(t, ok)
+}
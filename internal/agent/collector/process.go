@@ -0,0 +1,182 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/model"
+)
+
+// commLen — сколько символов имени процесса ядро хранит в comm.
+const commLen = 15
+
+func init() {
+	Register("process", newProcessCollector)
+}
+
+// processCollector снимает загрузку процессора и резидентную память процессов
+// из списка AgentConfig.Processes. Все процессы с одним именем суммируются.
+type processCollector struct {
+	proc  procFS
+	names []string
+	now   func() time.Time
+
+	// cpu — процессорное время процессов в тиках по pid и времени запуска,
+	// чтобы переиспользованный pid не считался тем же процессом
+	cpu  *cumulative
+	last time.Time
+}
+
+func newProcessCollector(cfg *config.AgentConfig) (Collector, error) {
+	return &processCollector{
+		proc:  procFS(cfg.ProcRoot),
+		names: cfg.EnabledProcesses(),
+		now:   time.Now,
+		cpu:   newCumulative(),
+	}, nil
+}
+
+type procStat struct {
+	comm      string
+	ticks     uint64
+	startTime string
+}
+
+type procTotal struct {
+	count int
+	ticks int64
+	rss   uint64
+}
+
+func (c *processCollector) Collect(_ context.Context) ([]model.Metrics, error) {
+	if len(c.names) == 0 {
+		return nil, nil
+	}
+
+	entries, err := os.ReadDir(c.proc.path())
+	if err != nil {
+		return nil, fmt.Errorf("cannot read proc: %w", err)
+	}
+	defer c.cpu.done()
+
+	now := c.now()
+	totals := make(map[string]*procTotal, len(c.names))
+	for _, name := range c.names {
+		totals[name] = &procTotal{}
+	}
+
+	for _, e := range entries {
+		pid := e.Name()
+		if _, err := strconv.Atoi(pid); err != nil {
+			continue
+		}
+
+		// процесс мог завершиться после чтения каталога, такие просто пропускаются
+		st, err := c.stat(pid)
+		if err != nil {
+			continue
+		}
+		name, ok := c.match(st.comm)
+		if !ok {
+			continue
+		}
+
+		total := totals[name]
+		total.count++
+		if delta, ok := c.cpu.delta(pid+"\x00"+st.startTime, st.ticks); ok {
+			total.ticks += delta
+		}
+		if rss, err := c.rss(pid); err == nil {
+			total.rss += rss
+		}
+	}
+
+	metrics := make([]model.Metrics, 0, 3*len(c.names))
+	for _, name := range c.names {
+		total := totals[name]
+		labels := model.Labels{"process": name}
+		metrics = append(metrics,
+			Gauge("ProcessCount", float64(total.count), labels),
+			Gauge("ProcessRSS", float64(total.rss), labels),
+		)
+		// загрузку можно посчитать только по двум опросам
+		if elapsed := now.Sub(c.last).Seconds(); !c.last.IsZero() && elapsed > 0 {
+			cpu := float64(total.ticks) / userHZ / elapsed * 100
+			metrics = append(metrics, Gauge("ProcessCPU", cpu, labels))
+		}
+	}
+	c.last = now
+
+	return metrics, nil
+}
+
+// match возвращает имя из списка, под которое подходит comm процесса.
+// Ядро обрезает comm, поэтому длинные имена сравниваются по началу.
+func (c *processCollector) match(comm string) (string, bool) {
+	for _, name := range c.names {
+		if len(name) > commLen && len(comm) == commLen {
+			if strings.HasPrefix(name, comm) {
+				return name, true
+			}
+			continue
+		}
+		if name == comm {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// stat разбирает /proc/[pid]/stat. Имя процесса в скобках может содержать
+// пробелы и скобки, поэтому поля считаются от последней закрывающей скобки.
+func (c *processCollector) stat(pid string) (procStat, error) {
+	data, err := c.proc.read(pid, "stat")
+	if err != nil {
+		return procStat{}, err
+	}
+
+	s := string(data)
+	open, end := strings.IndexByte(s, '('), strings.LastIndexByte(s, ')')
+	if open < 0 || end < open {
+		return procStat{}, fmt.Errorf("bad stat of %s", pid)
+	}
+	// поля после имени: state, ppid, ..., utime (11), stime (12), ..., starttime (19)
+	f := strings.Fields(s[end+1:])
+	if len(f) < 20 {
+		return procStat{}, fmt.Errorf("bad stat of %s", pid)
+	}
+
+	utime, err := parseUint(f[11])
+	if err != nil {
+		return procStat{}, fmt.Errorf("bad utime of %s: %w", pid, err)
+	}
+	stime, err := parseUint(f[12])
+	if err != nil {
+		return procStat{}, fmt.Errorf("bad stime of %s: %w", pid, err)
+	}
+
+	return procStat{comm: s[open+1 : end], ticks: utime + stime, startTime: f[19]}, nil
+}
+
+// rss возвращает VmRSS из /proc/[pid]/status в байтах. У потоков ядра его нет.
+func (c *processCollector) rss(pid string) (uint64, error) {
+	lines, err := c.proc.lines(pid, "status")
+	if err != nil {
+		return 0, err
+	}
+
+	for _, f := range lines {
+		if f[0] == "VmRSS:" && len(f) >= 2 {
+			kb, err := parseUint(f[1])
+			return kb * 1024, err
+		}
+	}
+
+	return 0, nil
+}
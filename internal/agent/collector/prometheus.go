@@ -0,0 +1,166 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/logger"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"go.uber.org/zap"
+)
+
+// maxScrapeSize ограничивает ответ одной цели, чтобы сломанная цель не съела память агента.
+const maxScrapeSize = 16 << 20
+
+func init() {
+	Register("prometheus", newPrometheusCollector)
+}
+
+// scrapeTarget — цель опроса со своими накопленными значениями counter.
+type scrapeTarget struct {
+	url      string
+	instance string
+	// counters — накопленные значения counter цели. Меняются только
+	// после успешного опроса, поэтому сбой не сбрасывает приращения.
+	counters *cumulative
+}
+
+// prometheusCollector опрашивает /metrics локальных сервисов в текстовом формате
+// Prometheus. Цели опрашиваются параллельно, каждая со своим таймаутом.
+// Значения помечаются лейблом instance с адресом цели, а для каждой цели
+// отдаются ScrapeUp, ScrapeDuration, ScrapeSamples и счётчик ScrapeFailures.
+type prometheusCollector struct {
+	client  *http.Client
+	timeout time.Duration
+	targets []*scrapeTarget
+}
+
+func newPrometheusCollector(cfg *config.AgentConfig) (Collector, error) {
+	urls := cfg.EnabledScrapeTargets()
+	if len(urls) == 0 {
+		return nil, errors.New("prometheus collector needs scrape targets")
+	}
+
+	c := &prometheusCollector{client: &http.Client{}, timeout: cfg.ScrapeTimeout}
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("bad scrape target %q, expected http(s)://host:port/path", raw)
+		}
+		c.targets = append(c.targets, &scrapeTarget{url: raw, instance: u.Host, counters: newCumulative()})
+	}
+
+	return c, nil
+}
+
+func (c *prometheusCollector) Collect(ctx context.Context) ([]model.Metrics, error) {
+	results := make([][]model.Metrics, len(c.targets))
+
+	var wg sync.WaitGroup
+	for i, t := range c.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.scrape(ctx, t)
+		}()
+	}
+	wg.Wait()
+
+	var metrics []model.Metrics
+	for _, r := range results {
+		metrics = append(metrics, r...)
+	}
+
+	return metrics, nil
+}
+
+// scrape опрашивает одну цель. Сбой цели не прерывает опрос остальных:
+// он отражается в её ScrapeUp и ScrapeFailures.
+func (c *prometheusCollector) scrape(ctx context.Context, t *scrapeTarget) []model.Metrics {
+	start := time.Now()
+	samples, err := c.fetch(ctx, t.url)
+	duration := time.Since(start).Seconds()
+
+	labels := model.Labels{"instance": t.instance}
+	if err != nil {
+		logger.Log.Warn("scrape failed", zap.String("target", t.url), zap.Error(err))
+		return []model.Metrics{
+			Gauge("ScrapeUp", 0, labels),
+			Gauge("ScrapeDuration", duration, labels),
+			Counter("ScrapeFailures", 1, labels),
+		}
+	}
+
+	metrics := make([]model.Metrics, 0, len(samples)+4)
+	for _, s := range samples {
+		// как в Prometheus: лейбл instance задаёт агент, а свой сервис сохраняет под другим именем
+		if v, ok := s.labels["instance"]; ok {
+			s.labels["exported_instance"] = v
+		}
+		s.labels["instance"] = t.instance
+
+		switch s.typ {
+		case promGauge:
+			metrics = append(metrics, Gauge(s.name, s.value, s.labels))
+		case promCounter:
+			// приращения считаются по целой части: дробные counter (секунды)
+			// в сумме приращений не теряют ничего, кроме последней доли
+			if s.value < 0 {
+				continue
+			}
+			if delta, ok := t.counters.delta(model.SeriesKey(s.name, s.labels), uint64(math.Floor(s.value))); ok {
+				metrics = append(metrics, Counter(s.name, delta, s.labels))
+			}
+		}
+	}
+	t.counters.done()
+
+	return append(metrics,
+		Gauge("ScrapeUp", 1, labels),
+		Gauge("ScrapeDuration", duration, labels),
+		Gauge("ScrapeSamples", float64(len(samples)), labels),
+	)
+}
+
+func (c *prometheusCollector) fetch(ctx context.Context, target string) ([]promSample, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxScrapeSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxScrapeSize {
+		return nil, fmt.Errorf("response is larger than %d bytes", maxScrapeSize)
+	}
+
+	return parseExposition(bytes.NewReader(body))
+}
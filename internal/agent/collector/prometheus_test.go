@@ -0,0 +1,162 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExposition(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    []promSample
+		wantErr bool
+	}{
+		{
+			name: "counters, gauges and untyped",
+			text: `# HELP http_requests_total Requests.
+# TYPE http_requests_total counter
+http_requests_total{method="get",code="200"} 1027 1395066363000
+http_requests_total{method="post",code="400"} 3
+# TYPE temperature gauge
+temperature -3.5
+uptime_seconds 120
+`,
+			want: []promSample{
+				{name: "http_requests_total", labels: model.Labels{"method": "get", "code": "200"}, value: 1027, typ: promCounter},
+				{name: "http_requests_total", labels: model.Labels{"method": "post", "code": "400"}, value: 3, typ: promCounter},
+				{name: "temperature", labels: model.Labels{}, value: -3.5, typ: promGauge},
+				{name: "uptime_seconds", labels: model.Labels{}, value: 120, typ: promGauge},
+			},
+		},
+		{
+			name: "openmetrics counter family and escaped labels",
+			text: `# TYPE jobs counter
+jobs_total{path="C:\\tmp",msg="say \"hi\"\n", empty=""} 5
+jobs_created 1.7e9
+`,
+			want: []promSample{
+				{name: "jobs_total", labels: model.Labels{"path": `C:\tmp`, "msg": "say \"hi\"\n"}, value: 5, typ: promCounter},
+			},
+		},
+		{
+			name: "histograms, summaries and non-finite values are skipped",
+			text: `# TYPE latency histogram
+latency_bucket{le="0.1"} 1
+latency_bucket{le="+Inf"} 2
+latency_sum 0.3
+latency_count 2
+# TYPE rpc summary
+rpc{quantile="0.5"} 0.2
+rpc_sum 1
+rpc_count 5
+# TYPE ratio gauge
+ratio NaN
+ratio_count 4
+`,
+			want: []promSample{
+				{name: "ratio_count", labels: model.Labels{}, value: 4, typ: promGauge},
+			},
+		},
+		{name: "no value", text: "metric\n", wantErr: true},
+		{name: "bad value", text: "metric abc\n", wantErr: true},
+		{name: "unterminated labels", text: `metric{a="1} 2` + "\n", wantErr: true},
+		{name: "unquoted label", text: "metric{a=1} 2\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExposition(strings.NewReader(tt.text))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPrometheusCollector(t *testing.T) {
+	var polls atomic.Int64
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := polls.Add(1)
+		fmt.Fprintf(w, "# TYPE requests_total counter\nrequests_total{instance=\"self\"} %d\n", 10*n)
+		fmt.Fprintf(w, "# TYPE cpu_seconds_total counter\ncpu_seconds_total %v\n", 1.5*float64(n))
+		fmt.Fprintf(w, "# TYPE queue gauge\nqueue %d\n", n)
+	}))
+	defer app.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	host := func(s *httptest.Server) string {
+		u, err := url.Parse(s.URL)
+		require.NoError(t, err)
+		return u.Host
+	}
+
+	c, err := New("prometheus", &config.AgentConfig{
+		ScrapeTargets: strings.Join([]string{app.URL + "/metrics", broken.URL, slow.URL}, ","),
+		ScrapeTimeout: 100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	appLabels := func(extra ...string) []string {
+		return append([]string{"instance", host(app)}, extra...)
+	}
+	failed := func(s *httptest.Server) map[string]float64 {
+		return map[string]float64{
+			key("ScrapeUp", "instance", host(s)):       0,
+			key("ScrapeFailures", "instance", host(s)): 1,
+		}
+	}
+
+	// первый опрос только запоминает накопленные значения counter
+	got := collectSeries(t, c)
+	assert.Equal(t, 1.0, got[key("queue", appLabels()...)])
+	assert.Equal(t, 1.0, got[key("ScrapeUp", appLabels()...)])
+	assert.Equal(t, 3.0, got[key("ScrapeSamples", appLabels()...)])
+	assert.NotContains(t, got, key("requests_total", appLabels("exported_instance", "self")...))
+	assert.NotContains(t, got, key("cpu_seconds_total", appLabels()...))
+	for _, s := range []*httptest.Server{broken, slow} {
+		for k, v := range failed(s) {
+			assert.Equal(t, v, got[k], k)
+		}
+	}
+	assert.Less(t, got[key("ScrapeDuration", "instance", host(slow))], 1.0)
+
+	got = collectSeries(t, c)
+	assert.Equal(t, 10.0, got[key("requests_total", appLabels("exported_instance", "self")...)])
+	// 1.5 → 3: целая часть выросла с 1 до 3
+	assert.Equal(t, 2.0, got[key("cpu_seconds_total", appLabels()...)])
+	assert.Equal(t, 2.0, got[key("queue", appLabels()...)])
+
+	_, err = New("prometheus", &config.AgentConfig{})
+	assert.Error(t, err)
+	_, err = New("prometheus", &config.AgentConfig{ScrapeTargets: "localhost:9100"})
+	assert.Error(t, err)
+}
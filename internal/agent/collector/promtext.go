@@ -0,0 +1,175 @@
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/7StaSH7/gometrics/internal/model"
+)
+
+const (
+	promCounter   = "counter"
+	promGauge     = "gauge"
+	promUntyped   = "untyped"
+	promHistogram = "histogram"
+	promSummary   = "summary"
+)
+
+// promSample — значение из текстового формата Prometheus с типом его семейства.
+type promSample struct {
+	name   string
+	labels model.Labels
+	value  float64
+	typ    string
+}
+
+// parseExposition разбирает текстовый формат Prometheus 0.0.4. Значения
+// гистограмм и summary пропускаются: агент пересылает только counter и gauge,
+// а untyped считается gauge.
+func parseExposition(r io.Reader) ([]promSample, error) {
+	types := make(map[string]string)
+	var samples []promSample
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			// # TYPE name type; HELP и прочие комментарии не нужны
+			f := strings.Fields(line)
+			if len(f) == 4 && f[1] == "TYPE" {
+				types[f[2]] = f[3]
+			}
+			continue
+		}
+
+		sample, err := parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		sample.typ = familyType(types, sample.name)
+		switch sample.typ {
+		case promCounter, promGauge:
+		case promUntyped:
+			sample.typ = promGauge
+		default:
+			continue
+		}
+		if math.IsNaN(sample.value) || math.IsInf(sample.value, 0) {
+			continue
+		}
+		samples = append(samples, sample)
+	}
+
+	return samples, s.Err()
+}
+
+// familyType возвращает тип семейства, к которому относится значение name.
+// Значения гистограмм и summary называются по семейству с суффиксом,
+// а counter в OpenMetrics объявляется без суффикса _total.
+func familyType(types map[string]string, name string) string {
+	if typ, ok := types[name]; ok {
+		return typ
+	}
+	for _, suffix := range []string{"_total", "_bucket", "_sum", "_count", "_created"} {
+		family, ok := strings.CutSuffix(name, suffix)
+		if !ok {
+			continue
+		}
+		switch typ := types[family]; {
+		case typ == promCounter && suffix == "_total":
+			return typ
+		case typ == promCounter && suffix == "_created":
+			// время создания counter из OpenMetrics — не значение
+			return ""
+		case typ == promHistogram || typ == promSummary:
+			return typ
+		}
+	}
+
+	return promUntyped
+}
+
+var errBadSample = errors.New("bad sample")
+
+// parseSample разбирает строку name{label="value",...} value [timestamp].
+func parseSample(line string) (promSample, error) {
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return promSample{}, fmt.Errorf("%w %q", errBadSample, line)
+	}
+	sample := promSample{name: line[:end], labels: make(model.Labels)}
+	rest := line[end:]
+
+	if rest[0] == '{' {
+		var err error
+		if rest, err = parseLabels(rest[1:], sample.labels); err != nil {
+			return promSample{}, fmt.Errorf("%w %q: %w", errBadSample, line, err)
+		}
+	}
+
+	f := strings.Fields(rest)
+	if len(f) < 1 || len(f) > 2 {
+		return promSample{}, fmt.Errorf("%w %q", errBadSample, line)
+	}
+	v, err := strconv.ParseFloat(f[0], 64)
+	if err != nil {
+		return promSample{}, fmt.Errorf("%w %q: %w", errBadSample, line, err)
+	}
+	sample.value = v
+	sample.labels = sample.labels.Normalize()
+
+	return sample, nil
+}
+
+// parseLabels разбирает пары label="value" до закрывающей скобки
+// и возвращает остаток строки после неё.
+func parseLabels(s string, labels model.Labels) (string, error) {
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if strings.HasPrefix(s, "}") {
+			return s[1:], nil
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return "", errors.New("expected label=\"value\"")
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " \t")
+		if !strings.HasPrefix(s, `"`) {
+			return "", fmt.Errorf("label %s: value must be quoted", name)
+		}
+
+		var value strings.Builder
+		i := 1
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] != '\\' || i+1 == len(s) {
+				value.WriteByte(s[i])
+				continue
+			}
+			i++
+			switch s[i] {
+			case 'n':
+				value.WriteByte('\n')
+			default:
+				value.WriteByte(s[i])
+			}
+		}
+		if i == len(s) {
+			return "", fmt.Errorf("label %s: unterminated value", name)
+		}
+		labels[name] = value.String()
+
+		s = strings.TrimLeft(s[i+1:], " \t")
+		s = strings.TrimPrefix(s, ",")
+	}
+}
@@ -0,0 +1,60 @@
+package collector
+
+import (
+	"context"
+	"math/rand/v2"
+	"runtime"
+
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/model"
+)
+
+func init() {
+	Register("runtime", newRuntimeCollector)
+}
+
+// runtimeCollector снимает статистику памяти Go-рантайма агента, а также
+// RandomValue и счётчик опросов PollCount.
+type runtimeCollector struct {
+	ms runtime.MemStats
+}
+
+func newRuntimeCollector(_ *config.AgentConfig) (Collector, error) {
+	return &runtimeCollector{}, nil
+}
+
+func (c *runtimeCollector) Collect(_ context.Context) ([]model.Metrics, error) {
+	runtime.ReadMemStats(&c.ms)
+
+	return []model.Metrics{
+		Gauge("Alloc", float64(c.ms.Alloc), nil),
+		Gauge("BuckHashSys", float64(c.ms.BuckHashSys), nil),
+		Gauge("Frees", float64(c.ms.Frees), nil),
+		Gauge("GCCPUFraction", c.ms.GCCPUFraction, nil),
+		Gauge("GCSys", float64(c.ms.GCSys), nil),
+		Gauge("HeapAlloc", float64(c.ms.HeapAlloc), nil),
+		Gauge("HeapIdle", float64(c.ms.HeapIdle), nil),
+		Gauge("HeapInuse", float64(c.ms.HeapInuse), nil),
+		Gauge("HeapObjects", float64(c.ms.HeapObjects), nil),
+		Gauge("HeapReleased", float64(c.ms.HeapReleased), nil),
+		Gauge("HeapSys", float64(c.ms.HeapSys), nil),
+		Gauge("LastGC", float64(c.ms.LastGC), nil),
+		Gauge("Lookups", float64(c.ms.Lookups), nil),
+		Gauge("MCacheInuse", float64(c.ms.MCacheInuse), nil),
+		Gauge("MCacheSys", float64(c.ms.MCacheSys), nil),
+		Gauge("MSpanInuse", float64(c.ms.MSpanInuse), nil),
+		Gauge("MSpanSys", float64(c.ms.MSpanSys), nil),
+		Gauge("Mallocs", float64(c.ms.Mallocs), nil),
+		Gauge("NextGC", float64(c.ms.NextGC), nil),
+		Gauge("NumForcedGC", float64(c.ms.NumForcedGC), nil),
+		Gauge("NumGC", float64(c.ms.NumGC), nil),
+		Gauge("OtherSys", float64(c.ms.OtherSys), nil),
+		Gauge("PauseTotalNs", float64(c.ms.PauseTotalNs), nil),
+		Gauge("StackInuse", float64(c.ms.StackInuse), nil),
+		Gauge("StackSys", float64(c.ms.StackSys), nil),
+		Gauge("Sys", float64(c.ms.Sys), nil),
+		Gauge("TotalAlloc", float64(c.ms.TotalAlloc), nil),
+		Gauge("RandomValue", rand.Float64(), nil),
+		Counter("PollCount", 1, nil),
+	}, nil
+}
@@ -0,0 +1,17 @@
+package collector
+
+import "syscall"
+
+func statfs(path string) (fsUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return fsUsage{}, err
+	}
+
+	bsize := uint64(st.Bsize)
+	return fsUsage{
+		total: st.Blocks * bsize,
+		free:  st.Bfree * bsize,
+		avail: st.Bavail * bsize,
+	}, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package collector
+
+import "errors"
+
+func statfs(string) (fsUsage, error) {
+	return fsUsage{}, errors.ErrUnsupported
+}
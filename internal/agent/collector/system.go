@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/model"
+)
+
+func init() {
+	Register("system", newSystemCollector)
+}
+
+// systemCollector снимает общесистемные показатели ядра: среднюю загрузку,
+// число открытых файлов и переключения контекста.
+type systemCollector struct {
+	proc procFS
+	ctxt *cumulative
+}
+
+func newSystemCollector(cfg *config.AgentConfig) (Collector, error) {
+	return &systemCollector{proc: procFS(cfg.ProcRoot), ctxt: newCumulative()}, nil
+}
+
+func (c *systemCollector) Collect(_ context.Context) ([]model.Metrics, error) {
+	var metrics []model.Metrics
+	for _, collect := range []func() ([]model.Metrics, error){c.load, c.files, c.switches} {
+		m, err := collect()
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m...)
+	}
+
+	return metrics, nil
+}
+
+// load разбирает /proc/loadavg: "0.52 0.58 0.59 2/345 12345".
+func (c *systemCollector) load() ([]model.Metrics, error) {
+	lines, err := c.proc.lines("loadavg")
+	if err != nil {
+		return nil, fmt.Errorf("cannot read loadavg: %w", err)
+	}
+	if len(lines) == 0 || len(lines[0]) < 4 {
+		return nil, errors.New("bad loadavg")
+	}
+	f := lines[0]
+
+	metrics := make([]model.Metrics, 0, 5)
+	for i, name := range []string{"LoadAverage1", "LoadAverage5", "LoadAverage15"} {
+		v, err := strconv.ParseFloat(f[i], 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad loadavg: %w", err)
+		}
+		metrics = append(metrics, Gauge(name, v, nil))
+	}
+
+	running, total, ok := strings.Cut(f[3], "/")
+	if !ok {
+		return nil, fmt.Errorf("bad loadavg tasks %q", f[3])
+	}
+	for _, s := range []struct{ name, value string }{{"ProcsRunning", running}, {"ProcsTotal", total}} {
+		v, err := parseUint(s.value)
+		if err != nil {
+			return nil, fmt.Errorf("bad loadavg: %w", err)
+		}
+		metrics = append(metrics, Gauge(s.name, float64(v), nil))
+	}
+
+	return metrics, nil
+}
+
+// files разбирает /proc/sys/fs/file-nr: выделено дескрипторов, из них свободно, предел.
+func (c *systemCollector) files() ([]model.Metrics, error) {
+	lines, err := c.proc.lines("sys", "fs", "file-nr")
+	if err != nil {
+		return nil, fmt.Errorf("cannot read file-nr: %w", err)
+	}
+	if len(lines) == 0 || len(lines[0]) < 3 {
+		return nil, errors.New("bad file-nr")
+	}
+
+	var v [3]uint64
+	for i := range v {
+		if v[i], err = parseUint(lines[0][i]); err != nil {
+			return nil, fmt.Errorf("bad file-nr: %w", err)
+		}
+	}
+
+	return []model.Metrics{
+		Gauge("OpenFiles", float64(v[0]-v[1]), nil),
+		Gauge("MaxFiles", float64(v[2]), nil),
+	}, nil
+}
+
+// switches снимает приращение переключений контекста из строки ctxt в /proc/stat.
+func (c *systemCollector) switches() (_ []model.Metrics, err error) {
+	lines, err := c.proc.lines("stat")
+	if err != nil {
+		return nil, fmt.Errorf("cannot read stat: %w", err)
+	}
+	defer func() { c.ctxt.finish(err) }()
+
+	for _, f := range lines {
+		if f[0] != "ctxt" || len(f) < 2 {
+			continue
+		}
+		v, err := parseUint(f[1])
+		if err != nil {
+			return nil, fmt.Errorf("bad ctxt in stat: %w", err)
+		}
+		if delta, ok := c.ctxt.delta("ctxt", v); ok {
+			return []model.Metrics{Counter("ContextSwitches", delta, nil)}, nil
+		}
+		return nil, nil
+	}
+
+	return nil, errors.New("no ctxt in stat")
+}
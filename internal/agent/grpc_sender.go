@@ -0,0 +1,188 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/7StaSH7/gometrics/api/metricspb"
+	"github.com/7StaSH7/gometrics/internal/auth"
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/config/tlsconfig"
+	"github.com/7StaSH7/gometrics/internal/logger"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/replay"
+	"github.com/7StaSH7/gometrics/internal/utils"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const grpcRetries = 3
+
+type grpcSender struct {
+	ctx    context.Context
+	conn   *grpc.ClientConn
+	client metricspb.MetricsClient
+	key    string
+}
+
+func newGRPCSender(ctx context.Context, cfg *config.AgentConfig) (*grpcSender, error) {
+	// gRPC не шифрует тела ключом -crypto-key, поэтому данные защищает только TLS
+	if cfg.CryptoKey != "" && !cfg.TLS {
+		return nil, errors.New("grpc transport does not encrypt payloads with crypto key, enable tls")
+	}
+
+	creds := insecure.NewCredentials()
+	if cfg.TLS {
+		tlsCfg, err := tlsconfig.Client(serverHost(cfg.Address), cfg.TLSCA, cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsCfg)
+	}
+
+	conn, err := grpc.NewClient(cfg.Address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+
+	if ip := outboundIP(cfg.Address); ip != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(utils.RealIPHeader), ip)
+	}
+	if cfg.AgentID != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(auth.AgentHeader), cfg.AgentID)
+	}
+
+	return &grpcSender{
+		ctx:    ctx,
+		conn:   conn,
+		client: metricspb.NewMetricsClient(conn),
+		key:    cfg.Key,
+	}, nil
+}
+
+func (s *grpcSender) sendOne(m model.Metrics) error {
+	req, err := s.request(m)
+	if err != nil {
+		return err
+	}
+
+	return rejected(s.retry(func() error {
+		ctx, err := s.signCall(s.ctx, req.GetMetric().GetHash())
+		if err != nil {
+			return err
+		}
+		_, err = s.client.Update(ctx, req)
+		return err
+	}))
+}
+
+// sendBatch передаёт batchID в метаданных x-batch-id: сервер применяет поток
+// целиком и не применит повтор после потерянного ответа второй раз.
+func (s *grpcSender) sendBatch(batchID string, metrics []model.Metrics) error {
+	reqs := make([]*metricspb.UpdateRequest, 0, len(metrics))
+	for _, m := range metrics {
+		req, err := s.request(m)
+		if err != nil {
+			return err
+		}
+		reqs = append(reqs, req)
+	}
+
+	ctx := s.ctx
+	if batchID != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(model.BatchIDHeader), batchID)
+	}
+
+	return rejected(s.retry(func() error {
+		ctx, err := s.signCall(ctx, batchID)
+		if err != nil {
+			return err
+		}
+		stream, err := s.client.UpdateBatch(ctx)
+		if err != nil {
+			return err
+		}
+		for _, req := range reqs {
+			if err := stream.Send(req); err != nil {
+				// настоящая причина придёт из CloseAndRecv
+				break
+			}
+		}
+		_, err = stream.CloseAndRecv()
+		return err
+	}))
+}
+
+func (s *grpcSender) request(m model.Metrics) (*metricspb.UpdateRequest, error) {
+	pb := metricspb.FromModel(m)
+	if s.key != "" {
+		hash, err := metricspb.Sign(pb, s.key)
+		if err != nil {
+			return nil, err
+		}
+		pb.Hash = hash
+	}
+
+	return &metricspb.UpdateRequest{Metric: pb}, nil
+}
+
+// signCall подписывает вызов ключом агента с новыми временем и nonce и передаёт
+// их в метаданных, как заголовки HTTP. body — подпись метрики для Update
+// и идентификатор пачки для UpdateBatch. Вызывается перед каждой попыткой.
+func (s *grpcSender) signCall(ctx context.Context, body string) (context.Context, error) {
+	if s.key == "" {
+		return ctx, nil
+	}
+
+	h := make(http.Header)
+	if err := replay.Sign(h, body, s.key); err != nil {
+		return nil, err
+	}
+	for name := range h {
+		ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(name), h.Get(name))
+	}
+
+	return ctx, nil
+}
+
+// retry повторяет вызов с теми же паузами, что и HTTP-клиент, пока сервер недоступен.
+func (s *grpcSender) retry(call func() error) error {
+	err := call()
+	for attempt := 1; attempt <= grpcRetries && status.Code(err) == codes.Unavailable; attempt++ {
+		delay := retryDelay(attempt)
+		logger.Log.Info("retrying", zap.Duration("delay", delay))
+
+		select {
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		case <-time.After(delay):
+		}
+		err = call()
+	}
+
+	return err
+}
+
+// rejected помечает ошибки проверки метрик, которые не исправятся повтором
+// той же пачки. Отказы в подписи и правах, как и в HTTP, пачку не выбрасывают.
+func rejected(err error) error {
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.NotFound:
+		return fmt.Errorf("%w: %v", errRejected, err)
+	}
+
+	return err
+}
+
+func (s *grpcSender) close() error {
+	return s.conn.Close()
+}
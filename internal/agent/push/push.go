@@ -0,0 +1,152 @@
+// Package push — локальный приём метрик от приложений хоста. Агент принимает
+// тот же JSON, что и /update/ и /updates/ сервера, без подписи, и отправляет
+// принятое вместе со своими метриками, подписывая своим ключом. Каждая
+// histogram приложения уходит на сервер отдельной пачкой: если её корзины
+// не совпадут с хранимыми, сервер отвергнет только её.
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/logger"
+	"github.com/7StaSH7/gometrics/internal/middleware"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// maxBody ограничивает распакованное тело одного запроса.
+const maxBody = 4 << 20
+
+// Server — HTTP-сервер приёма. Принятые метрики передаются в merge:
+// агент прибавляет их к накопленным до следующей отправки.
+type Server struct {
+	srv   *http.Server
+	ln    net.Listener
+	merge func([]model.Metrics)
+}
+
+// Listen открывает addr. Приём не требует подписи, поэтому адрес
+// не на loopback открывает агент всем, кто может до него достучаться.
+func Listen(addr string, merge func([]model.Metrics)) (*Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen push api: %w", err)
+	}
+	if tcp, ok := ln.Addr().(*net.TCPAddr); ok && !tcp.IP.IsLoopback() {
+		logger.Log.Warn("push api accepts unsigned metrics and is not bound to loopback", zap.String("addr", addr))
+	}
+
+	s := &Server{ln: ln, merge: merge}
+	s.srv = &http.Server{Handler: s.router(), ReadHeaderTimeout: 10 * time.Second}
+
+	return s, nil
+}
+
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Serve принимает запросы, пока не отменён ctx.
+func (s *Server) Serve(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := s.srv.Serve(s.ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Server) router() *gin.Engine {
+	router := gin.New()
+	router.Use(middleware.GzipMiddleware)
+	router.Use(gin.Recovery())
+	router.Use(func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBody)
+	})
+
+	router.POST("/update/", s.UpdateJSON)
+	router.POST("/updates/", s.Updates)
+
+	return router
+}
+
+// UpdateJSON принимает одну метрику и возвращает её же: итоговое значение
+// известно только серверу.
+func (s *Server) UpdateJSON(c *gin.Context) {
+	var m model.Metrics
+	if err := c.ShouldBindJSON(&m); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if status, err := validate(&m); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.merge([]model.Metrics{m})
+	c.JSON(http.StatusOK, m)
+}
+
+// Updates принимает пачку целиком или, если в ней есть неверная метрика, не принимает ничего.
+func (s *Server) Updates(c *gin.Context) {
+	metrics := make([]model.Metrics, 0)
+	if err := c.ShouldBindJSON(&metrics); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range metrics {
+		if status, err := validate(&metrics[i]); err != nil {
+			c.JSON(status, gin.H{"error": fmt.Sprintf("metric %d: %s", i, err)})
+			return
+		}
+	}
+
+	s.merge(metrics)
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// validate проверяет метрику, как сервер, и сбрасывает поля, которые
+// приложение задавать не должно.
+func validate(m *model.Metrics) (int, error) {
+	if m.ID == "" {
+		return http.StatusNotFound, errors.New("bad id")
+	}
+
+	switch m.MType {
+	case model.Counter:
+		if m.Delta == nil {
+			return http.StatusBadRequest, errors.New("'Delta' is missing")
+		}
+	case model.Gauge:
+		if m.Value == nil {
+			return http.StatusBadRequest, errors.New("'Value' is missing")
+		}
+	case model.Histogram:
+		if err := model.ValidateHistogram(*m); err != nil {
+			return http.StatusBadRequest, err
+		}
+	case model.Summary:
+		if err := model.ValidateSummary(*m); err != nil {
+			return http.StatusBadRequest, err
+		}
+	default:
+		return http.StatusBadRequest, errors.New("bad type")
+	}
+
+	m.Hash, m.Tenant = "", ""
+	m.Labels = m.Labels.Normalize()
+
+	return http.StatusOK, nil
+}
@@ -0,0 +1,170 @@
+package push
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder запоминает метрики, которые сервер передал агенту.
+type recorder struct {
+	mu      sync.Mutex
+	metrics []model.Metrics
+}
+
+func (r *recorder) merge(metrics []model.Metrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.metrics = append(r.metrics, metrics...)
+}
+
+func TestPush(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		gzip       bool
+		wantStatus int
+		wantIDs    []string
+	}{
+		{
+			name:       "counter",
+			path:       "/update/",
+			body:       `{"id":"requests","type":"counter","delta":3,"labels":{"route":"/a"}}`,
+			wantStatus: http.StatusOK,
+			wantIDs:    []string{"requests"},
+		},
+		{
+			name:       "gzipped batch",
+			path:       "/updates/",
+			body:       `[{"id":"temp","type":"gauge","value":21.5},{"id":"latency","type":"histogram","count":2,"sum":0.3,"buckets":[{"le":0.1,"count":1}]}]`,
+			gzip:       true,
+			wantStatus: http.StatusOK,
+			wantIDs:    []string{"temp", "latency"},
+		},
+		{
+			name:       "counter without delta",
+			path:       "/update/",
+			body:       `{"id":"requests","type":"counter"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "no id",
+			path:       "/update/",
+			body:       `{"type":"gauge","value":1}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "summary",
+			path:       "/update/",
+			body:       `{"id":"rpc","type":"summary","count":1,"sum":1,"quantiles":[{"quantile":0.5,"value":1}]}`,
+			wantStatus: http.StatusOK,
+			wantIDs:    []string{"rpc"},
+		},
+		{
+			name:       "summary with bad quantile",
+			path:       "/update/",
+			body:       `{"id":"rpc","type":"summary","count":1,"sum":1,"quantiles":[{"quantile":2,"value":1}]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown type",
+			path:       "/update/",
+			body:       `{"id":"rpc","type":"meter","value":1}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "batch with a bad metric is rejected whole",
+			path:       "/updates/",
+			body:       `[{"id":"temp","type":"gauge","value":1},{"id":"latency","type":"histogram","count":1,"sum":1,"buckets":[{"le":1,"count":5}]}]`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "bad json",
+			path:       "/updates/",
+			body:       `{"id":`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recorder{}
+			s := &Server{merge: rec.merge}
+
+			body := []byte(tt.body)
+			if tt.gzip {
+				var buf bytes.Buffer
+				zw := gzip.NewWriter(&buf)
+				_, err := zw.Write(body)
+				require.NoError(t, err)
+				require.NoError(t, zw.Close())
+				body = buf.Bytes()
+			}
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.gzip {
+				req.Header.Set("Content-Encoding", "gzip")
+			}
+			w := httptest.NewRecorder()
+			s.router().ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+			ids := make([]string, 0)
+			for _, m := range rec.metrics {
+				ids = append(ids, m.ID)
+			}
+			assert.ElementsMatch(t, tt.wantIDs, ids)
+		})
+	}
+}
+
+func TestPushIgnoresServerFields(t *testing.T) {
+	rec := &recorder{}
+	s := &Server{merge: rec.merge}
+
+	req := httptest.NewRequest(http.MethodPost, "/update/",
+		strings.NewReader(`{"id":"temp","type":"gauge","value":1,"hash":"abc","tenant":"other"}`))
+	w := httptest.NewRecorder()
+	s.router().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	require.Len(t, rec.metrics, 1)
+	assert.Empty(t, rec.metrics[0].Hash)
+	assert.Empty(t, rec.metrics[0].Tenant)
+}
+
+func TestServe(t *testing.T) {
+	rec := &recorder{}
+	s, err := Listen("127.0.0.1:0", rec.merge)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Serve(ctx)
+	}()
+
+	body, err := json.Marshal([]model.Metrics{{ID: "requests", MType: model.Counter, Delta: new(int64)}})
+	require.NoError(t, err)
+	resp, err := http.Post("http://"+s.Addr().String()+"/updates/", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	cancel()
+	require.NoError(t, <-done)
+	assert.Len(t, rec.metrics, 1)
+}
@@ -0,0 +1,230 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/auth"
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/config/tlsconfig"
+	"github.com/7StaSH7/gometrics/internal/encryption"
+	"github.com/7StaSH7/gometrics/internal/logger"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/replay"
+	"github.com/7StaSH7/gometrics/internal/utils"
+	"go.uber.org/zap"
+	"resty.dev/v3"
+)
+
+const (
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
+)
+
+// errRejected — сервер отверг сами метрики (400 или 404): повторять их бессмысленно.
+// Отказы в подписи и ограничение нагрузки errRejected не оборачивают: пачка сохраняется.
+var errRejected = errors.New("rejected by server")
+
+// sender доставляет метрики на сервер по выбранному в конфиге протоколу.
+// Ошибки, при которых повтор не поможет, оборачивают errRejected.
+type sender interface {
+	sendOne(m model.Metrics) error
+	// sendBatch отправляет пачку под идентификатором batchID, одинаковым для всех её попыток.
+	sendBatch(batchID string, metrics []model.Metrics) error
+	close() error
+}
+
+// retryDelay — пауза перед повторной попыткой отправки с номером attempt.
+func retryDelay(attempt int) time.Duration {
+	switch attempt {
+	case 1:
+		return 1 * time.Second
+	case 2:
+		return 3 * time.Second
+	default:
+		return 5 * time.Second
+	}
+}
+
+// outboundIP возвращает адрес интерфейса, через который агент ходит на сервер.
+// UDP-сокет ничего не отправляет, а только выбирает маршрут.
+func outboundIP(address string) string {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		logger.Log.Warn("cannot detect outbound address, sending without X-Real-IP", zap.Error(err))
+		return ""
+	}
+	defer conn.Close()
+
+	addr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return ""
+	}
+
+	return addr.IP.String()
+}
+
+// serverHost возвращает имя сервера из адреса host:port для проверки его сертификата.
+func serverHost(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+
+	return host
+}
+
+type httpSender struct {
+	client    *resty.Client
+	baseURL   string
+	key       string
+	publicKey *rsa.PublicKey
+}
+
+func newHTTPSender(ctx context.Context, cfg *config.AgentConfig) (*httpSender, error) {
+	var publicKey *rsa.PublicKey
+	if cfg.CryptoKey != "" {
+		var err error
+		if publicKey, err = encryption.LoadPublicKey(cfg.CryptoKey); err != nil {
+			return nil, err
+		}
+	}
+
+	client := resty.New().
+		AddRetryConditions(
+			func(res *resty.Response, err error) bool {
+				if res == nil {
+					return true
+				}
+				if err != nil {
+					return true
+				}
+				return false
+			},
+		).
+		SetContext(ctx).
+		SetRetryStrategy(
+			func(resp *resty.Response, _ error) (time.Duration, error) {
+				select {
+				case <-ctx.Done():
+					return 0, ctx.Err()
+				default:
+				}
+				delay := retryDelay(resp.Request.Attempt)
+				logger.Log.Info("retrying", zap.Duration("delay", delay))
+				return delay, nil
+			}).
+		SetAllowNonIdempotentRetry(true).
+		SetRetryCount(3).
+		SetRetryWaitTime(1 * time.Second).
+		SetRetryMaxWaitTime(5 * time.Second)
+
+	if ip := outboundIP(cfg.Address); ip != "" {
+		client.SetHeader(utils.RealIPHeader, ip)
+	}
+	if cfg.AgentID != "" {
+		client.SetHeader(auth.AgentHeader, cfg.AgentID)
+	}
+
+	scheme := "http"
+	if cfg.TLS {
+		tlsCfg, err := tlsconfig.Client(serverHost(cfg.Address), cfg.TLSCA, cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		client.SetTLSClientConfig(tlsCfg)
+		scheme = "https"
+	}
+
+	return &httpSender{
+		client:    client,
+		baseURL:   fmt.Sprintf("%s://%s", scheme, cfg.Address),
+		key:       cfg.Key,
+		publicKey: publicKey,
+	}, nil
+}
+
+func (s *httpSender) sendOne(m model.Metrics) error {
+	return s.post("/update/", m, "")
+}
+
+// sendBatch помечает пачку идентификатором: если ответ на применённую пачку
+// потерялся, ретрай уйдёт с тем же идентификатором и сервер не применит её дважды.
+func (s *httpSender) sendBatch(batchID string, metrics []model.Metrics) error {
+	return s.post("/updates/", metrics, batchID)
+}
+
+func (s *httpSender) post(path string, body any, batchID string) error {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	logger.Log.Info("send request with body", zap.String("body", string(jsonData)))
+
+	req := s.client.NewRequest().
+		SetBody(jsonData).
+		SetHeader("Content-Type", "application/json").
+		SetHeader("Accept-Encoding", "gzip")
+	if batchID != "" {
+		req.SetHeader(model.BatchIDHeader, batchID)
+	}
+
+	// подпись считается по открытому тексту: сервер проверяет её после расшифровки.
+	// Каждая попытка подписывается заново с новым nonce, а повтор уже применённой
+	// пачки сервер узнаёт по batchID
+	if s.key != "" {
+		if err := replay.Sign(req.Header, string(jsonData), s.key); err != nil {
+			return err
+		}
+		req.AddRetryHooks(func(*resty.Response, error) {
+			if err := replay.Sign(req.Header, string(jsonData), s.key); err != nil {
+				logger.Log.Warn("cannot sign retry, resending previous signature", zap.Error(err))
+			}
+		})
+	}
+
+	if s.publicKey != nil {
+		encrypted, err := encryption.Encrypt(s.publicKey, jsonData)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt body: %w", err)
+		}
+		req.SetBody(encrypted).SetHeader(encryption.Header, encryption.Scheme)
+	}
+
+	res, err := req.Post(s.baseURL + path)
+	if err != nil {
+		return err
+	}
+	switch {
+	case res.StatusCode() == http.StatusBadRequest, res.StatusCode() == http.StatusNotFound:
+		return fmt.Errorf("%w: %s", errRejected, res.Status())
+	case res.StatusCode() >= http.StatusInternalServerError:
+		return fmt.Errorf("server error: %s", res.Status())
+	case res.StatusCode() >= http.StatusBadRequest:
+		// отказ в подписи, правах или по нагрузке проходит после смены ключа или паузы
+		return fmt.Errorf("request failed: %s", res.Status())
+	}
+
+	return nil
+}
+
+func newBatchID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("cannot generate batch id: %w", err)
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+func (s *httpSender) close() error {
+	return s.client.Close()
+}
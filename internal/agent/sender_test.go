@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/replay"
+	"github.com/7StaSH7/gometrics/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSendBatchResignsRetries(t *testing.T) {
+	const key = "secret"
+
+	var (
+		mu      sync.Mutex
+		nonces  []string
+		batches []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.True(t, utils.VerifySHA256(utils.GenerateSHA256(replay.HeaderPayload(r.Header, string(body)), key), r.Header.Get("HashSHA256")))
+
+		mu.Lock()
+		defer mu.Unlock()
+		nonces = append(nonces, r.Header.Get(replay.NonceHeader))
+		batches = append(batches, r.Header.Get(model.BatchIDHeader))
+		if len(nonces) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	s, err := newHTTPSender(context.Background(), &config.AgentConfig{Address: strings.TrimPrefix(srv.URL, "http://"), Key: key})
+	require.NoError(t, err)
+
+	delta := int64(1)
+	require.NoError(t, s.sendBatch("b1", []model.Metrics{{ID: "PollCount", MType: model.Counter, Delta: &delta}}))
+
+	// повтор подписан заново, а пачка осталась той же
+	require.Len(t, nonces, 2)
+	assert.NotEqual(t, nonces[0], nonces[1])
+	assert.Equal(t, []string{"b1", "b1"}, batches)
+}
+
+func TestPostRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		rejected bool
+	}{
+		{name: "bad request", status: http.StatusBadRequest, rejected: true},
+		{name: "not found", status: http.StatusNotFound, rejected: true},
+		{name: "unauthorized", status: http.StatusUnauthorized},
+		{name: "forbidden", status: http.StatusForbidden},
+		{name: "timeout", status: http.StatusRequestTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			s, err := newHTTPSender(context.Background(), &config.AgentConfig{Address: strings.TrimPrefix(srv.URL, "http://")})
+			require.NoError(t, err)
+
+			delta := int64(1)
+			err = s.sendBatch("b1", []model.Metrics{{ID: "PollCount", MType: model.Counter, Delta: &delta}})
+			require.Error(t, err)
+			// выброшена будет только пачка с ошибкой в самих метриках
+			assert.Equal(t, tt.rejected, errors.Is(err, errRejected))
+		})
+	}
+}
+
+func TestGRPCRejected(t *testing.T) {
+	tests := []struct {
+		code     codes.Code
+		rejected bool
+	}{
+		{code: codes.InvalidArgument, rejected: true},
+		{code: codes.NotFound, rejected: true},
+		{code: codes.Unauthenticated},
+		{code: codes.PermissionDenied},
+		{code: codes.ResourceExhausted},
+		{code: codes.Unavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			assert.Equal(t, tt.rejected, errors.Is(rejected(status.Error(tt.code, "failed")), errRejected))
+		})
+	}
+}
@@ -0,0 +1,290 @@
+// Package spool — очередь неотправленных пачек агента на диске.
+// Каждая пачка лежит в отдельном файле с порядковым номером в имени,
+// поэтому очередь переживает перезапуск агента и отправляется в исходном порядке.
+package spool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/logger"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"go.uber.org/zap"
+)
+
+const (
+	// DropOldest освобождает место под новую пачку, выбрасывая самые старые.
+	DropOldest = "oldest"
+	// DropNewest сохраняет очередь как есть и выбрасывает новую пачку.
+	DropNewest = "newest"
+
+	ext = ".json"
+)
+
+var (
+	ErrFull     = errors.New("spool is full")
+	ErrTooLarge = errors.New("batch is larger than spool")
+)
+
+type Options struct {
+	Dir string
+	// MaxSize — предел суммарного размера файлов очереди в байтах.
+	MaxSize int64
+	// MaxAge — пачки старше выбрасываются, не дожидаясь отправки. 0 — без ограничения.
+	MaxAge time.Duration
+	// Drop — что выбрасывать, когда очередь заполнена: DropOldest или DropNewest.
+	Drop string
+}
+
+// Batch — пачка метрик с идентификатором, под которым её примет сервер.
+// Идентификатор сохраняется между попытками, поэтому повторная отправка
+// пачки, которую сервер уже применил, не удвоит счётчики.
+type Batch struct {
+	ID      string          `json:"id"`
+	Metrics []model.Metrics `json:"metrics"`
+}
+
+type entry struct {
+	seq     uint64
+	size    int64
+	created time.Time
+}
+
+type Queue struct {
+	opts Options
+	now  func() time.Time
+
+	// drainMu не даёт двум отправкам идти параллельно и нарушить порядок
+	drainMu sync.Mutex
+
+	mu      sync.Mutex
+	entries []entry
+	size    int64
+	next    uint64
+}
+
+// Open открывает очередь в opts.Dir, создавая каталог при необходимости.
+// Недописанные файлы, оставшиеся от упавшего агента, удаляются.
+func Open(opts Options) (*Queue, error) {
+	if opts.Drop != DropOldest && opts.Drop != DropNewest {
+		return nil, fmt.Errorf("unknown drop policy %q, want %q or %q", opts.Drop, DropOldest, DropNewest)
+	}
+	if opts.MaxSize <= 0 {
+		return nil, fmt.Errorf("spool max size must be positive, got %d", opts.MaxSize)
+	}
+	if err := os.MkdirAll(opts.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("cannot create spool dir: %w", err)
+	}
+
+	files, err := os.ReadDir(opts.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read spool dir: %w", err)
+	}
+
+	q := &Queue{opts: opts, now: time.Now}
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ext+".tmp") {
+			os.Remove(filepath.Join(opts.Dir, f.Name()))
+			continue
+		}
+
+		seq, ok := parseName(f.Name())
+		if !ok || f.IsDir() {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			return nil, err
+		}
+		q.entries = append(q.entries, entry{seq: seq, size: info.Size(), created: info.ModTime()})
+		q.size += info.Size()
+	}
+	sort.Slice(q.entries, func(i, j int) bool { return q.entries[i].seq < q.entries[j].seq })
+	if n := len(q.entries); n > 0 {
+		q.next = q.entries[n-1].seq + 1
+	}
+
+	if len(q.entries) > 0 {
+		logger.Log.Info("spool restored", zap.Int("batches", len(q.entries)), zap.Int64("bytes", q.size))
+	}
+
+	return q, nil
+}
+
+// Len возвращает число пачек в очереди.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.entries)
+}
+
+// Push кладёт пачку в конец очереди. Файл пишется целиком во временный
+// и переименовывается, поэтому при падении агента в очереди не бывает обрывков.
+func (q *Queue) Push(b Batch) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	size := int64(len(data))
+	if size > q.opts.MaxSize {
+		return fmt.Errorf("%w: %d bytes", ErrTooLarge, size)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.expire()
+	for q.size+size > q.opts.MaxSize {
+		if q.opts.Drop == DropNewest {
+			return ErrFull
+		}
+		logger.Log.Warn("spool is full, dropping oldest batch")
+		q.remove(q.entries[0].seq)
+	}
+
+	seq := q.next
+	path := q.path(seq)
+	tmp := path + ".tmp"
+	if err := writeFile(tmp, data); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("cannot write spool file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("cannot write spool file: %w", err)
+	}
+
+	q.next++
+	q.entries = append(q.entries, entry{seq: seq, size: size, created: q.now()})
+	q.size += size
+
+	return nil
+}
+
+// Drain отправляет пачки по порядку и удаляет отправленные. На первой ошибке
+// отправки останавливается и возвращает её: пачка остаётся в начале очереди.
+// Если очередь уже отправляется другим вызовом, Drain сразу возвращает nil.
+func (q *Queue) Drain(send func(Batch) error) error {
+	if !q.drainMu.TryLock() {
+		return nil
+	}
+	defer q.drainMu.Unlock()
+
+	for {
+		seq, ok := q.head()
+		if !ok {
+			return nil
+		}
+
+		b, err := q.read(seq)
+		if err != nil {
+			logger.Log.Error("dropping unreadable spool file", zap.String("file", q.path(seq)), zap.Error(err))
+			q.drop(seq)
+			continue
+		}
+
+		if err := send(b); err != nil {
+			return err
+		}
+		q.drop(seq)
+	}
+}
+
+func (q *Queue) head() (uint64, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.expire()
+	if len(q.entries) == 0 {
+		return 0, false
+	}
+
+	return q.entries[0].seq, true
+}
+
+func (q *Queue) drop(seq uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.remove(seq)
+}
+
+// expire выбрасывает пачки старше MaxAge. Вызывается под q.mu.
+func (q *Queue) expire() {
+	if q.opts.MaxAge <= 0 {
+		return
+	}
+
+	cutoff := q.now().Add(-q.opts.MaxAge)
+	for len(q.entries) > 0 && q.entries[0].created.Before(cutoff) {
+		logger.Log.Warn("dropping expired spool batch", zap.Time("created", q.entries[0].created))
+		q.remove(q.entries[0].seq)
+	}
+}
+
+// remove удаляет пачку из индекса и с диска. Пачку, которую уже вытеснил
+// Push, пока она отправлялась, повторно удалять не нужно. Вызывается под q.mu.
+func (q *Queue) remove(seq uint64) {
+	for i, e := range q.entries {
+		if e.seq != seq {
+			continue
+		}
+		if err := os.Remove(q.path(seq)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Log.Error("cannot remove spool file", zap.Error(err))
+		}
+		q.size -= e.size
+		q.entries = append(q.entries[:i], q.entries[i+1:]...)
+		return
+	}
+}
+
+func (q *Queue) read(seq uint64) (Batch, error) {
+	var b Batch
+
+	data, err := os.ReadFile(q.path(seq))
+	if err != nil {
+		return b, err
+	}
+	err = json.Unmarshal(data, &b)
+
+	return b, err
+}
+
+func (q *Queue) path(seq uint64) string {
+	return filepath.Join(q.opts.Dir, fmt.Sprintf("%020d%s", seq, ext))
+}
+
+func parseName(name string) (uint64, bool) {
+	if !strings.HasSuffix(name, ext) {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(strings.TrimSuffix(name, ext), 10, 64)
+
+	return seq, err == nil
+}
+
+func writeFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
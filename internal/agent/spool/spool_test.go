@@ -0,0 +1,124 @@
+package spool
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func batch(id string) Batch {
+	delta := int64(1)
+	return Batch{ID: id, Metrics: []model.Metrics{{ID: "PollCount", MType: model.Counter, Delta: &delta}}}
+}
+
+// batchSize — размер одной тестовой пачки на диске.
+func batchSize(t *testing.T) int64 {
+	q, err := Open(Options{Dir: t.TempDir(), MaxSize: 1 << 20, Drop: DropOldest})
+	require.NoError(t, err)
+	require.NoError(t, q.Push(batch("a")))
+
+	return q.size
+}
+
+func drain(t *testing.T, q *Queue) []string {
+	var ids []string
+	require.NoError(t, q.Drain(func(b Batch) error {
+		ids = append(ids, b.ID)
+		return nil
+	}))
+
+	return ids
+}
+
+func TestDrainInOrderAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(Options{Dir: dir, MaxSize: 1 << 20, Drop: DropOldest})
+	require.NoError(t, err)
+
+	for _, id := range []string{"a", "b", "c"} {
+		require.NoError(t, q.Push(batch(id)))
+	}
+
+	// сервер недоступен: первая пачка остаётся в очереди
+	down := errors.New("connection refused")
+	assert.ErrorIs(t, q.Drain(func(Batch) error { return down }), down)
+	assert.Equal(t, 3, q.Len())
+
+	// недописанный файл от упавшего агента
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "00000000000000000009.json.tmp"), []byte("{"), 0600))
+
+	restored, err := Open(Options{Dir: dir, MaxSize: 1 << 20, Drop: DropOldest})
+	require.NoError(t, err)
+	require.NoError(t, restored.Push(batch("d")))
+	assert.Equal(t, []string{"a", "b", "c", "d"}, drain(t, restored))
+	assert.Equal(t, 0, restored.Len())
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestDropPolicy(t *testing.T) {
+	size := batchSize(t)
+
+	tests := []struct {
+		name     string
+		drop     string
+		wantErr  error
+		expected []string
+	}{
+		{name: "drop oldest", drop: DropOldest, expected: []string{"b", "c"}},
+		{name: "drop newest", drop: DropNewest, wantErr: ErrFull, expected: []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Open(Options{Dir: t.TempDir(), MaxSize: 2 * size, Drop: tt.drop})
+			require.NoError(t, err)
+
+			require.NoError(t, q.Push(batch("a")))
+			require.NoError(t, q.Push(batch("b")))
+			err = q.Push(batch("c"))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.expected, drain(t, q))
+		})
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	q, err := Open(Options{Dir: t.TempDir(), MaxSize: 1 << 20, MaxAge: time.Hour, Drop: DropOldest})
+	require.NoError(t, err)
+
+	now := time.Now()
+	q.now = func() time.Time { return now }
+	require.NoError(t, q.Push(batch("old")))
+
+	now = now.Add(30 * time.Minute)
+	require.NoError(t, q.Push(batch("new")))
+
+	now = now.Add(45 * time.Minute)
+	assert.Equal(t, []string{"new"}, drain(t, q))
+}
+
+func TestOpenInvalid(t *testing.T) {
+	_, err := Open(Options{Dir: t.TempDir(), MaxSize: 1 << 20, Drop: "random"})
+	assert.Error(t, err)
+
+	_, err = Open(Options{Dir: t.TempDir(), Drop: DropOldest})
+	assert.Error(t, err)
+
+	q, err := Open(Options{Dir: t.TempDir(), MaxSize: 10, Drop: DropOldest})
+	require.NoError(t, err)
+	assert.ErrorIs(t, q.Push(batch("a")), ErrTooLarge)
+}
@@ -0,0 +1,172 @@
+package statsd
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/7StaSH7/gometrics/internal/agent/collector"
+	"github.com/7StaSH7/gometrics/internal/model"
+)
+
+// epsilon — погрешность, с которой сумма counter считается целой.
+const epsilon = 1e-9
+
+type series struct {
+	name   string
+	labels model.Labels
+}
+
+type counterAgg struct {
+	series
+	sum   float64
+	dirty bool
+}
+
+type gaugeAgg struct {
+	series
+	value float64
+	dirty bool
+}
+
+type histogramAgg struct {
+	series
+	count  int64
+	sum    float64
+	counts []int64
+}
+
+type setAgg struct {
+	series
+	values map[string]struct{}
+}
+
+// Aggregator копит значения между вызовами Flush:
+//   - counter складывает приращения с поправкой на выборку, дробный остаток
+//     переходит в следующий интервал;
+//   - gauge хранит последнее значение и отдаёт его, только если оно менялось;
+//   - timer, histogram и distribution раскладываются по корзинам гистограммы;
+//   - set отдаётся gauge с числом уникальных значений за интервал.
+type Aggregator struct {
+	bounds []float64
+
+	mu         sync.Mutex
+	counters   map[string]*counterAgg
+	gauges     map[string]*gaugeAgg
+	histograms map[string]*histogramAgg
+	sets       map[string]*setAgg
+}
+
+// NewAggregator создаёт накопитель с границами корзин гистограмм bounds.
+func NewAggregator(bounds []float64) *Aggregator {
+	sorted := append([]float64(nil), bounds...)
+	sort.Float64s(sorted)
+
+	return &Aggregator{
+		bounds:     sorted,
+		counters:   make(map[string]*counterAgg),
+		gauges:     make(map[string]*gaugeAgg),
+		histograms: make(map[string]*histogramAgg),
+		sets:       make(map[string]*setAgg),
+	}
+}
+
+func (a *Aggregator) Add(s Sample) {
+	key := model.SeriesKey(s.Name, s.Tags)
+	ser := series{name: s.Name, labels: s.Tags}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch s.Type {
+	case TypeCounter:
+		c, ok := a.counters[key]
+		if !ok {
+			c = &counterAgg{series: ser}
+			a.counters[key] = c
+		}
+		c.sum += s.Value / s.Rate
+		c.dirty = true
+	case TypeGauge:
+		g, ok := a.gauges[key]
+		if !ok {
+			g = &gaugeAgg{series: ser}
+			a.gauges[key] = g
+		}
+		if s.Relative {
+			g.value += s.Value
+		} else {
+			g.value = s.Value
+		}
+		g.dirty = true
+	case TypeTimer, TypeHistogram, TypeDistribution:
+		h, ok := a.histograms[key]
+		if !ok {
+			h = &histogramAgg{series: ser, counts: make([]int64, len(a.bounds))}
+			a.histograms[key] = h
+		}
+		// значение с выборкой 0.1 стоит за десять наблюдений
+		weight := max(int64(math.Round(1/s.Rate)), 1)
+		h.count += weight
+		h.sum += s.Value * float64(weight)
+		for i, le := range a.bounds {
+			if s.Value <= le {
+				h.counts[i] += weight
+			}
+		}
+	case TypeSet:
+		set, ok := a.sets[key]
+		if !ok {
+			set = &setAgg{series: ser, values: make(map[string]struct{})}
+			a.sets[key] = set
+		}
+		set.values[s.Set] = struct{}{}
+	}
+}
+
+// Flush возвращает накопленное с прошлого вызова и начинает новый интервал.
+// Counter и histogram возвращаются приращениями за интервал.
+func (a *Aggregator) Flush() []model.Metrics {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	metrics := make([]model.Metrics, 0, len(a.counters)+len(a.histograms)+len(a.sets))
+	for key, c := range a.counters {
+		// отправляется целая часть: остаток не теряется, и за много интервалов
+		// сумма не расходится с присланной. Поправка epsilon не даёт погрешности
+		// деления на выборку (3 × 1/0.3 = 9.999…) откладывать целую единицу
+		delta := int64(c.sum + math.Copysign(epsilon, c.sum))
+		if c.dirty || delta != 0 {
+			metrics = append(metrics, collector.Counter(c.name, delta, c.labels))
+		}
+		c.sum -= float64(delta)
+		c.dirty = false
+		if math.Abs(c.sum) < epsilon {
+			delete(a.counters, key)
+		}
+	}
+	for _, g := range a.gauges {
+		if g.dirty {
+			metrics = append(metrics, collector.Gauge(g.name, g.value, g.labels))
+			g.dirty = false
+		}
+	}
+	for _, h := range a.histograms {
+		count, sum := h.count, h.sum
+		buckets := make([]model.Bucket, len(a.bounds))
+		for i, le := range a.bounds {
+			buckets[i] = model.Bucket{UpperBound: le, Count: h.counts[i]}
+		}
+		metrics = append(metrics, model.Metrics{
+			ID: h.name, MType: model.Histogram, Count: &count, Sum: &sum, Buckets: buckets, Labels: h.labels,
+		})
+	}
+	for _, s := range a.sets {
+		metrics = append(metrics, collector.Gauge(s.name, float64(len(s.values)), s.labels))
+	}
+
+	clear(a.histograms)
+	clear(a.sets)
+
+	return metrics
+}
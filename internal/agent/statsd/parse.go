@@ -0,0 +1,97 @@
+// Package statsd принимает метрики приложений по протоколу StatsD с расширениями
+// DogStatsD и копит их между отправками агента. Агент забирает накопленное
+// через Collect, как у любого сборщика, и отправляет вместе со своими метриками.
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/7StaSH7/gometrics/internal/model"
+)
+
+const (
+	TypeCounter      = "c"
+	TypeGauge        = "g"
+	TypeTimer        = "ms"
+	TypeHistogram    = "h"
+	TypeDistribution = "d"
+	TypeSet          = "s"
+)
+
+var ErrBadLine = errors.New("bad statsd line")
+
+// Sample — одно значение из строки вида name:value|type|@rate|#tag:value,...
+type Sample struct {
+	Name string
+	Type string
+	// Value — значение для всех типов, кроме set.
+	Value float64
+	// Set — значение set как есть: считаются уникальные строки.
+	Set string
+	// Relative — gauge со знаком, "+N" или "-N", меняет текущее значение, а не заменяет его.
+	Relative bool
+	// Rate — доля отправленных значений при выборке на клиенте, (0, 1].
+	Rate float64
+	// Tags — теги DogStatsD. Теги без значения пропускаются.
+	Tags model.Labels
+}
+
+// Parse разбирает одну строку пакета. Незнакомые секции DogStatsD
+// (время, контейнер) пропускаются.
+func Parse(line string) (Sample, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return Sample{}, fmt.Errorf("%w %q: expected name:value|type", ErrBadLine, line)
+	}
+	value, rest, ok := strings.Cut(rest, "|")
+	if !ok || value == "" {
+		return Sample{}, fmt.Errorf("%w %q: expected name:value|type", ErrBadLine, line)
+	}
+
+	sections := strings.Split(rest, "|")
+	s := Sample{Name: name, Type: sections[0], Rate: 1}
+	for _, section := range sections[1:] {
+		switch {
+		case strings.HasPrefix(section, "@"):
+			rate, err := strconv.ParseFloat(section[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return Sample{}, fmt.Errorf("%w %q: sample rate must be within (0, 1]", ErrBadLine, line)
+			}
+			s.Rate = rate
+		case strings.HasPrefix(section, "#"):
+			s.Tags = parseTags(section[1:])
+		}
+	}
+
+	switch s.Type {
+	case TypeSet:
+		s.Set = value
+		return s, nil
+	case TypeCounter, TypeGauge, TypeTimer, TypeHistogram, TypeDistribution:
+	default:
+		return Sample{}, fmt.Errorf("%w %q: unknown type %q", ErrBadLine, line, s.Type)
+	}
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return Sample{}, fmt.Errorf("%w %q: bad value", ErrBadLine, line)
+	}
+	s.Value = v
+	s.Relative = s.Type == TypeGauge && (value[0] == '+' || value[0] == '-')
+
+	return s, nil
+}
+
+func parseTags(s string) model.Labels {
+	tags := make(model.Labels)
+	for _, tag := range strings.Split(s, ",") {
+		k, v, _ := strings.Cut(tag, ":")
+		tags[k] = v
+	}
+
+	return tags.Normalize()
+}
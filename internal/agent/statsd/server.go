@@ -0,0 +1,129 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/logger"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"go.uber.org/zap"
+)
+
+// maxPacket — наибольший UDP-пакет; клиенты обычно шлют не больше 1432 или 8192 байт.
+const maxPacket = 65535
+
+// Server слушает UDP-адрес и (или) Unix-сокет и копит принятые метрики.
+// Реализует collector.Collector: Collect отдаёт накопленное с прошлого вызова.
+type Server struct {
+	*Aggregator
+
+	conns  []net.PacketConn
+	socket string
+}
+
+// Listen открывает сокеты из cfg.StatsdAddr и cfg.StatsdSocket.
+// Оставшийся от прошлого запуска файл Unix-сокета удаляется.
+func Listen(cfg *config.AgentConfig) (*Server, error) {
+	s := &Server{Aggregator: NewAggregator(cfg.StatsdBucketBounds())}
+
+	if cfg.StatsdAddr != "" {
+		conn, err := net.ListenPacket("udp", cfg.StatsdAddr)
+		if err != nil {
+			return nil, fmt.Errorf("cannot listen statsd udp: %w", err)
+		}
+		s.conns = append(s.conns, conn)
+	}
+
+	if cfg.StatsdSocket != "" {
+		if info, err := os.Stat(cfg.StatsdSocket); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(cfg.StatsdSocket)
+		}
+		conn, err := net.ListenPacket("unixgram", cfg.StatsdSocket)
+		if err != nil {
+			s.close()
+			return nil, fmt.Errorf("cannot listen statsd socket: %w", err)
+		}
+		s.conns = append(s.conns, conn)
+		s.socket = cfg.StatsdSocket
+	}
+
+	return s, nil
+}
+
+// Addrs возвращает адреса, на которых слушает сервер.
+func (s *Server) Addrs() []net.Addr {
+	addrs := make([]net.Addr, 0, len(s.conns))
+	for _, conn := range s.conns {
+		addrs = append(addrs, conn.LocalAddr())
+	}
+
+	return addrs
+}
+
+// Serve читает пакеты, пока не отменён ctx, и затем закрывает сокеты.
+func (s *Server) Serve(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, conn := range s.conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.read(conn)
+		}()
+	}
+
+	<-ctx.Done()
+	s.close()
+	wg.Wait()
+
+	return nil
+}
+
+func (s *Server) Collect(_ context.Context) ([]model.Metrics, error) {
+	return s.Flush(), nil
+}
+
+func (s *Server) read(conn net.PacketConn) {
+	buf := make([]byte, maxPacket)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Log.Error("statsd read error", zap.Error(err))
+			}
+			return
+		}
+		s.handle(string(buf[:n]))
+	}
+}
+
+// handle разбирает пакет: несколько метрик разделяются переводом строки.
+func (s *Server) handle(packet string) {
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		sample, err := Parse(line)
+		if err != nil {
+			logger.Log.Debug("statsd line is skipped", zap.Error(err))
+			continue
+		}
+		s.Add(sample)
+	}
+}
+
+func (s *Server) close() {
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	if s.socket != "" {
+		os.Remove(s.socket)
+	}
+}
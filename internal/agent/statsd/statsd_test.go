@@ -0,0 +1,217 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Sample
+		wantErr bool
+	}{
+		{
+			name: "counter",
+			line: "requests:1|c",
+			want: Sample{Name: "requests", Type: TypeCounter, Value: 1, Rate: 1},
+		},
+		{
+			name: "counter with rate and tags",
+			line: "requests:2|c|@0.5|#route:/api,method:get,canary",
+			want: Sample{Name: "requests", Type: TypeCounter, Value: 2, Rate: 0.5,
+				Tags: model.Labels{"route": "/api", "method": "get"}},
+		},
+		{
+			name: "gauge",
+			line: "queue.size:42.5|g",
+			want: Sample{Name: "queue.size", Type: TypeGauge, Value: 42.5, Rate: 1},
+		},
+		{
+			name: "relative gauge",
+			line: "queue.size:-3|g",
+			want: Sample{Name: "queue.size", Type: TypeGauge, Value: -3, Relative: true, Rate: 1},
+		},
+		{
+			name: "timer",
+			line: "latency:320|ms",
+			want: Sample{Name: "latency", Type: TypeTimer, Value: 320, Rate: 1},
+		},
+		{
+			name: "set",
+			line: "users:alice|s",
+			want: Sample{Name: "users", Type: TypeSet, Set: "alice", Rate: 1},
+		},
+		{
+			name: "unknown dogstatsd sections are skipped",
+			line: "latency:1|d|T1656581400|c:abc",
+			want: Sample{Name: "latency", Type: TypeDistribution, Value: 1, Rate: 1},
+		},
+		{name: "no type", line: "requests:1", wantErr: true},
+		{name: "no value", line: "requests", wantErr: true},
+		{name: "empty name", line: ":1|c", wantErr: true},
+		{name: "unknown type", line: "requests:1|x", wantErr: true},
+		{name: "bad value", line: "requests:abc|c", wantErr: true},
+		{name: "nan", line: "requests:NaN|g", wantErr: true},
+		{name: "bad rate", line: "requests:1|c|@2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.line)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrBadLine)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// byKey раскладывает метрики по ключу серии.
+func byKey(metrics []model.Metrics) map[string]model.Metrics {
+	res := make(map[string]model.Metrics, len(metrics))
+	for _, m := range metrics {
+		res[model.SeriesKey(m.ID, m.Labels)] = m
+	}
+
+	return res
+}
+
+func add(t *testing.T, a *Aggregator, lines ...string) {
+	t.Helper()
+
+	for _, line := range lines {
+		s, err := Parse(line)
+		require.NoError(t, err)
+		a.Add(s)
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	a := NewAggregator([]float64{100, 10})
+
+	add(t, a,
+		"hits:1|c",
+		"hits:2|c",
+		"hits:1|c|@0.25",
+		"hits:1|c|#route:/a",
+		"temp:20|g",
+		"temp:+5|g",
+		"latency:5|ms",
+		"latency:50|ms|@0.5",
+		"latency:500|h",
+		"users:alice|s",
+		"users:bob|s",
+		"users:alice|s",
+	)
+
+	got := byKey(a.Flush())
+	require.Len(t, got, 5)
+	assert.Equal(t, int64(7), *got["hits"].Delta)
+	assert.Equal(t, int64(1), *got[`hits{route="/a"}`].Delta)
+	assert.Equal(t, 25.0, *got["temp"].Value)
+	assert.Equal(t, 2.0, *got["users"].Value)
+
+	latency := got["latency"]
+	assert.Equal(t, model.Histogram, latency.MType)
+	require.NoError(t, model.ValidateHistogram(latency))
+	assert.Equal(t, int64(4), *latency.Count)
+	assert.Equal(t, 5.0+2*50+500, *latency.Sum)
+	assert.Equal(t, []model.Bucket{{UpperBound: 10, Count: 1}, {UpperBound: 100, Count: 3}}, latency.Buckets)
+
+	// новый интервал: прошлые приращения не повторяются, неизменный gauge не отправляется,
+	// а относительный меняет сохранённое значение
+	assert.Empty(t, a.Flush())
+
+	add(t, a, "temp:-10|g", "users:carol|s")
+	got = byKey(a.Flush())
+	require.Len(t, got, 2)
+	assert.Equal(t, 15.0, *got["temp"].Value)
+	assert.Equal(t, 1.0, *got["users"].Value)
+}
+
+func TestAggregatorCounterRemainder(t *testing.T) {
+	a := NewAggregator(nil)
+
+	// каждое значение с выборкой 0.4 стоит 2.5: дробная часть переходит в следующий интервал
+	var total int64
+	for range 4 {
+		add(t, a, "hits:1|c|@0.4")
+		got := byKey(a.Flush())
+		require.Len(t, got, 1)
+		total += *got["hits"].Delta
+	}
+	assert.Equal(t, int64(10), total)
+
+	// погрешность деления на выборку не откладывает целую единицу
+	add(t, a, "sent:1|c|@0.3", "sent:1|c|@0.3", "sent:1|c|@0.3")
+	assert.Equal(t, int64(10), *byKey(a.Flush())["sent"].Delta)
+
+	// без новых значений остаток не отправляется нулевыми приращениями
+	add(t, a, "hits:1|c|@0.4")
+	assert.Equal(t, int64(2), *byKey(a.Flush())["hits"].Delta)
+	assert.Empty(t, a.Flush())
+	add(t, a, "hits:1|c|@0.4")
+	assert.Equal(t, int64(3), *byKey(a.Flush())["hits"].Delta)
+}
+
+func TestServer(t *testing.T) {
+	cfg := &config.AgentConfig{
+		StatsdAddr:    "127.0.0.1:0",
+		StatsdSocket:  filepath.Join(t.TempDir(), "statsd.sock"),
+		StatsdBuckets: "10,100",
+	}
+	s, err := Listen(cfg)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Serve(ctx)
+	}()
+
+	addrs := s.Addrs()
+	require.Len(t, addrs, 2)
+	for _, addr := range addrs {
+		conn, err := net.Dial(addr.Network(), addr.String())
+		require.NoError(t, err)
+		_, err = conn.Write([]byte("hits:1|c\nbroken line\n\nlatency:20|ms|#net:" + addr.Network()))
+		require.NoError(t, err)
+		conn.Close()
+	}
+
+	got := make(map[string]model.Metrics)
+	require.Eventually(t, func() bool {
+		metrics, err := s.Collect(context.Background())
+		if err != nil {
+			return false
+		}
+		for _, m := range metrics {
+			key := model.SeriesKey(m.ID, m.Labels)
+			if stored, ok := got[key]; ok && m.MType == model.Counter {
+				delta := *stored.Delta + *m.Delta
+				m.Delta = &delta
+			}
+			got[key] = m
+		}
+		return len(got) == 3 && *got["hits"].Delta == 2
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, int64(1), *got[`latency{net="udp"}`].Count)
+	assert.Equal(t, int64(1), *got[`latency{net="unixgram"}`].Count)
+
+	cancel()
+	require.NoError(t, <-done)
+	assert.NoFileExists(t, cfg.StatsdSocket)
+}
@@ -0,0 +1,59 @@
+// Package auth описывает ключи агентов: каждый агент подписывает запросы
+// своим ключом, а сервер по ключу определяет арендатора, в пространство имён
+// которого попадают метрики.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// AgentHeader — заголовок HTTP (и метаданные gRPC в нижнем регистре),
+// в котором агент передаёт свой идентификатор.
+const AgentHeader = "X-Agent-ID"
+
+var (
+	ErrUnknownAgent = errors.New("unknown agent")
+	ErrBadTenant    = errors.New("bad tenant name")
+)
+
+var tenantRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Credential — ключ агента и арендатор, к которому он относится.
+type Credential struct {
+	Agent  string `json:"agent"`
+	Key    string `json:"key"`
+	Tenant string `json:"tenant"`
+}
+
+// KeyStore ищет ключ агента по идентификатору. Если агента нет,
+// возвращается ошибка, оборачивающая ErrUnknownAgent.
+type KeyStore interface {
+	Lookup(ctx context.Context, agent string) (Credential, error)
+	Close() error
+}
+
+// ValidateTenant проверяет имя арендатора. Пустое имя — арендатор по умолчанию.
+func ValidateTenant(tenant string) error {
+	if tenant != "" && !tenantRe.MatchString(tenant) {
+		return fmt.Errorf("%w %q", ErrBadTenant, tenant)
+	}
+
+	return nil
+}
+
+type tenantKey struct{}
+
+// WithTenant кладёт в контекст арендатора, от имени которого выполняется запрос.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// Tenant возвращает арендатора из контекста, по умолчанию — пустую строку.
+func Tenant(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+
+	return tenant
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type fileKeyStore struct {
+	credentials map[string]Credential
+}
+
+// NewFileKeyStore читает ключи агентов из JSON-файла вида
+// [{"agent": "web-1", "key": "...", "tenant": "team-a"}, ...].
+func NewFileKeyStore(path string) (KeyStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Credential
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("cannot parse agent keys %s: %w", path, err)
+	}
+
+	credentials := make(map[string]Credential, len(list))
+	for _, cred := range list {
+		if cred.Agent == "" || cred.Key == "" {
+			return nil, fmt.Errorf("agent keys %s: agent and key must be set", path)
+		}
+		if err := ValidateTenant(cred.Tenant); err != nil {
+			return nil, fmt.Errorf("agent keys %s: %w", path, err)
+		}
+		if _, ok := credentials[cred.Agent]; ok {
+			return nil, fmt.Errorf("agent keys %s: agent %q is listed twice", path, cred.Agent)
+		}
+		credentials[cred.Agent] = cred
+	}
+	if len(credentials) == 0 {
+		return nil, fmt.Errorf("agent keys %s are empty", path)
+	}
+
+	return &fileKeyStore{credentials: credentials}, nil
+}
+
+func (s *fileKeyStore) Lookup(_ context.Context, agent string) (Credential, error) {
+	cred, ok := s.credentials[agent]
+	if !ok {
+		return Credential{}, fmt.Errorf("%w %q", ErrUnknownAgent, agent)
+	}
+
+	return cred, nil
+}
+
+func (s *fileKeyStore) Close() error {
+	return nil
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFileKeyStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{
+			name:    "valid",
+			content: `[{"agent": "web-1", "key": "k1", "tenant": "team-a"}, {"agent": "db-1", "key": "k2"}]`,
+		},
+		{name: "not json", content: `agent=web-1`, wantErr: true},
+		{name: "empty list", content: `[]`, wantErr: true},
+		{name: "missing key", content: `[{"agent": "web-1", "tenant": "team-a"}]`, wantErr: true},
+		{name: "bad tenant", content: `[{"agent": "web-1", "key": "k1", "tenant": "team a"}]`, wantErr: true},
+		{
+			name:    "duplicate agent",
+			content: `[{"agent": "web-1", "key": "k1"}, {"agent": "web-1", "key": "k2"}]`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys.json")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0600))
+
+			store, err := NewFileKeyStore(path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			cred, err := store.Lookup(context.Background(), "web-1")
+			assert.NoError(t, err)
+			assert.Equal(t, Credential{Agent: "web-1", Key: "k1", Tenant: "team-a"}, cred)
+
+			cred, err = store.Lookup(context.Background(), "db-1")
+			assert.NoError(t, err)
+			assert.Equal(t, "", cred.Tenant)
+
+			_, err = store.Lookup(context.Background(), "unknown")
+			assert.ErrorIs(t, err, ErrUnknownAgent)
+		})
+	}
+}
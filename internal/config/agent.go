@@ -2,7 +2,11 @@ package config
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/caarlos0/env"
 )
@@ -12,7 +16,34 @@ type AgentConfig struct {
 	PollInterval   int    `env:"POLL_INTERVAL"`
 	ReportInterval int    `env:"REPORT_INTERVAL"`
 	Key            string `env:"KEY"`
+	AgentID        string `env:"AGENT_ID"`
+	CryptoKey      string `env:"CRYPTO_KEY"`
 	Limit          int    `env:"RATE_LIMIT"`
+	Labels         string `env:"LABELS"`
+	Transport      string `env:"TRANSPORT"`
+	TLS            bool   `env:"TLS"`
+	TLSCA          string `env:"TLS_CA"`
+	TLSCert        string `env:"TLS_CERT"`
+	TLSKey         string `env:"TLS_KEY"`
+
+	Collectors         string `env:"COLLECTORS"`
+	CollectorIntervals string `env:"COLLECTOR_INTERVALS"`
+	ProcRoot           string `env:"PROC_ROOT"`
+	Processes          string `env:"PROCESSES"`
+
+	ScrapeTargets string        `env:"SCRAPE_TARGETS"`
+	ScrapeTimeout time.Duration `env:"SCRAPE_TIMEOUT"`
+
+	StatsdAddr    string `env:"STATSD_ADDR"`
+	StatsdSocket  string `env:"STATSD_SOCKET"`
+	StatsdBuckets string `env:"STATSD_BUCKETS"`
+
+	PushAddr string `env:"PUSH_ADDR"`
+
+	QueueDir     string        `env:"QUEUE_DIR"`
+	QueueMaxSize int64         `env:"QUEUE_MAX_SIZE"`
+	QueueMaxAge  time.Duration `env:"QUEUE_MAX_AGE"`
+	QueueDrop    string        `env:"QUEUE_DROP"`
 }
 
 func NewAgentConfig() *AgentConfig {
@@ -22,12 +53,120 @@ func NewAgentConfig() *AgentConfig {
 	flag.IntVar(&cfg.ReportInterval, "r", 10, "report interval")
 	flag.IntVar(&cfg.PollInterval, "p", 2, "poll interval")
 	flag.StringVar(&cfg.Key, "k", "", "key to calculate auth hash")
+	flag.StringVar(&cfg.AgentID, "agent-id", "", "agent id the server looks up the key by; required if the server uses per-agent keys")
+	flag.StringVar(&cfg.CryptoKey, "crypto-key", "", "path to PEM public key of the server to encrypt payloads with")
 	flag.IntVar(&cfg.Limit, "l", 5, "request rate limit")
+	flag.StringVar(&cfg.Labels, "t", "", "labels added to every metric, key=value,... (host defaults to hostname, host= disables it)")
+	flag.StringVar(&cfg.Transport, "transport", "http", "protocol to send metrics with: http or grpc")
+	flag.BoolVar(&cfg.TLS, "tls", false, "connect to the server over TLS; implied by other tls options")
+	flag.StringVar(&cfg.TLSCA, "tls-ca", "", "path to PEM CA bundle to verify the server certificate, reloaded when the file changes; system roots by default")
+	flag.StringVar(&cfg.TLSCert, "tls-cert", "", "path to PEM client certificate for mutual TLS")
+	flag.StringVar(&cfg.TLSKey, "tls-key", "", "path to PEM private key of the client certificate")
+	flag.StringVar(&cfg.Collectors, "collectors", defaultCollectors(), "collectors to poll, separated by commas: runtime, gopsutil, disk, net, system, process, prometheus")
+	flag.StringVar(&cfg.CollectorIntervals, "collector-intervals", "", "per-collector poll intervals, name=duration,...; others are polled every poll interval")
+	flag.StringVar(&cfg.ProcRoot, "proc-root", "/proc", "procfs mount to read host metrics from, e.g. host /proc mounted into a container; filesystems are resolved via its 1/root")
+	flag.StringVar(&cfg.Processes, "processes", "", "process names the process collector reports cpu and memory for, separated by commas")
+	flag.StringVar(&cfg.ScrapeTargets, "scrape-targets", "", "prometheus endpoints the prometheus collector scrapes, separated by commas, e.g. http://localhost:9100/metrics")
+	flag.DurationVar(&cfg.ScrapeTimeout, "scrape-timeout", 5*time.Second, "timeout of a single scrape of one target")
+	flag.StringVar(&cfg.StatsdAddr, "statsd-addr", "", "udp address to accept statsd and dogstatsd metrics on, e.g. localhost:8125; empty disables it")
+	flag.StringVar(&cfg.StatsdSocket, "statsd-socket", "", "unix datagram socket to accept statsd metrics on; empty disables it")
+	flag.StringVar(&cfg.StatsdBuckets, "statsd-buckets", "1,5,10,25,50,100,250,500,1000,2500,5000,10000", "histogram bucket bounds for statsd timers and histograms, in the units they are sent in")
+	flag.StringVar(&cfg.PushAddr, "push-addr", "", "local address to accept /update/ and /updates/ json from applications on, e.g. localhost:8081; empty disables it")
+	flag.StringVar(&cfg.QueueDir, "queue-dir", "", "directory to keep unsent batches in until the server is back, empty drops them")
+	flag.Int64Var(&cfg.QueueMaxSize, "queue-max-size", 64<<20, "max total size of queued batches in bytes")
+	flag.DurationVar(&cfg.QueueMaxAge, "queue-max-age", 24*time.Hour, "queued batches older than this are dropped, 0 keeps them until sent")
+	flag.StringVar(&cfg.QueueDrop, "queue-drop", "oldest", "what to drop when the queue is full: oldest or newest batches")
 	flag.Parse()
 
 	if err := env.Parse(cfg); err != nil {
 		log.Panic(err)
 	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		log.Panic("tls certificate and key must be set together")
+	}
+	if cfg.TLSCA != "" || cfg.TLSCert != "" {
+		cfg.TLS = true
+	}
+	if _, err := parseIntervals(cfg.CollectorIntervals); err != nil {
+		log.Panic(err)
+	}
+	if _, err := parseBuckets(cfg.StatsdBuckets); err != nil {
+		log.Panic(err)
+	}
 
 	return cfg
 }
+
+// EnabledCollectors возвращает имена включённых сборщиков.
+func (cfg *AgentConfig) EnabledCollectors() []string {
+	return splitList(cfg.Collectors)
+}
+
+// EnabledProcesses возвращает имена процессов для сборщика process.
+func (cfg *AgentConfig) EnabledProcesses() []string {
+	return splitList(cfg.Processes)
+}
+
+// EnabledScrapeTargets возвращает адреса для сборщика prometheus.
+func (cfg *AgentConfig) EnabledScrapeTargets() []string {
+	return splitList(cfg.ScrapeTargets)
+}
+
+// StatsdBucketBounds возвращает границы корзин гистограмм для таймеров statsd.
+func (cfg *AgentConfig) StatsdBucketBounds() []float64 {
+	buckets, _ := parseBuckets(cfg.StatsdBuckets)
+
+	return buckets
+}
+
+// CollectorInterval возвращает интервал опроса сборщика name.
+func (cfg *AgentConfig) CollectorInterval(name string) time.Duration {
+	intervals, _ := parseIntervals(cfg.CollectorIntervals)
+	if interval, ok := intervals[name]; ok {
+		return interval
+	}
+
+	return time.Duration(cfg.PollInterval) * time.Second
+}
+
+// defaultCollectors включает сборщики /proc только там, где он есть.
+func defaultCollectors() string {
+	if runtime.GOOS == "linux" {
+		return "runtime,gopsutil,disk,net,system"
+	}
+
+	return "runtime,gopsutil"
+}
+
+func splitList(s string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+func parseIntervals(s string) (map[string]time.Duration, error) {
+	intervals := make(map[string]time.Duration)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("bad collector interval %q, expected name=duration", pair)
+		}
+		interval, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("bad collector interval %q, expected positive duration", pair)
+		}
+		intervals[strings.TrimSpace(name)] = interval
+	}
+
+	return intervals, nil
+}
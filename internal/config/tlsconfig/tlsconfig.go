@@ -0,0 +1,233 @@
+// Package tlsconfig собирает *tls.Config сервера и агента из путей к сертификатам.
+// Сертификаты перечитываются при изменении файлов, перезапуск не нужен.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/logger"
+	"go.uber.org/zap"
+)
+
+// checkInterval — как часто при рукопожатии проверяется время изменения файлов.
+var checkInterval = time.Second
+
+var ErrNoCertificates = errors.New("no certificates found")
+
+// Server возвращает конфиг сервера с сертификатом из certFile и keyFile.
+// Если задан clientCAFile, сервер требует от клиента сертификат, подписанный этим CA.
+func Server(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := newReloader([]string{certFile, keyFile}, func() (*tls.Certificate, error) {
+		return loadKeyPair(certFile, keyFile)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return cert.get(), nil
+		},
+	}
+
+	if clientCAFile != "" {
+		pool, err := newReloader([]string{clientCAFile}, func() (*x509.CertPool, error) {
+			return loadPool(clientCAFile)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// цепочка проверяется вручную, чтобы обновлённый CA подхватывался без пересоздания конфига
+		cfg.ClientAuth = tls.RequireAnyClientCert
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyClient(rawCerts, pool.get())
+		}
+	}
+
+	return cfg, nil
+}
+
+// Client возвращает конфиг агента для сервера serverName. caFile заменяет системные
+// корневые сертификаты, certFile и keyFile задают клиентский сертификат для mTLS.
+func Client(serverName, caFile, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: serverName}
+
+	if caFile != "" {
+		pool, err := newReloader([]string{caFile}, func() (*x509.CertPool, error) {
+			return loadPool(caFile)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// как и у сервера, цепочка проверяется вручную, чтобы подхватывать обновлённый CA;
+		// стандартная проверка с RootCAs отключается, имя сервера сверяется здесь же.
+		// В ConnectionState.ServerName только SNI, а для IP его нет, поэтому имя берётся из serverName
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyServer(cs.PeerCertificates, serverName, pool.get())
+		}
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := newReloader([]string{certFile, keyFile}, func() (*tls.Certificate, error) {
+			return loadKeyPair(certFile, keyFile)
+		})
+		if err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cert.get(), nil
+		}
+	}
+
+	return cfg, nil
+}
+
+func loadKeyPair(certFile, keyFile string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load key pair %s: %w", certFile, err)
+	}
+
+	return &cert, nil
+}
+
+func loadPool(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: %w", caFile, ErrNoCertificates)
+	}
+
+	return pool, nil
+}
+
+func verifyClient(rawCerts [][]byte, roots *x509.CertPool) error {
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs = append(certs, cert)
+	}
+
+	return verifyChain(certs, x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+}
+
+func verifyServer(certs []*x509.Certificate, serverName string, roots *x509.CertPool) error {
+	if serverName == "" {
+		return errors.New("server name is required to verify the server certificate")
+	}
+
+	return verifyChain(certs, x509.VerifyOptions{
+		Roots:   roots,
+		DNSName: serverName,
+	})
+}
+
+// verifyChain проверяет первый сертификат цепочки, остальные считаются промежуточными.
+func verifyChain(certs []*x509.Certificate, opts x509.VerifyOptions) error {
+	if len(certs) == 0 {
+		return ErrNoCertificates
+	}
+
+	opts.Intermediates = x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(opts)
+
+	return err
+}
+
+// reloader хранит загруженное из файлов значение и перечитывает его,
+// когда меняется время изменения любого из файлов. Если новые файлы
+// не читаются (например, записаны наполовину), остаётся прежнее значение.
+type reloader[T any] struct {
+	paths []string
+	load  func() (T, error)
+
+	mu      sync.Mutex
+	value   T
+	modTime time.Time
+	checked time.Time
+}
+
+func newReloader[T any](paths []string, load func() (T, error)) (*reloader[T], error) {
+	r := &reloader[T]{paths: paths, load: load}
+
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return nil, err
+	}
+	if r.value, err = load(); err != nil {
+		return nil, err
+	}
+	r.modTime = modTime
+	r.checked = time.Now()
+
+	return r, nil
+}
+
+func (r *reloader[T]) get() T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) < checkInterval {
+		return r.value
+	}
+	r.checked = time.Now()
+
+	modTime, err := r.latestModTime()
+	if err != nil {
+		logger.Log.Error("cannot stat tls files", zap.Strings("files", r.paths), zap.Error(err))
+		return r.value
+	}
+	if modTime.Equal(r.modTime) {
+		return r.value
+	}
+
+	value, err := r.load()
+	if err != nil {
+		logger.Log.Error("cannot reload tls files", zap.Strings("files", r.paths), zap.Error(err))
+		return r.value
+	}
+	r.value = value
+	r.modTime = modTime
+	logger.Log.Info("tls files reloaded", zap.Strings("files", r.paths))
+
+	return r.value
+}
+
+func (r *reloader[T]) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range r.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
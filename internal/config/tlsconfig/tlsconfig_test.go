@@ -0,0 +1,211 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+var serial int64
+
+// newCA создаёт самоподписанный CA и кладёт его сертификат в dir.
+func newCA(t *testing.T, dir, name string) *authority {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial++
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	file := filepath.Join(dir, name+".pem")
+	writePEM(t, file, "CERTIFICATE", der)
+
+	return &authority{cert: cert, key: key, file: file}
+}
+
+// issue выпускает сертификат и возвращает пути к нему и к ключу.
+func (ca *authority) issue(t *testing.T, dir, name string, usage x509.ExtKeyUsage) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "PRIVATE KEY", keyDER)
+
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, file, typ string, der []byte) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600))
+}
+
+func serve(t *testing.T, cfg *tls.Config) string {
+	t.Helper()
+
+	// httptest подставляет свой сертификат, поэтому слушаем сами
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { lis.Close() })
+
+	go http.Serve(lis, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	return "https://" + lis.Addr().String()
+}
+
+func get(cfg *tls.Config, url string) error {
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+	defer client.CloseIdleConnections()
+
+	res, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, dir, "ca")
+	foreign := newCA(t, dir, "foreign")
+
+	serverCert, serverKey := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	agentCert, agentKey := ca.issue(t, dir, "agent", x509.ExtKeyUsageClientAuth)
+	strangerCert, strangerKey := foreign.issue(t, dir, "stranger", x509.ExtKeyUsageClientAuth)
+	serverAsClientCert, serverAsClientKey := ca.issue(t, dir, "server-as-client", x509.ExtKeyUsageServerAuth)
+
+	serverCfg, err := Server(serverCert, serverKey, ca.file)
+	require.NoError(t, err)
+	url := serve(t, serverCfg)
+
+	tests := []struct {
+		name       string
+		serverName string
+		cert       string
+		key        string
+		ca         string
+		wantFail   bool
+	}{
+		{name: "agent certificate", cert: agentCert, key: agentKey, ca: ca.file},
+		{name: "no client certificate", ca: ca.file, wantFail: true},
+		{name: "certificate of foreign ca", cert: strangerCert, key: strangerKey, ca: ca.file, wantFail: true},
+		{name: "certificate without client usage", cert: serverAsClientCert, key: serverAsClientKey, ca: ca.file, wantFail: true},
+		{name: "server signed by unknown ca", cert: agentCert, key: agentKey, ca: foreign.file, wantFail: true},
+		{name: "server name does not match", serverName: "metrics.example.com", cert: agentCert, key: agentKey, ca: ca.file, wantFail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverName := "127.0.0.1"
+			if tt.serverName != "" {
+				serverName = tt.serverName
+			}
+			clientCfg, err := Client(serverName, tt.ca, tt.cert, tt.key)
+			require.NoError(t, err)
+
+			err = get(clientCfg, url)
+			if tt.wantFail {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	checkInterval = 0
+	t.Cleanup(func() { checkInterval = time.Second })
+
+	dir := t.TempDir()
+	oldCA := newCA(t, dir, "old")
+	nextCA := newCA(t, dir, "new")
+
+	serverCert, serverKey := oldCA.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	serverCfg, err := Server(serverCert, serverKey, "")
+	require.NoError(t, err)
+	url := serve(t, serverCfg)
+
+	oldClient, err := Client("127.0.0.1", oldCA.file, "", "")
+	require.NoError(t, err)
+	newClient, err := Client("127.0.0.1", nextCA.file, "", "")
+	require.NoError(t, err)
+
+	assert.NoError(t, get(oldClient, url))
+	assert.Error(t, get(newClient, url))
+
+	// битый файл не ломает сервер: остаётся прежний сертификат
+	require.NoError(t, os.WriteFile(serverCert, []byte("garbage"), 0600))
+	require.NoError(t, os.Chtimes(serverCert, time.Now(), time.Now().Add(time.Minute)))
+	assert.NoError(t, get(oldClient, url))
+
+	// перевыпущенный сертификат подхватывается без перезапуска
+	reissuedCert, reissuedKey := nextCA.issue(t, dir, "reissued", x509.ExtKeyUsageServerAuth)
+	for src, dst := range map[string]string{reissuedCert: serverCert, reissuedKey: serverKey} {
+		require.NoError(t, os.Rename(src, dst))
+		require.NoError(t, os.Chtimes(dst, time.Now(), time.Now().Add(2*time.Minute)))
+	}
+	assert.NoError(t, get(newClient, url))
+	assert.Error(t, get(oldClient, url))
+
+	// агент подхватывает сменённый CA так же
+	data, err := os.ReadFile(nextCA.file)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(oldCA.file, data, 0600))
+	require.NoError(t, os.Chtimes(oldCA.file, time.Now(), time.Now().Add(3*time.Minute)))
+	assert.NoError(t, get(oldClient, url))
+}
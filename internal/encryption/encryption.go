@@ -0,0 +1,159 @@
+// Package encryption шифрует тела запросов агента гибридной схемой:
+// случайный ключ AES-256 шифрует данные в режиме GCM, а сам ключ
+// шифруется открытым RSA-ключом сервера (OAEP, SHA-256).
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Header помечает зашифрованное тело запроса, значение — Scheme.
+const (
+	Header = "X-Content-Encryption"
+	Scheme = "rsa-oaep-aes-256-gcm"
+)
+
+var ErrMalformed = errors.New("malformed encrypted message")
+
+// Encrypt возвращает сообщение вида: зашифрованный ключ AES (pub.Size() байт) || nonce || шифртекст.
+func Encrypt(pub *rsa.PublicKey, plaintext []byte) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(wrapped)+len(nonce)+len(plaintext)+gcm.Overhead())
+	out = append(out, wrapped...)
+	out = append(out, nonce...)
+
+	return gcm.Seal(out, nonce, plaintext, nil), nil
+}
+
+func Decrypt(priv *rsa.PrivateKey, message []byte) ([]byte, error) {
+	if len(message) < priv.Size() {
+		return nil, ErrMalformed
+	}
+
+	key, err := rsa.DecryptOAEP(sha256.New(), nil, priv, message[:priv.Size()], nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	message = message[priv.Size():]
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(message) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+
+	plaintext, err := gcm.Open(nil, message[:gcm.NonceSize()], message[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// LoadPublicKey читает открытый ключ из PEM-файла (PKIX, PKCS#1 или сертификат).
+func LoadPublicKey(path string) (*rsa.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var key any
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			key = cert.PublicKey
+		}
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pub, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an RSA public key", path)
+	}
+
+	return pub, nil
+}
+
+// LoadPrivateKey читает закрытый ключ из PEM-файла (PKCS#1 или PKCS#8).
+func LoadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	priv, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an RSA private key", path)
+	}
+
+	return priv, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	return block, nil
+}
@@ -0,0 +1,112 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	body := []byte(`[{"id":"PollCount","type":"counter","delta":5}]`)
+
+	message, err := Encrypt(&priv.PublicKey, body)
+	require.NoError(t, err)
+	assert.NotContains(t, string(message), "PollCount")
+
+	tests := []struct {
+		name    string
+		key     *rsa.PrivateKey
+		message func() []byte
+		wantErr bool
+	}{
+		{
+			name:    "round trip",
+			key:     priv,
+			message: func() []byte { return message },
+		},
+		{
+			name:    "wrong key",
+			key:     other,
+			message: func() []byte { return message },
+			wantErr: true,
+		},
+		{
+			name: "tampered ciphertext",
+			key:  priv,
+			message: func() []byte {
+				tampered := append([]byte(nil), message...)
+				tampered[len(tampered)-1] ^= 1
+				return tampered
+			},
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			key:     priv,
+			message: func() []byte { return message[:100] },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decrypt(tt.key, tt.message())
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrMalformed)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, body, got)
+		})
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	write := func(name, typ string, der []byte) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600))
+		return path
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	pkix, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	require.NoError(t, err)
+
+	for _, path := range []string{
+		write("pkcs1.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(priv)),
+		write("pkcs8.pem", "PRIVATE KEY", pkcs8),
+	} {
+		got, err := LoadPrivateKey(path)
+		require.NoError(t, err)
+		assert.True(t, priv.Equal(got))
+	}
+
+	for _, path := range []string{
+		write("pkcs1.pub", "RSA PUBLIC KEY", x509.MarshalPKCS1PublicKey(&priv.PublicKey)),
+		write("pkix.pub", "PUBLIC KEY", pkix),
+	} {
+		got, err := LoadPublicKey(path)
+		require.NoError(t, err)
+		assert.True(t, priv.PublicKey.Equal(got))
+	}
+
+	_, err = LoadPublicKey(filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err)
+}
@@ -1,32 +1,29 @@
 package health
 
 import (
+	"context"
+
 	"github.com/gin-gonic/gin"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type healthHandler struct {
-	pool *pgxpool.Pool
+	check func(ctx context.Context) error
 }
 
 type HealthHandler interface {
 	Register(*gin.Engine)
 }
 
-func New(pool *pgxpool.Pool) HealthHandler {
+func New(check func(ctx context.Context) error) HealthHandler {
 	return &healthHandler{
-		pool: pool,
+		check: check,
 	}
 }
 
 func (h *healthHandler) Register(e *gin.Engine) {
 	e.GET("/ping", func(c *gin.Context) {
-		if h.pool == nil {
-			c.JSON(500, gin.H{"error": "connection is nil"})
-			return
-		}
-		if err := h.pool.Ping(c); err != nil {
-			c.JSON(500, gin.H{"error": err})
+		if err := h.check(c); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
 
@@ -29,15 +29,17 @@ func (h *metricsHandler) GetOne(c *gin.Context) {
 		return
 	}
 
-	if input.MType != model.Counter && input.MType != model.Gauge {
+	if !model.IsKnownType(input.MType) {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
 
+	labels := queryLabels(c)
+
 	switch input.MType {
 	case model.Counter:
 		{
-			value, err := h.metricsService.GetCounter(input.Name)
+			value, err := h.metricsService.GetCounter(c.Request.Context(), input.Name, labels)
 			if err != nil {
 				c.AbortWithStatus(http.StatusNotFound)
 				return
@@ -48,7 +50,7 @@ func (h *metricsHandler) GetOne(c *gin.Context) {
 		}
 	case model.Gauge:
 		{
-			value, err := h.metricsService.GetGauge(input.Name)
+			value, err := h.metricsService.GetGauge(c.Request.Context(), input.Name, labels)
 			if err != nil {
 				c.AbortWithStatus(http.StatusNotFound)
 				return
@@ -57,6 +59,23 @@ func (h *metricsHandler) GetOne(c *gin.Context) {
 			c.String(http.StatusOK, fmt.Sprintf("%v", value))
 			return
 		}
+	case model.Histogram, model.Summary:
+		{
+			var m model.Metrics
+			var err error
+			if input.MType == model.Histogram {
+				m, err = h.metricsService.GetHistogram(c.Request.Context(), input.Name, labels)
+			} else {
+				m, err = h.metricsService.GetSummary(c.Request.Context(), input.Name, labels)
+			}
+			if err != nil {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+
+			c.String(http.StatusOK, string(renderPrometheus([]model.Metrics{m})))
+			return
+		}
 	}
 }
 
@@ -75,7 +94,7 @@ func (h *metricsHandler) GetJSON(c *gin.Context) {
 		return
 	}
 
-	if body.MType != model.Counter && body.MType != model.Gauge {
+	if !model.IsKnownType(body.MType) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "bad type"})
 		return
 	}
@@ -83,7 +102,7 @@ func (h *metricsHandler) GetJSON(c *gin.Context) {
 	switch body.MType {
 	case model.Counter:
 		{
-			value, err := h.metricsService.GetCounter(body.ID)
+			value, err := h.metricsService.GetCounter(c.Request.Context(), body.ID, body.Labels)
 			if err != nil {
 				c.JSON(http.StatusNotFound, gin.H{"error": "metric not found"})
 				return
@@ -93,7 +112,7 @@ func (h *metricsHandler) GetJSON(c *gin.Context) {
 		}
 	case model.Gauge:
 		{
-			value, err := h.metricsService.GetGauge(body.ID)
+			value, err := h.metricsService.GetGauge(c.Request.Context(), body.ID, body.Labels)
 			if err != nil {
 				c.JSON(http.StatusNotFound, gin.H{"error": "metric not found"})
 				return
@@ -101,13 +120,49 @@ func (h *metricsHandler) GetJSON(c *gin.Context) {
 
 			body.Value = &value
 		}
+	case model.Histogram:
+		{
+			m, err := h.metricsService.GetHistogram(c.Request.Context(), body.ID, body.Labels)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "metric not found"})
+				return
+			}
+
+			body.Count, body.Sum, body.Buckets = m.Count, m.Sum, m.Buckets
+		}
+	case model.Summary:
+		{
+			m, err := h.metricsService.GetSummary(c.Request.Context(), body.ID, body.Labels)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "metric not found"})
+				return
+			}
+
+			body.Count, body.Sum, body.Quantiles = m.Count, m.Sum, m.Quantiles
+		}
 	}
 
 	c.JSON(http.StatusOK, body)
 }
 
+// GetMany отдаёт страницу со всеми метриками, а клиентам, которые просят
+// application/json, — сами метрики списком.
 func (h *metricsHandler) GetMany(c *gin.Context) {
-	metrics := h.metricsService.GetMany()
+	if c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON {
+		all, err := h.metricsService.GetAll(c.Request.Context())
+		if err != nil {
+			logger.Log.Error("cannot read metrics", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot read metrics"})
+			return
+		}
+		if all == nil {
+			all = []model.Metrics{}
+		}
+		c.JSON(http.StatusOK, all)
+		return
+	}
+
+	metrics := h.metricsService.GetMany(c.Request.Context())
 
 	c.HTML(http.StatusOK, "metrics.tmpl", gin.H{
 		"metrics": metrics,
@@ -3,10 +3,13 @@ package metrics
 import (
 	"context"
 	"fmt"
+	"html/template"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/7StaSH7/gometrics/internal/model"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
@@ -24,23 +27,45 @@ func setupGetTestRouter(service *MockMetricsService) *gin.Engine {
 	return router
 }
 
-func (m *MockMetricsService) GetCounter(name string) (int64, error) {
-	args := m.Called(name)
+func (m *MockMetricsService) GetCounter(_ context.Context, name string, labels model.Labels) (int64, error) {
+	args := m.Called(name, labels)
 	return args.Get(0).(int64), args.Error(1)
 }
 
-func (m *MockMetricsService) GetGauge(name string) (float64, error) {
-	args := m.Called(name)
+func (m *MockMetricsService) GetGauge(_ context.Context, name string, labels model.Labels) (float64, error) {
+	args := m.Called(name, labels)
 	return args.Get(0).(float64), args.Error(1)
 }
 
-func (m *MockMetricsService) GetMany() map[string]string {
+func (m *MockMetricsService) GetHistogram(_ context.Context, name string, labels model.Labels) (model.Metrics, error) {
+	args := m.Called(name, labels)
+	return args.Get(0).(model.Metrics), args.Error(1)
+}
+
+func (m *MockMetricsService) GetSummary(_ context.Context, name string, labels model.Labels) (model.Metrics, error) {
+	args := m.Called(name, labels)
+	return args.Get(0).(model.Metrics), args.Error(1)
+}
+
+func (m *MockMetricsService) GetMany(_ context.Context) map[string]string {
 	args := m.Called()
 
 	return args.Get(0).(map[string]string)
 }
 
-func (m *MockMetricsService) Store(ctx context.Context, restore bool, interval int) error {
+func (m *MockMetricsService) Compact(ctx context.Context, interval time.Duration) error {
+	args := m.Called(ctx, interval)
+
+	return args.Error(0)
+}
+
+func (m *MockMetricsService) GetAll(_ context.Context) ([]model.Metrics, error) {
+	args := m.Called()
+
+	return args.Get(0).([]model.Metrics), args.Error(1)
+}
+
+func (m *MockMetricsService) Store(ctx context.Context, interval int) error {
 	args := m.Called()
 
 	return args.Error(1)
@@ -59,7 +84,7 @@ func TestGet(t *testing.T) {
 			name: "successful gauge retrieval",
 			url:  "/value/gauge/temperature",
 			setupMock: func(m *MockMetricsService) {
-				m.On("GetGauge", "temperature").Return(float64(23.5), nil)
+				m.On("GetGauge", "temperature", model.Labels(nil)).Return(float64(23.5), nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -69,7 +94,7 @@ func TestGet(t *testing.T) {
 			name: "successful counter retrieval",
 			url:  "/value/counter/requests",
 			setupMock: func(m *MockMetricsService) {
-				m.On("GetCounter", "requests").Return(int64(100), nil)
+				m.On("GetCounter", "requests", model.Labels(nil)).Return(int64(100), nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -79,7 +104,7 @@ func TestGet(t *testing.T) {
 			name: "successful gauge retrieval with negative value",
 			url:  "/value/gauge/temperature",
 			setupMock: func(m *MockMetricsService) {
-				m.On("GetGauge", "temperature").Return(float64(-15.3), nil)
+				m.On("GetGauge", "temperature", model.Labels(nil)).Return(float64(-15.3), nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -89,7 +114,7 @@ func TestGet(t *testing.T) {
 			name: "gauge with zero value returns 200",
 			url:  "/value/gauge/pressure",
 			setupMock: func(m *MockMetricsService) {
-				m.On("GetGauge", "pressure").Return(float64(0), nil)
+				m.On("GetGauge", "pressure", model.Labels(nil)).Return(float64(0), nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -99,7 +124,7 @@ func TestGet(t *testing.T) {
 			name: "counter with zero value returns 200",
 			url:  "/value/counter/errors",
 			setupMock: func(m *MockMetricsService) {
-				m.On("GetCounter", "errors").Return(int64(0), nil)
+				m.On("GetCounter", "errors", model.Labels(nil)).Return(int64(0), nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -109,7 +134,7 @@ func TestGet(t *testing.T) {
 			name: "successful gauge retrieval with large value",
 			url:  "/value/gauge/temperature",
 			setupMock: func(m *MockMetricsService) {
-				m.On("GetGauge", "temperature").Return(float64(999999.999999), nil)
+				m.On("GetGauge", "temperature", model.Labels(nil)).Return(float64(999999.999999), nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -119,15 +144,54 @@ func TestGet(t *testing.T) {
 			name: "successful counter retrieval with large value",
 			url:  "/value/counter/requests",
 			setupMock: func(m *MockMetricsService) {
-				m.On("GetCounter", "requests").Return(int64(9223372036854775807), nil)
+				m.On("GetCounter", "requests", model.Labels(nil)).Return(int64(9223372036854775807), nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedHeader: "text/plain; charset=utf-8",
 			expectedBody:   "9223372036854775807",
 		},
+		{
+			name: "gauge retrieval with labels from query",
+			url:  "/value/gauge/Alloc?host=web-1&core=3",
+			setupMock: func(m *MockMetricsService) {
+				m.On("GetGauge", "Alloc", model.Labels{"host": "web-1", "core": "3"}).Return(float64(42), nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedHeader: "text/plain; charset=utf-8",
+			expectedBody:   "42",
+		},
+		{
+			name: "successful histogram retrieval",
+			url:  "/value/histogram/latency",
+			setupMock: func(m *MockMetricsService) {
+				count, sum := int64(3), 0.7
+				m.On("GetHistogram", "latency", model.Labels(nil)).Return(model.Metrics{
+					ID:      "latency",
+					MType:   model.Histogram,
+					Count:   &count,
+					Sum:     &sum,
+					Buckets: []model.Bucket{{UpperBound: 0.1, Count: 1}, {UpperBound: 0.5, Count: 3}},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedHeader: "text/plain; charset=utf-8",
+			expectedBody: "# TYPE latency histogram\n" +
+				"latency_bucket{le=\"0.1\"} 1\nlatency_bucket{le=\"0.5\"} 3\nlatency_bucket{le=\"+Inf\"} 3\n" +
+				"latency_sum 0.7\nlatency_count 3\n",
+		},
+		{
+			name: "summary not found",
+			url:  "/value/summary/rpc",
+			setupMock: func(m *MockMetricsService) {
+				m.On("GetSummary", "rpc", model.Labels(nil)).Return(model.Metrics{}, fmt.Errorf("summary metric 'rpc' not found"))
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedHeader: "text/plain; charset=utf-8",
+			expectedBody:   "",
+		},
 		{
 			name:           "invalid metric type",
-			url:            "/value/histogram/invalid",
+			url:            "/value/timer/invalid",
 			setupMock:      func(m *MockMetricsService) {},
 			expectedStatus: http.StatusBadRequest,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -137,7 +201,7 @@ func TestGet(t *testing.T) {
 			name: "gauge with scientific notation value",
 			url:  "/value/gauge/scientific",
 			setupMock: func(m *MockMetricsService) {
-				m.On("GetGauge", "scientific").Return(float64(1.23e+10), nil)
+				m.On("GetGauge", "scientific", model.Labels(nil)).Return(float64(1.23e+10), nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -147,7 +211,7 @@ func TestGet(t *testing.T) {
 			name: "metric name with special characters",
 			url:  "/value/gauge/cpu_usage_percent",
 			setupMock: func(m *MockMetricsService) {
-				m.On("GetGauge", "cpu_usage_percent").Return(float64(75.5), nil)
+				m.On("GetGauge", "cpu_usage_percent", model.Labels(nil)).Return(float64(75.5), nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -157,7 +221,7 @@ func TestGet(t *testing.T) {
 			name: "metric name with numbers",
 			url:  "/value/counter/http_200_responses",
 			setupMock: func(m *MockMetricsService) {
-				m.On("GetCounter", "http_200_responses").Return(int64(1500), nil)
+				m.On("GetCounter", "http_200_responses", model.Labels(nil)).Return(int64(1500), nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -167,7 +231,7 @@ func TestGet(t *testing.T) {
 			name: "gauge with very small positive value",
 			url:  "/value/gauge/small_value",
 			setupMock: func(m *MockMetricsService) {
-				m.On("GetGauge", "small_value").Return(float64(0.001), nil)
+				m.On("GetGauge", "small_value", model.Labels(nil)).Return(float64(0.001), nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -177,7 +241,7 @@ func TestGet(t *testing.T) {
 			name: "gauge with very small negative value",
 			url:  "/value/gauge/small_negative",
 			setupMock: func(m *MockMetricsService) {
-				m.On("GetGauge", "small_negative").Return(float64(-0.001), nil)
+				m.On("GetGauge", "small_negative", model.Labels(nil)).Return(float64(-0.001), nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -187,7 +251,7 @@ func TestGet(t *testing.T) {
 			name: "counter with value 1",
 			url:  "/value/counter/single_request",
 			setupMock: func(m *MockMetricsService) {
-				m.On("GetCounter", "single_request").Return(int64(1), nil)
+				m.On("GetCounter", "single_request", model.Labels(nil)).Return(int64(1), nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -197,7 +261,7 @@ func TestGet(t *testing.T) {
 			name: "metric not found - gauge",
 			url:  "/value/gauge/nonexistent",
 			setupMock: func(m *MockMetricsService) {
-				m.On("GetGauge", "nonexistent").Return(float64(0), fmt.Errorf("gauge metric 'nonexistent' not found"))
+				m.On("GetGauge", "nonexistent", model.Labels(nil)).Return(float64(0), fmt.Errorf("gauge metric 'nonexistent' not found"))
 			},
 			expectedStatus: http.StatusNotFound,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -207,7 +271,7 @@ func TestGet(t *testing.T) {
 			name: "metric not found - counter",
 			url:  "/value/counter/nonexistent",
 			setupMock: func(m *MockMetricsService) {
-				m.On("GetCounter", "nonexistent").Return(int64(0), fmt.Errorf("counter metric 'nonexistent' not found"))
+				m.On("GetCounter", "nonexistent", model.Labels(nil)).Return(int64(0), fmt.Errorf("counter metric 'nonexistent' not found"))
 			},
 			expectedStatus: http.StatusNotFound,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -236,3 +300,97 @@ func TestGet(t *testing.T) {
 		})
 	}
 }
+
+func TestGetMany(t *testing.T) {
+	value := 23.5
+	html := func(m *MockMetricsService) {
+		m.On("GetMany").Return(map[string]string{"temperature": "23.5"})
+	}
+	tests := []struct {
+		name           string
+		accept         string
+		setupMock      func(*MockMetricsService)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "browser gets html",
+			accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			setupMock:      html,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "temperature=23.5;",
+		},
+		{
+			name:           "no accept gets html",
+			setupMock:      html,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "temperature=23.5;",
+		},
+		{
+			name:           "any type gets html",
+			accept:         "*/*",
+			setupMock:      html,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "temperature=23.5;",
+		},
+		{
+			name:   "metrics are listed",
+			accept: "application/json",
+			setupMock: func(m *MockMetricsService) {
+				m.On("GetAll").Return([]model.Metrics{
+					{ID: "temperature", MType: model.Gauge, Value: &value, Labels: model.Labels{"host": "a"}},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[{"id":"temperature","type":"gauge","value":23.5,"labels":{"host":"a"}}]`,
+		},
+		{
+			name:   "empty storage is an empty list",
+			accept: "application/json",
+			setupMock: func(m *MockMetricsService) {
+				m.On("GetAll").Return([]model.Metrics(nil), nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[]`,
+		},
+		{
+			name:   "storage error",
+			accept: "application/json",
+			setupMock: func(m *MockMetricsService) {
+				m.On("GetAll").Return([]model.Metrics(nil), fmt.Errorf("connection refused"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"cannot read metrics"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockMetricsService)
+			tt.setupMock(mockService)
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.SetHTMLTemplate(template.Must(template.New("metrics.tmpl").Parse(
+				`{{range $name, $value := .metrics}}{{$name}}={{$value}};{{end}}`)))
+			router.GET("/", (&metricsHandler{metricsService: mockService}).GetMany)
+
+			req, err := http.NewRequest(http.MethodGet, "/", nil)
+			assert.NoError(t, err)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.accept == "application/json" {
+				assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			} else {
+				assert.Equal(t, tt.expectedBody, w.Body.String())
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
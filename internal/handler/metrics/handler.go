@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/replay"
 	"github.com/7StaSH7/gometrics/internal/service/metrics"
 	"github.com/gin-gonic/gin"
 )
@@ -8,6 +10,7 @@ import (
 type metricsHandler struct {
 	metricsService metrics.MetricsService
 	hashKey        string
+	replay         *replay.Guard
 }
 
 type MetricsHandler interface {
@@ -21,12 +24,18 @@ type MetricsHandler interface {
 	Register(*gin.Engine)
 
 	GetMany(*gin.Context)
+	GetPrometheus(*gin.Context)
+	QueryRange(*gin.Context)
 }
 
-func New(s metrics.MetricsService, key string) MetricsHandler {
+// New создаёт обработчики. Если задан key, обновления без подписи этим ключом
+// отклоняются; URL-ручка подписывает путь вместе с query. Если задан guard,
+// подписанные запросы должны нести время и nonce, повторы отклоняются.
+func New(s metrics.MetricsService, key string, guard *replay.Guard) MetricsHandler {
 	return &metricsHandler{
 		metricsService: s,
 		hashKey:        key,
+		replay:         guard,
 	}
 }
 
@@ -39,4 +48,22 @@ func (h *metricsHandler) Register(e *gin.Engine) {
 	e.POST("/updates/", h.Updates)
 
 	e.GET("", h.GetMany)
+	e.GET("/metrics", h.GetPrometheus)
+
+	e.GET("/api/v1/query_range", h.QueryRange)
+}
+
+// queryLabels собирает лейблы из query-параметров URL-ручек: /update/gauge/Alloc/1?host=a.
+func queryLabels(c *gin.Context) model.Labels {
+	query := c.Request.URL.Query()
+	if len(query) == 0 {
+		return nil
+	}
+
+	labels := make(model.Labels, len(query))
+	for k := range query {
+		labels[k] = query.Get(k)
+	}
+
+	return labels
 }
@@ -0,0 +1,257 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/7StaSH7/gometrics/internal/logger"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type promSample struct {
+	name   string
+	labels string
+	value  string
+}
+
+// promSeries — строки экспозиции одной серии; у histogram и summary их несколько.
+type promSeries struct {
+	labels  string
+	samples []promSample
+}
+
+// promFamily — метрики с одним именем экспозиции. Разные ID, которые приводятся
+// к одному имени (a.b и a-b), и серии, чьи лейблы совпали после приведения,
+// в экспозиции повторились бы, и Prometheus отверг бы её целиком.
+type promFamily struct {
+	name   string
+	id     string
+	mType  string
+	series []promSeries
+	seen   map[string]bool
+}
+
+func (h *metricsHandler) GetPrometheus(c *gin.Context) {
+	metrics, err := h.metricsService.GetAll(c.Request.Context())
+	if err != nil {
+		logger.Log.Error("cannot read metrics", zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Data(http.StatusOK, prometheusContentType, renderPrometheus(metrics))
+}
+
+func renderPrometheus(metrics []model.Metrics) []byte {
+	families := make(map[string]*promFamily)
+
+	for _, m := range metrics {
+		name := sanitizeMetricName(m.ID)
+
+		samples := promSamples(name, m)
+		if len(samples) == 0 {
+			continue
+		}
+
+		f, ok := families[name]
+		if !ok {
+			f = &promFamily{name: name, id: m.ID, mType: m.MType, seen: make(map[string]bool)}
+			families[name] = f
+		}
+		if f.mType != m.MType {
+			logger.Log.Debug("skip metric with conflicting type",
+				zap.String("id", m.ID), zap.String("type", m.MType), zap.String("family", f.mType))
+			continue
+		}
+		if f.id != m.ID {
+			logger.Log.Debug("skip metric with colliding name",
+				zap.String("id", m.ID), zap.String("name", name), zap.String("family", f.id))
+			continue
+		}
+		labels := formatLabels(m.Labels)
+		if f.seen[labels] {
+			logger.Log.Debug("skip series with colliding labels", zap.String("id", m.ID), zap.String("labels", labels))
+			continue
+		}
+		f.seen[labels] = true
+		f.series = append(f.series, promSeries{labels: labels, samples: samples})
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		f := families[name]
+		sort.SliceStable(f.series, func(i, j int) bool {
+			return f.series[i].labels < f.series[j].labels
+		})
+
+		buf.WriteString("# TYPE ")
+		buf.WriteString(f.name)
+		buf.WriteByte(' ')
+		buf.WriteString(f.mType)
+		buf.WriteByte('\n')
+
+		for _, series := range f.series {
+			for _, s := range series.samples {
+				buf.WriteString(s.name)
+				buf.WriteString(s.labels)
+				buf.WriteByte(' ')
+				buf.WriteString(s.value)
+				buf.WriteByte('\n')
+			}
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// promSamples возвращает строки экспозиции одной серии. Для histogram и summary
+// это корзины или квантили, а также _sum и _count.
+func promSamples(name string, m model.Metrics) []promSample {
+	switch m.MType {
+	case model.Counter:
+		if m.Delta == nil {
+			return nil
+		}
+		return []promSample{{name: name, labels: formatLabels(m.Labels), value: strconv.FormatInt(*m.Delta, 10)}}
+	case model.Gauge:
+		if m.Value == nil {
+			return nil
+		}
+		return []promSample{{name: name, labels: formatLabels(m.Labels), value: formatFloat(*m.Value)}}
+	case model.Histogram, model.Summary:
+		if m.Count == nil || m.Sum == nil {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	samples := make([]promSample, 0, len(m.Buckets)+len(m.Quantiles)+3)
+	if m.MType == model.Histogram {
+		for _, b := range m.Buckets {
+			samples = append(samples, promSample{
+				name:   name + "_bucket",
+				labels: formatLabels(withLabel(m.Labels, "le", formatFloat(b.UpperBound))),
+				value:  strconv.FormatInt(b.Count, 10),
+			})
+		}
+		samples = append(samples, promSample{
+			name:   name + "_bucket",
+			labels: formatLabels(withLabel(m.Labels, "le", "+Inf")),
+			value:  strconv.FormatInt(*m.Count, 10),
+		})
+	} else {
+		for _, q := range m.Quantiles {
+			samples = append(samples, promSample{
+				name:   name,
+				labels: formatLabels(withLabel(m.Labels, "quantile", formatFloat(q.Quantile))),
+				value:  formatFloat(q.Value),
+			})
+		}
+	}
+
+	labels := formatLabels(m.Labels)
+	samples = append(samples,
+		promSample{name: name + "_sum", labels: labels, value: formatFloat(*m.Sum)},
+		promSample{name: name + "_count", labels: labels, value: strconv.FormatInt(*m.Count, 10)},
+	)
+
+	return samples
+}
+
+func withLabel(labels model.Labels, key, value string) model.Labels {
+	res := make(model.Labels, len(labels)+1)
+	for k, v := range labels {
+		res[k] = v
+	}
+	res[key] = value
+
+	return res
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func formatLabels(labels model.Labels) string {
+	keys := make([]string, 0, len(labels))
+	for k, v := range labels {
+		if v == "" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(sanitizeLabelName(k))
+		sb.WriteString(`="`)
+		sb.WriteString(escapeLabelValue(labels[k]))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+
+	return sb.String()
+}
+
+// sanitizeMetricName приводит имя к виду [a-zA-Z_:][a-zA-Z0-9_:]*.
+func sanitizeMetricName(name string) string {
+	return sanitize(name, true)
+}
+
+// sanitizeLabelName приводит имя лейбла к виду [a-zA-Z_][a-zA-Z0-9_]*.
+func sanitizeLabelName(name string) string {
+	return sanitize(name, false)
+}
+
+func sanitize(name string, allowColon bool) string {
+	if name == "" {
+		return "_"
+	}
+
+	var sb strings.Builder
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			sb.WriteRune(r)
+		case r == ':' && allowColon:
+			sb.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				sb.WriteByte('_')
+			}
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+
+	return sb.String()
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueReplacer.Replace(v)
+}
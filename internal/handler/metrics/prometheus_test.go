@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupPrometheusTestRouter(service *MockMetricsService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	handler := &metricsHandler{
+		metricsService: service,
+	}
+
+	router.GET("/metrics", handler.GetPrometheus)
+
+	return router
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestGetPrometheus(t *testing.T) {
+	tests := []struct {
+		name           string
+		setupMock      func(*MockMetricsService)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "gauges and counters are typed and sorted",
+			setupMock: func(m *MockMetricsService) {
+				m.On("GetAll").Return([]model.Metrics{
+					{ID: "PollCount", MType: model.Counter, Delta: ptr(int64(42))},
+					{ID: "Alloc", MType: model.Gauge, Value: ptr(123.5)},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: "# TYPE Alloc gauge\nAlloc 123.5\n" +
+				"# TYPE PollCount counter\nPollCount 42\n",
+		},
+		{
+			name: "names are sanitised",
+			setupMock: func(m *MockMetricsService) {
+				m.On("GetAll").Return([]model.Metrics{
+					{ID: "3cpu.usage-percent", MType: model.Gauge, Value: ptr(1.0)},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "# TYPE _3cpu_usage_percent gauge\n_3cpu_usage_percent 1\n",
+		},
+		{
+			name: "conflicting type for the same name is skipped",
+			setupMock: func(m *MockMetricsService) {
+				m.On("GetAll").Return([]model.Metrics{
+					{ID: "requests", MType: model.Counter, Delta: ptr(int64(1))},
+					{ID: "requests", MType: model.Gauge, Value: ptr(2.0)},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "# TYPE requests counter\nrequests 1\n",
+		},
+		{
+			name: "ids that sanitise to the same name are not repeated",
+			setupMock: func(m *MockMetricsService) {
+				m.On("GetAll").Return([]model.Metrics{
+					{ID: "a.b", MType: model.Gauge, Value: ptr(1.0)},
+					{ID: "a-b", MType: model.Gauge, Value: ptr(2.0)},
+					{ID: "c", MType: model.Gauge, Value: ptr(3.0), Labels: model.Labels{"x.y": "1"}},
+					{ID: "c", MType: model.Gauge, Value: ptr(4.0), Labels: model.Labels{"x-y": "1"}},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "# TYPE a_b gauge\na_b 1\n# TYPE c gauge\nc{x_y=\"1\"} 3\n",
+		},
+		{
+			name: "series with labels share one family",
+			setupMock: func(m *MockMetricsService) {
+				m.On("GetAll").Return([]model.Metrics{
+					{ID: "Alloc", MType: model.Gauge, Value: ptr(2.0), Labels: model.Labels{"host": "b"}},
+					{ID: "Alloc", MType: model.Gauge, Value: ptr(1.0), Labels: model.Labels{"host": "a"}},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "# TYPE Alloc gauge\nAlloc{host=\"a\"} 1\nAlloc{host=\"b\"} 2\n",
+		},
+		{
+			name: "histogram and summary",
+			setupMock: func(m *MockMetricsService) {
+				m.On("GetAll").Return([]model.Metrics{
+					{
+						ID: "rpc", MType: model.Summary, Count: ptr(int64(10)), Sum: ptr(4.5),
+						Quantiles: []model.Quantile{{Quantile: 0.5, Value: 0.4}, {Quantile: 0.99, Value: 1.2}},
+					},
+					{
+						ID: "latency", MType: model.Histogram, Count: ptr(int64(2)), Sum: ptr(1.5),
+						Labels:  model.Labels{"host": "a"},
+						Buckets: []model.Bucket{{UpperBound: 1, Count: 1}},
+					},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: "# TYPE latency histogram\n" +
+				"latency_bucket{host=\"a\",le=\"1\"} 1\nlatency_bucket{host=\"a\",le=\"+Inf\"} 2\n" +
+				"latency_sum{host=\"a\"} 1.5\nlatency_count{host=\"a\"} 2\n" +
+				"# TYPE rpc summary\n" +
+				"rpc{quantile=\"0.5\"} 0.4\nrpc{quantile=\"0.99\"} 1.2\nrpc_sum 4.5\nrpc_count 10\n",
+		},
+		{
+			name: "empty storage",
+			setupMock: func(m *MockMetricsService) {
+				m.On("GetAll").Return([]model.Metrics{}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "",
+		},
+		{
+			name: "service error",
+			setupMock: func(m *MockMetricsService) {
+				m.On("GetAll").Return([]model.Metrics(nil), errors.New("db is down"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockMetricsService)
+			tt.setupMock(mockService)
+
+			router := setupPrometheusTestRouter(mockService)
+
+			req, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+			assert.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code, "Status code mismatch")
+			assert.Equal(t, tt.expectedBody, w.Body.String(), "Response body mismatch")
+
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	assert.Equal(t, "", formatLabels(nil))
+	assert.Equal(t,
+		`{host="a\"b",zone_1="line\nbreak\\"}`,
+		formatLabels(map[string]string{"zone-1": "line\nbreak\\", "host": `a"b`}),
+	)
+}
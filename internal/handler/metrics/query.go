@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/logger"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/repository"
+	metricsservice "github.com/7StaSH7/gometrics/internal/service/metrics"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const defaultQueryRange = time.Hour
+
+type QueryRangeInput struct {
+	ID     string `form:"id"`
+	MType  string `form:"type"`
+	Labels string `form:"labels"`
+	From   string `form:"from"`
+	To     string `form:"to"`
+	Step   string `form:"step"`
+	Agg    string `form:"agg"`
+}
+
+func (h *metricsHandler) QueryRange(c *gin.Context) {
+	var input QueryRangeInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	q, err := input.toRangeQuery(time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var series *model.Series
+	if q.Agg != "" {
+		series, err = h.metricsService.Aggregate(c.Request.Context(), q)
+	} else {
+		series, err = h.metricsService.QueryRange(c.Request.Context(), q)
+	}
+	if err != nil {
+		if errors.Is(err, metricsservice.ErrBadRange) || errors.Is(err, metricsservice.ErrBadAggregation) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if errors.Is(err, repository.ErrHistoryUnsupported) {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		}
+
+		logger.Log.Error("cannot query range", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot query range"})
+		return
+	}
+
+	c.JSON(http.StatusOK, series)
+}
+
+func (input QueryRangeInput) toRangeQuery(now time.Time) (model.RangeQuery, error) {
+	q := model.RangeQuery{ID: input.ID, MType: input.MType, Agg: input.Agg, To: now}
+
+	if q.ID == "" {
+		return q, errors.New("bad id")
+	}
+	if q.MType != model.Counter && q.MType != model.Gauge {
+		return q, errors.New("bad type")
+	}
+
+	labels, err := model.ParseLabels(input.Labels)
+	if err != nil {
+		return q, err
+	}
+	q.Labels = labels
+
+	if input.To != "" {
+		if q.To, err = parseTime(input.To); err != nil {
+			return q, fmt.Errorf("bad 'to': %w", err)
+		}
+	}
+
+	q.From = q.To.Add(-defaultQueryRange)
+	if input.From != "" {
+		if q.From, err = parseTime(input.From); err != nil {
+			return q, fmt.Errorf("bad 'from': %w", err)
+		}
+	}
+
+	if input.Step != "" {
+		if q.Step, err = parseDuration(input.Step); err != nil {
+			return q, fmt.Errorf("bad 'step': %w", err)
+		}
+		if q.Step < 0 {
+			return q, errors.New("bad 'step': must be positive")
+		}
+	}
+
+	return q, nil
+}
+
+// parseTime принимает unix-время в секундах (возможно дробное) или RFC3339.
+func parseTime(s string) (time.Time, error) {
+	if sec, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.UnixMilli(int64(sec * 1000)), nil
+	}
+
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// parseDuration принимает количество секунд или длительность в формате Go ("1m", "1h30m").
+func parseDuration(s string) (time.Duration, error) {
+	if sec, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(sec * float64(time.Second)), nil
+	}
+
+	return time.ParseDuration(s)
+}
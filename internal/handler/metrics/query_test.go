@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/repository"
+	metricsservice "github.com/7StaSH7/gometrics/internal/service/metrics"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func (m *MockMetricsService) QueryRange(ctx context.Context, q model.RangeQuery) (*model.Series, error) {
+	args := m.Called(ctx, q)
+
+	return args.Get(0).(*model.Series), args.Error(1)
+}
+
+func (m *MockMetricsService) Aggregate(ctx context.Context, q model.RangeQuery) (*model.Series, error) {
+	args := m.Called(ctx, q)
+
+	return args.Get(0).(*model.Series), args.Error(1)
+}
+
+func setupQueryTestRouter(service *MockMetricsService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	handler := &metricsHandler{
+		metricsService: service,
+	}
+
+	router.GET("/api/v1/query_range", handler.QueryRange)
+
+	return router
+}
+
+func TestQueryRange(t *testing.T) {
+	from := time.Unix(1700000000, 0)
+	to := time.Unix(1700000600, 0)
+
+	tests := []struct {
+		name           string
+		url            string
+		setupMock      func(*MockMetricsService)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "successful range query",
+			url:  "/api/v1/query_range?id=HeapAlloc&type=gauge&labels=host%3Dweb-1&from=1700000000&to=1700000600&step=1m",
+			setupMock: func(m *MockMetricsService) {
+				m.On("QueryRange", mock.Anything, model.RangeQuery{
+					ID:     "HeapAlloc",
+					MType:  model.Gauge,
+					Labels: model.Labels{"host": "web-1"},
+					From:   from,
+					To:     to,
+					Step:   time.Minute,
+				}).Return(&model.Series{
+					ID:     "HeapAlloc",
+					MType:  model.Gauge,
+					Labels: model.Labels{"host": "web-1"},
+					Points: []model.Sample{{Timestamp: from.UTC(), Value: 1.5}},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"id":"HeapAlloc","type":"gauge","labels":{"host":"web-1"},"points":[{"t":"2023-11-14T22:13:20Z","v":1.5}]}`,
+		},
+		{
+			name: "aggregated range query",
+			url:  "/api/v1/query_range?id=PollCount&type=counter&from=1700000000&to=1700000600&step=300&agg=rate",
+			setupMock: func(m *MockMetricsService) {
+				m.On("Aggregate", mock.Anything, model.RangeQuery{
+					ID:     "PollCount",
+					MType:  model.Counter,
+					Labels: model.Labels{},
+					From:   from,
+					To:     to,
+					Step:   5 * time.Minute,
+					Agg:    model.AggRate,
+				}).Return(&model.Series{
+					ID:     "PollCount",
+					MType:  model.Counter,
+					Agg:    model.AggRate,
+					Points: []model.Sample{{Timestamp: from.UTC(), Value: 0.5}},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"id":"PollCount","type":"counter","agg":"rate","points":[{"t":"2023-11-14T22:13:20Z","v":0.5}]}`,
+		},
+		{
+			name: "unsupported aggregation",
+			url:  "/api/v1/query_range?id=PollCount&type=counter&agg=p99",
+			setupMock: func(m *MockMetricsService) {
+				m.On("Aggregate", mock.Anything, mock.Anything).Return((*model.Series)(nil), metricsservice.ErrBadAggregation)
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"aggregation is not supported for this metric type"}`,
+		},
+		{
+			name:           "missing id",
+			url:            "/api/v1/query_range?type=gauge",
+			setupMock:      func(m *MockMetricsService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"bad id"}`,
+		},
+		{
+			name:           "bad type",
+			url:            "/api/v1/query_range?id=HeapAlloc&type=histogram",
+			setupMock:      func(m *MockMetricsService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"bad type"}`,
+		},
+		{
+			name:           "bad step",
+			url:            "/api/v1/query_range?id=HeapAlloc&type=gauge&step=often",
+			setupMock:      func(m *MockMetricsService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"bad 'step': time: invalid duration \"often\""}`,
+		},
+		{
+			name: "service error",
+			url:  "/api/v1/query_range?id=PollCount&type=counter&from=1700000000&to=1700000600",
+			setupMock: func(m *MockMetricsService) {
+				m.On("QueryRange", mock.Anything, mock.Anything).Return((*model.Series)(nil), errors.New("db is down"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"cannot query range"}`,
+		},
+		{
+			name: "backend without history",
+			url:  "/api/v1/query_range?id=PollCount&type=counter",
+			setupMock: func(m *MockMetricsService) {
+				m.On("QueryRange", mock.Anything, mock.Anything).Return((*model.Series)(nil), repository.ErrHistoryUnsupported)
+			},
+			expectedStatus: http.StatusNotImplemented,
+			expectedBody:   `{"error":"storage backend does not keep history"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockMetricsService)
+			tt.setupMock(mockService)
+
+			router := setupQueryTestRouter(mockService)
+
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			assert.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code, "Status code mismatch")
+			assert.Equal(t, tt.expectedBody, w.Body.String(), "Response body mismatch")
+
+			mockService.AssertExpectations(t)
+		})
+	}
+}
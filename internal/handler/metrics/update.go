@@ -2,11 +2,13 @@ package metrics
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/7StaSH7/gometrics/internal/logger"
 	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/replay"
 	"github.com/7StaSH7/gometrics/internal/utils"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -21,6 +23,18 @@ type UpdateMetricInput struct {
 func (h *metricsHandler) Update(c *gin.Context) {
 	c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
 
+	// у запроса без тела подписывается путь вместе с query, как и с ключами агентов
+	if h.hashKey != "" {
+		if !h.signed(c, c.Request.URL.RequestURI()) {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if err := h.checkReplay(c); err != nil {
+			h.replayed(c, err, http.StatusBadRequest)
+			return
+		}
+	}
+
 	var input UpdateMetricInput
 	if err := c.ShouldBindUri(&input); err != nil {
 		c.AbortWithStatus(http.StatusBadRequest)
@@ -31,11 +45,13 @@ func (h *metricsHandler) Update(c *gin.Context) {
 		return
 	}
 
-	if input.MType != model.Counter && input.MType != model.Gauge {
+	if !model.IsKnownType(input.MType) || input.MType == model.Summary {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
 
+	labels := queryLabels(c)
+
 	if input.MType == model.Gauge {
 		parsedValue, err := strconv.ParseFloat(input.Value, 64)
 		if err != nil {
@@ -43,7 +59,20 @@ func (h *metricsHandler) Update(c *gin.Context) {
 			return
 		}
 
-		if err := h.metricsService.UpdateGauge(c.Request.Context(), nil, input.Name, parsedValue); err != nil {
+		if err := h.metricsService.UpdateGauge(c.Request.Context(), input.Name, labels, parsedValue); err != nil {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+	}
+
+	if input.MType == model.Histogram {
+		parsedValue, err := strconv.ParseFloat(input.Value, 64)
+		if err != nil {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		if err := h.metricsService.ObserveHistogram(c.Request.Context(), input.Name, labels, parsedValue); err != nil {
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
@@ -56,7 +85,7 @@ func (h *metricsHandler) Update(c *gin.Context) {
 			return
 		}
 
-		if err := h.metricsService.UpdateCounter(c.Request.Context(), nil, input.Name, parsedValue); err != nil {
+		if err := h.metricsService.UpdateCounter(c.Request.Context(), input.Name, labels, parsedValue); err != nil {
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
@@ -80,8 +109,13 @@ func (h *metricsHandler) UpdateJSON(c *gin.Context) {
 
 	logger.Log.Debug("decoded JSON body", zap.Any("body", body))
 
+	if h.hashKey != "" && hash == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "hash is required"})
+		return
+	}
+
 	var expectedHash string
-	if h.hashKey != "" && hash != "" {
+	if h.hashKey != "" {
 		jsonData, err := json.Marshal(body)
 		if err != nil {
 			logger.Log.Debug("cannot marshal JSON body", zap.Error(err))
@@ -89,15 +123,20 @@ func (h *metricsHandler) UpdateJSON(c *gin.Context) {
 			return
 		}
 
-		expectedHash = utils.GenerateSHA256(string(jsonData), h.hashKey)
+		expectedHash = utils.GenerateSHA256(replay.HeaderPayload(c.Request.Header, string(jsonData)), h.hashKey)
 
 		if !utils.VerifySHA256(expectedHash, hash) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "bad request"})
 			return
 		}
+
+		if err := h.checkReplay(c); err != nil {
+			h.replayed(c, err, http.StatusBadRequest)
+			return
+		}
 	}
 
-	if body.MType != model.Counter && body.MType != model.Gauge {
+	if !model.IsKnownType(body.MType) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "bad type"})
 		return
 	}
@@ -115,7 +154,7 @@ func (h *metricsHandler) UpdateJSON(c *gin.Context) {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "'Delta' is missing"})
 				return
 			}
-			if err := h.metricsService.UpdateCounter(c.Request.Context(), nil, body.ID, *body.Delta); err != nil {
+			if err := h.metricsService.UpdateCounter(c.Request.Context(), body.ID, body.Labels, *body.Delta); err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": err})
 				return
 			}
@@ -127,11 +166,33 @@ func (h *metricsHandler) UpdateJSON(c *gin.Context) {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "'Value' is missing"})
 				return
 			}
-			if err := h.metricsService.UpdateGauge(c.Request.Context(), nil, body.ID, *body.Value); err != nil {
+			if err := h.metricsService.UpdateGauge(c.Request.Context(), body.ID, body.Labels, *body.Value); err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": err})
 				return
 			}
 		}
+	case model.Histogram:
+		{
+			if err := model.ValidateHistogram(body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if err := h.metricsService.UpdateHistogram(c.Request.Context(), body.ID, body.Labels, body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+	case model.Summary:
+		{
+			if err := model.ValidateSummary(body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if err := h.metricsService.UpdateSummary(c.Request.Context(), body.ID, body.Labels, body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
 	}
 
 	if h.hashKey != "" && expectedHash != "" {
@@ -142,6 +203,11 @@ func (h *metricsHandler) UpdateJSON(c *gin.Context) {
 }
 
 func (h *metricsHandler) Updates(c *gin.Context) {
+	if replay.Replayed(c.Request.Context()) {
+		h.replayed(c, replay.ErrReplay, http.StatusUnauthorized)
+		return
+	}
+
 	var hash string
 	if h.hashKey != "" {
 		hash = c.GetHeader("HashSHA256")
@@ -154,8 +220,13 @@ func (h *metricsHandler) Updates(c *gin.Context) {
 		return
 	}
 
+	if h.hashKey != "" && hash == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "hash is required"})
+		return
+	}
+
 	var expectedHash string
-	if h.hashKey != "" && hash != "" {
+	if h.hashKey != "" {
 		jsonData, err := json.Marshal(metrics)
 		if err != nil {
 			logger.Log.Debug("cannot marshal JSON body", zap.Error(err))
@@ -163,16 +234,21 @@ func (h *metricsHandler) Updates(c *gin.Context) {
 			return
 		}
 
-		expectedHash = utils.GenerateSHA256(string(jsonData), h.hashKey)
+		expectedHash = utils.GenerateSHA256(replay.HeaderPayload(c.Request.Header, string(jsonData)), h.hashKey)
 
 		if !utils.VerifySHA256(expectedHash, hash) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "bad request"})
 			return
 		}
+
+		if err := h.checkReplay(c); err != nil {
+			h.replayed(c, err, http.StatusBadRequest)
+			return
+		}
 	}
 
 	for _, m := range metrics {
-		if m.MType != model.Counter && m.MType != model.Gauge {
+		if !model.IsKnownType(m.MType) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "bad type"})
 			return
 		}
@@ -196,10 +272,37 @@ func (h *metricsHandler) Updates(c *gin.Context) {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "'Value' is missing"})
 				return
 			}
+
+		case model.Histogram:
+			if err := model.ValidateHistogram(m); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+		case model.Summary:
+			if err := model.ValidateSummary(m); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 		}
 	}
 
-	if err := h.metricsService.Updates(c.Request.Context(), metrics); err != nil {
+	applied := true
+	var err error
+	if batchID := c.GetHeader(model.BatchIDHeader); batchID != "" {
+		if len(batchID) > model.MaxBatchIDLen {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "batch id is too long"})
+			return
+		}
+		applied, err = h.metricsService.UpdatesOnce(c.Request.Context(), batchID, metrics)
+	} else {
+		err = h.metricsService.Updates(c.Request.Context(), metrics)
+	}
+	if err != nil {
+		if errors.Is(err, model.ErrBucketsMismatch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
 		return
 	}
@@ -208,5 +311,58 @@ func (h *metricsHandler) Updates(c *gin.Context) {
 		c.Header("HashSHA256", expectedHash)
 	}
 
+	// повтор уже применённой пачки подтверждается, чтобы агент не слал её снова
+	if !applied {
+		logger.Log.Info("duplicate batch acknowledged", zap.String("batch", c.GetHeader(model.BatchIDHeader)))
+		c.JSON(http.StatusOK, gin.H{"status": "duplicate"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"status": "success"})
 }
+
+// signed сверяет подпись HashSHA256 запроса с payload общим ключом.
+func (h *metricsHandler) signed(c *gin.Context, payload string) bool {
+	hash := c.GetHeader("HashSHA256")
+	if hash == "" {
+		return false
+	}
+
+	return utils.VerifySHA256(utils.GenerateSHA256(replay.HeaderPayload(c.Request.Header, payload), h.hashKey), hash)
+}
+
+// checkReplay проверяет время и nonce запроса, подпись которого уже сверена.
+func (h *metricsHandler) checkReplay(c *gin.Context) error {
+	if h.replay == nil {
+		return nil
+	}
+
+	return h.replay.Check(c.GetHeader(replay.TimestampHeader), c.GetHeader(replay.NonceHeader))
+}
+
+// replayed отвечает на подписанный запрос, не прошедший проверку replay. Повтор
+// с уже виденным nonce подтверждается как дубликат, если пачка batchID уже
+// применена, и ничего не меняет. Остальные запросы отклоняются со статусом status.
+func (h *metricsHandler) replayed(c *gin.Context, err error, status int) {
+	if errors.Is(err, replay.ErrFull) {
+		logger.Log.Warn("nonce cache is full")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if batchID := c.GetHeader(model.BatchIDHeader); batchID != "" && errors.Is(err, replay.ErrReplay) {
+		applied, lookupErr := h.metricsService.BatchApplied(c.Request.Context(), batchID)
+		if lookupErr != nil {
+			logger.Log.Error("cannot look up batch", zap.String("batch", batchID), zap.Error(lookupErr))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot look up batch"})
+			return
+		}
+		if applied {
+			logger.Log.Info("duplicate batch acknowledged", zap.String("batch", batchID))
+			c.JSON(http.StatusOK, gin.H{"status": "duplicate"})
+			return
+		}
+	}
+
+	logger.Log.Info("rejected replayed request", zap.Error(err))
+	c.JSON(status, gin.H{"error": err.Error()})
+}
@@ -5,27 +5,57 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/7StaSH7/gometrics/internal/auth"
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/middleware"
 	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/replay"
+	storagerepository "github.com/7StaSH7/gometrics/internal/repository/storage"
+	metricsservice "github.com/7StaSH7/gometrics/internal/service/metrics"
+	"github.com/7StaSH7/gometrics/internal/storage"
+	"github.com/7StaSH7/gometrics/internal/utils"
 	"github.com/gin-gonic/gin"
-	"github.com/jackc/pgx/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 type MockMetricsService struct {
 	mock.Mock
 }
 
-func (m *MockMetricsService) UpdateCounter(ctx context.Context, tx pgx.Tx, name string, value int64) error {
-	args := m.Called(ctx, tx, name, value)
+func (m *MockMetricsService) UpdateCounter(ctx context.Context, name string, labels model.Labels, value int64) error {
+	args := m.Called(ctx, name, labels, value)
 
 	return args.Error(0)
 }
 
-func (m *MockMetricsService) UpdateGauge(ctx context.Context, tx pgx.Tx, name string, value float64) error {
-	args := m.Called(ctx, tx, name, value)
+func (m *MockMetricsService) UpdateGauge(ctx context.Context, name string, labels model.Labels, value float64) error {
+	args := m.Called(ctx, name, labels, value)
+
+	return args.Error(0)
+}
+
+func (m *MockMetricsService) UpdateHistogram(ctx context.Context, name string, labels model.Labels, delta model.Metrics) error {
+	args := m.Called(ctx, name, labels, delta)
+
+	return args.Error(0)
+}
+
+func (m *MockMetricsService) ObserveHistogram(ctx context.Context, name string, labels model.Labels, value float64) error {
+	args := m.Called(ctx, name, labels, value)
+
+	return args.Error(0)
+}
+
+func (m *MockMetricsService) UpdateSummary(ctx context.Context, name string, labels model.Labels, value model.Metrics) error {
+	args := m.Called(ctx, name, labels, value)
 
 	return args.Error(0)
 }
@@ -36,6 +66,18 @@ func (m *MockMetricsService) Updates(ctx context.Context, metrics []model.Metric
 	return args.Error(0)
 }
 
+func (m *MockMetricsService) UpdatesOnce(ctx context.Context, batchID string, metrics []model.Metrics) (bool, error) {
+	args := m.Called(ctx, batchID, metrics)
+
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockMetricsService) BatchApplied(ctx context.Context, batchID string) (bool, error) {
+	args := m.Called(ctx, batchID)
+
+	return args.Bool(0), args.Error(1)
+}
+
 func setupUpdateTestRouter(service *MockMetricsService) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
@@ -62,7 +104,7 @@ func TestUpdate(t *testing.T) {
 			name: "successful gauge update",
 			url:  "/update/gauge/temperature/23.5",
 			setupMock: func(m *MockMetricsService) {
-				m.On("UpdateGauge", ctx, nil, "temperature", 23.5).Return(nil)
+				m.On("UpdateGauge", ctx, "temperature", model.Labels(nil), 23.5).Return(nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -71,7 +113,7 @@ func TestUpdate(t *testing.T) {
 			name: "successful counter update",
 			url:  "/update/counter/requests/100",
 			setupMock: func(m *MockMetricsService) {
-				m.On("UpdateCounter", ctx, nil, "requests", int64(100)).Return(nil)
+				m.On("UpdateCounter", ctx, "requests", model.Labels(nil), int64(100)).Return(nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -80,7 +122,7 @@ func TestUpdate(t *testing.T) {
 			name: "successful gauge update with negative value",
 			url:  "/update/gauge/temperature/-15.3",
 			setupMock: func(m *MockMetricsService) {
-				m.On("UpdateGauge", ctx, nil, "temperature", -15.3).Return(nil)
+				m.On("UpdateGauge", ctx, "temperature", model.Labels(nil), -15.3).Return(nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -89,7 +131,7 @@ func TestUpdate(t *testing.T) {
 			name: "successful gauge update with zero value",
 			url:  "/update/gauge/pressure/0.0",
 			setupMock: func(m *MockMetricsService) {
-				m.On("UpdateGauge", ctx, nil, "pressure", 0.0).Return(nil)
+				m.On("UpdateGauge", ctx, "pressure", model.Labels(nil), 0.0).Return(nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -98,14 +140,39 @@ func TestUpdate(t *testing.T) {
 			name: "successful counter update with zero value",
 			url:  "/update/counter/errors/0",
 			setupMock: func(m *MockMetricsService) {
-				m.On("UpdateCounter", ctx, nil, "errors", int64(0)).Return(nil)
+				m.On("UpdateCounter", ctx, "errors", model.Labels(nil), int64(0)).Return(nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedHeader: "text/plain; charset=utf-8",
 		},
+		{
+			name: "counter update with labels from query",
+			url:  "/update/counter/requests/5?host=web-1",
+			setupMock: func(m *MockMetricsService) {
+				m.On("UpdateCounter", ctx, "requests", model.Labels{"host": "web-1"}, int64(5)).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedHeader: "text/plain; charset=utf-8",
+		},
+		{
+			name: "histogram observation",
+			url:  "/update/histogram/latency/0.25",
+			setupMock: func(m *MockMetricsService) {
+				m.On("ObserveHistogram", ctx, "latency", model.Labels(nil), 0.25).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedHeader: "text/plain; charset=utf-8",
+		},
+		{
+			name:           "summary cannot be updated via URL",
+			url:            "/update/summary/rpc/0.25",
+			setupMock:      func(m *MockMetricsService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedHeader: "text/plain; charset=utf-8",
+		},
 		{
 			name:           "invalid metric type",
-			url:            "/update/histogram/invalid/123",
+			url:            "/update/timer/invalid/123",
 			setupMock:      func(m *MockMetricsService) {},
 			expectedStatus: http.StatusBadRequest,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -142,7 +209,7 @@ func TestUpdate(t *testing.T) {
 			name: "service error for gauge update",
 			url:  "/update/gauge/temperature/25.0",
 			setupMock: func(m *MockMetricsService) {
-				m.On("UpdateGauge", ctx, nil, "temperature", 25.0).Return(errors.New("service error"))
+				m.On("UpdateGauge", ctx, "temperature", model.Labels(nil), 25.0).Return(errors.New("service error"))
 			},
 			expectedStatus: http.StatusBadRequest,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -151,7 +218,7 @@ func TestUpdate(t *testing.T) {
 			name: "service error for counter update",
 			url:  "/update/counter/requests/50",
 			setupMock: func(m *MockMetricsService) {
-				m.On("UpdateCounter", ctx, nil, "requests", int64(50)).Return(errors.New("service error"))
+				m.On("UpdateCounter", ctx, "requests", model.Labels(nil), int64(50)).Return(errors.New("service error"))
 			},
 			expectedStatus: http.StatusBadRequest,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -160,7 +227,7 @@ func TestUpdate(t *testing.T) {
 			name: "large gauge value",
 			url:  "/update/gauge/temperature/999999.999999",
 			setupMock: func(m *MockMetricsService) {
-				m.On("UpdateGauge", ctx, nil, "temperature", 999999.999999).Return(nil)
+				m.On("UpdateGauge", ctx, "temperature", model.Labels(nil), 999999.999999).Return(nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -169,7 +236,7 @@ func TestUpdate(t *testing.T) {
 			name: "large counter value",
 			url:  "/update/counter/requests/9223372036854775807",
 			setupMock: func(m *MockMetricsService) {
-				m.On("UpdateCounter", ctx, nil, "requests", int64(9223372036854775807)).Return(nil)
+				m.On("UpdateCounter", ctx, "requests", model.Labels(nil), int64(9223372036854775807)).Return(nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedHeader: "text/plain; charset=utf-8",
@@ -203,3 +270,262 @@ func TestUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdatesReplay(t *testing.T) {
+	const key = "secret"
+	body := `[{"id":"PollCount","type":"counter","delta":1}]`
+
+	service := new(MockMetricsService)
+	service.On("Updates", mock.Anything, mock.Anything).Return(nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	handler := New(service, key, replay.NewGuard(time.Minute, 100))
+	router.POST("/updates/", handler.Updates)
+
+	send := func(timestamp, nonce string) int {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body))
+		req.Header.Set("HashSHA256", utils.GenerateSHA256(replay.Payload(timestamp, nonce, body), key))
+		req.Header.Set(replay.TimestampHeader, timestamp)
+		req.Header.Set(replay.NonceHeader, nonce)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		return w.Code
+	}
+
+	timestamp, nonce, err := replay.Stamp()
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, send(timestamp, nonce))
+	assert.Equal(t, http.StatusBadRequest, send(timestamp, nonce))
+	service.AssertNumberOfCalls(t, "Updates", 1)
+
+	_, other, err := replay.Stamp()
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, send(timestamp, other))
+	service.AssertNumberOfCalls(t, "Updates", 2)
+}
+
+func TestUpdatesRequireSignature(t *testing.T) {
+	const key = "secret"
+	body := `[{"id":"PollCount","type":"counter","delta":1}]`
+	one := `{"id":"PollCount","type":"counter","delta":1}`
+	url := "/update/counter/PollCount/1?host=a"
+
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		signed         string
+		expectedStatus int
+	}{
+		{name: "unsigned batch", path: "/updates/", body: body, expectedStatus: http.StatusBadRequest},
+		{name: "unsigned metric", path: "/update/", body: one, expectedStatus: http.StatusBadRequest},
+		{name: "unsigned url update", path: url, expectedStatus: http.StatusBadRequest},
+		{name: "signed batch", path: "/updates/", body: body, signed: body, expectedStatus: http.StatusOK},
+		{name: "signed metric", path: "/update/", body: one, signed: one, expectedStatus: http.StatusOK},
+		{name: "signed url update", path: url, signed: url, expectedStatus: http.StatusOK},
+		{name: "url update signed for other value", path: url, signed: "/update/counter/PollCount/100?host=a", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := new(MockMetricsService)
+			service.On("Updates", mock.Anything, mock.Anything).Return(nil)
+			service.On("UpdateCounter", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			New(service, key, replay.NewGuard(time.Minute, 100)).Register(router)
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.signed != "" {
+				require.NoError(t, replay.Sign(req.Header, tt.signed, key))
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+			if tt.expectedStatus != http.StatusOK {
+				service.AssertNotCalled(t, "Updates", mock.Anything, mock.Anything)
+				service.AssertNotCalled(t, "UpdateCounter", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestUpdatesReplayedBatch(t *testing.T) {
+	const key = "secret"
+	body := `[{"id":"PollCount","type":"counter","delta":1}]`
+
+	keysFile := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, os.WriteFile(keysFile, []byte(`[{"agent":"web-1","key":"secret","tenant":"team-a"}]`), 0600))
+	keys, err := auth.NewFileKeyStore(keysFile)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		keys   auth.KeyStore
+		tenant string
+		// rejected — статус повтора с тем же nonce, но другой пачкой
+		rejected int
+	}{
+		{name: "shared key", rejected: http.StatusBadRequest},
+		{name: "agent key", keys: keys, tenant: "team-a", rejected: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := storagerepository.NewMemStorageRepository(storage.NewStorage(&config.ServerConfig{}))
+			service := metricsservice.New(backend, model.RetentionPolicy{}, nil, model.DedupPolicy{TTL: time.Minute, Size: 100})
+			guard := replay.NewGuard(time.Minute, 100)
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(middleware.AgentAuthMiddleware(tt.keys, guard))
+			hashKey := key
+			if tt.keys != nil {
+				hashKey = ""
+			}
+			New(service, hashKey, guard).Register(router)
+
+			timestamp, nonce, err := replay.Stamp()
+			require.NoError(t, err)
+			send := func(batchID string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body))
+				req.Header.Set("HashSHA256", utils.GenerateSHA256(replay.Payload(timestamp, nonce, body), key))
+				req.Header.Set(replay.TimestampHeader, timestamp)
+				req.Header.Set(replay.NonceHeader, nonce)
+				req.Header.Set(model.BatchIDHeader, batchID)
+				if tt.keys != nil {
+					req.Header.Set(auth.AgentHeader, "web-1")
+				}
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				return w
+			}
+
+			w := send("b1")
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, `{"status":"success"}`, w.Body.String())
+
+			// ретрай, подписанный один раз: тот же nonce и та же пачка
+			w = send("b1")
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, `{"status":"duplicate"}`, w.Body.String())
+
+			// перехваченный запрос с подменённой пачкой не применяется
+			assert.Equal(t, tt.rejected, send("b2").Code)
+
+			m, err := backend.Read(context.Background(), tt.tenant, model.Counter, "PollCount", nil)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), *m.Delta)
+		})
+	}
+}
+
+func TestUpdatesSignedBatchDedup(t *testing.T) {
+	const key = "secret"
+	body := `[{"id":"PollCount","type":"counter","delta":1}]`
+
+	backend := storagerepository.NewMemStorageRepository(storage.NewStorage(&config.ServerConfig{}))
+	service := metricsservice.New(backend, model.RetentionPolicy{}, nil, model.DedupPolicy{TTL: time.Minute, Size: 100})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	New(service, key, replay.NewGuard(time.Minute, 100)).Register(router)
+
+	send := func(batchID string) string {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body))
+		require.NoError(t, replay.Sign(req.Header, body, key))
+		req.Header.Set(model.BatchIDHeader, batchID)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		return w.Body.String()
+	}
+
+	// каждая попытка подписана заново, пачку узнают по идентификатору
+	assert.JSONEq(t, `{"status":"success"}`, send("b1"))
+	assert.JSONEq(t, `{"status":"duplicate"}`, send("b1"))
+	assert.JSONEq(t, `{"status":"success"}`, send("b2"))
+
+	m, err := backend.Read(context.Background(), "", model.Counter, "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *m.Delta)
+}
+
+func TestUpdatesBatchID(t *testing.T) {
+	body := `[{"id":"PollCount","type":"counter","delta":1}]`
+	delta := int64(1)
+	metrics := []model.Metrics{{ID: "PollCount", MType: model.Counter, Delta: &delta}}
+
+	tests := []struct {
+		name           string
+		batchID        string
+		setupMock      func(*MockMetricsService)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:    "new batch",
+			batchID: "b1",
+			setupMock: func(m *MockMetricsService) {
+				m.On("UpdatesOnce", mock.Anything, "b1", metrics).Return(true, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"success"}`,
+		},
+		{
+			name:    "duplicate batch",
+			batchID: "b1",
+			setupMock: func(m *MockMetricsService) {
+				m.On("UpdatesOnce", mock.Anything, "b1", metrics).Return(false, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"duplicate"}`,
+		},
+		{
+			name: "without batch id",
+			setupMock: func(m *MockMetricsService) {
+				m.On("Updates", mock.Anything, metrics).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"success"}`,
+		},
+		{
+			name:           "batch id too long",
+			batchID:        strings.Repeat("x", model.MaxBatchIDLen+1),
+			setupMock:      func(m *MockMetricsService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := new(MockMetricsService)
+			tt.setupMock(service)
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/updates/", New(service, "", nil).Updates)
+
+			req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body))
+			if tt.batchID != "" {
+				req.Header.Set(model.BatchIDHeader, tt.batchID)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			}
+			service.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/7StaSH7/gometrics/api/metricspb"
+	"github.com/7StaSH7/gometrics/internal/auth"
+	"github.com/7StaSH7/gometrics/internal/logger"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/replay"
+	"github.com/7StaSH7/gometrics/internal/utils"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// HashMetadata — метаданные с подписью запросов, у которых нет своего поля hash,
+// и с подписью вызовов Update и UpdateBatch.
+const HashMetadata = "hashsha256"
+
+var (
+	timestampMetadata = strings.ToLower(replay.TimestampHeader)
+	nonceMetadata     = strings.ToLower(replay.NonceHeader)
+	batchIDMetadata   = strings.ToLower(model.BatchIDHeader)
+)
+
+// AgentAuth — то же, что middleware.AgentAuthMiddleware для HTTP. Агент передаёт
+// свой идентификатор в метаданных x-agent-id. Каждая метрика в Update и UpdateBatch
+// должна быть подписана ключом агента, а сам вызов — подписью verifyCall.
+// GetValue подписывается целиком (metricspb.SignMessage) с подписью в метаданных
+// HashMetadata. Если задан guard, Update и UpdateBatch проверяются на повтор.
+func AgentAuth(keys auth.KeyStore, guard *replay.Guard) []grpc.ServerOption {
+	if keys == nil {
+		return nil
+	}
+
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			cred, err := credential(ctx, keys)
+			if err != nil {
+				return nil, err
+			}
+
+			switch r := req.(type) {
+			case *metricspb.UpdateRequest:
+				err = verifyMetric(r, cred.Key)
+				if err == nil {
+					err = verifyCall(ctx, r.GetMetric().GetHash(), cred.Key)
+				}
+				if err == nil {
+					err = replayError(checkReplay(ctx, guard))
+				}
+			case *metricspb.GetValueRequest:
+				err = verifyMessage(ctx, r, cred.Key)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			return handler(auth.WithTenant(ctx, cred.Tenant), req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx := ss.Context()
+			cred, err := credential(ctx, keys)
+			if err != nil {
+				return err
+			}
+
+			batchID := firstMetadata(ctx, batchIDMetadata)
+			if err := verifyCall(ctx, batchID, cred.Key); err != nil {
+				return err
+			}
+			// повтор пачки с batchID решается в UpdateBatch, как в HTTP
+			if err := checkReplay(ctx, guard); errors.Is(err, replay.ErrReplay) && batchID != "" {
+				ctx = replay.WithReplayed(ctx)
+			} else if err != nil {
+				return replayError(err)
+			}
+
+			return handler(srv, &authStream{
+				ServerStream: ss,
+				ctx:          auth.WithTenant(ctx, cred.Tenant),
+				key:          cred.Key,
+			})
+		}),
+	}
+}
+
+// authStream проверяет подпись каждой метрики потока.
+type authStream struct {
+	grpc.ServerStream
+
+	ctx context.Context
+	key string
+}
+
+func (s *authStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *authStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	if req, ok := m.(*metricspb.UpdateRequest); ok {
+		return verifyMetric(req, s.key)
+	}
+
+	return nil
+}
+
+func credential(ctx context.Context, keys auth.KeyStore) (auth.Credential, error) {
+	agent := firstMetadata(ctx, strings.ToLower(auth.AgentHeader))
+	if agent == "" {
+		return auth.Credential{}, status.Error(codes.Unauthenticated, "agent id is missing")
+	}
+
+	cred, err := keys.Lookup(ctx, agent)
+	if err != nil {
+		if errors.Is(err, auth.ErrUnknownAgent) {
+			logger.Log.Info("request from unknown agent", zap.String("agent", agent))
+			return auth.Credential{}, status.Error(codes.Unauthenticated, "unknown agent")
+		}
+		logger.Log.Error("cannot look up agent key", zap.String("agent", agent), zap.Error(err))
+		return auth.Credential{}, status.Error(codes.Internal, "cannot look up agent key")
+	}
+
+	return cred, nil
+}
+
+func verifyMetric(req *metricspb.UpdateRequest, key string) error {
+	pb := req.GetMetric()
+	if pb == nil || pb.GetHash() == "" {
+		return status.Error(codes.Unauthenticated, "hash is missing")
+	}
+
+	expectedHash, err := metricspb.Sign(pb, key)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !utils.VerifySHA256(expectedHash, pb.GetHash()) {
+		return status.Error(codes.Unauthenticated, "bad hash")
+	}
+
+	return nil
+}
+
+// verifyCall сверяет подпись вызова из метаданных HashMetadata со временем, nonce
+// и body: подписью метрики для Update и идентификатором пачки для UpdateBatch.
+// Вызов без времени и nonce подписывается одним body, как в replay.HeaderPayload.
+func verifyCall(ctx context.Context, body, key string) error {
+	hash := firstMetadata(ctx, HashMetadata)
+	if hash == "" {
+		return status.Error(codes.Unauthenticated, "hash is missing")
+	}
+
+	payload := body
+	if timestamp, nonce := firstMetadata(ctx, timestampMetadata), firstMetadata(ctx, nonceMetadata); timestamp != "" || nonce != "" {
+		payload = replay.Payload(timestamp, nonce, body)
+	}
+	if !utils.VerifySHA256(utils.GenerateSHA256(payload, key), hash) {
+		return status.Error(codes.Unauthenticated, "bad hash")
+	}
+
+	return nil
+}
+
+// checkReplay проверяет время и nonce вызова, если задан guard.
+// Вызывается после verifyCall.
+func checkReplay(ctx context.Context, guard *replay.Guard) error {
+	if guard == nil {
+		return nil
+	}
+
+	return guard.Check(firstMetadata(ctx, timestampMetadata), firstMetadata(ctx, nonceMetadata))
+}
+
+// replayError переводит ошибку checkReplay в статус: переполненный кэш nonce —
+// временная ошибка, остальное — отказ в подписи.
+func replayError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, replay.ErrFull) {
+		logger.Log.Warn("nonce cache is full")
+		return status.Error(codes.Unavailable, err.Error())
+	}
+
+	logger.Log.Info("rejected replayed request", zap.Error(err))
+	return status.Error(codes.Unauthenticated, err.Error())
+}
+
+func verifyMessage(ctx context.Context, req *metricspb.GetValueRequest, key string) error {
+	hash := firstMetadata(ctx, HashMetadata)
+	if hash == "" {
+		return status.Error(codes.Unauthenticated, "hash is missing")
+	}
+
+	expectedHash, err := metricspb.SignMessage(req, key)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !utils.VerifySHA256(expectedHash, hash) {
+		return status.Error(codes.Unauthenticated, "bad hash")
+	}
+
+	return nil
+}
+
+func firstMetadata(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
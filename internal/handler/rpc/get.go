@@ -0,0 +1,43 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/7StaSH7/gometrics/api/metricspb"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (h *metricsServer) GetValue(ctx context.Context, req *metricspb.GetValueRequest) (*metricspb.GetValueResponse, error) {
+	labels := model.Labels(req.GetLabels())
+	m := model.Metrics{ID: req.GetId(), MType: req.GetType(), Labels: labels.Normalize()}
+
+	var err error
+	switch req.GetType() {
+	case model.Counter:
+		var delta int64
+		delta, err = h.metricsService.GetCounter(ctx, req.GetId(), labels)
+		m.Delta = &delta
+	case model.Gauge:
+		var value float64
+		value, err = h.metricsService.GetGauge(ctx, req.GetId(), labels)
+		m.Value = &value
+	case model.Histogram:
+		m, err = h.metricsService.GetHistogram(ctx, req.GetId(), labels)
+	case model.Summary:
+		m, err = h.metricsService.GetSummary(ctx, req.GetId(), labels)
+	default:
+		return nil, status.Error(codes.InvalidArgument, "bad type")
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "cannot read metric")
+	}
+
+	return &metricspb.GetValueResponse{Metric: metricspb.FromModel(m)}, nil
+}
@@ -0,0 +1,104 @@
+package rpc
+
+import (
+	"errors"
+
+	"github.com/7StaSH7/gometrics/api/metricspb"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/replay"
+	"github.com/7StaSH7/gometrics/internal/service/metrics"
+	"github.com/7StaSH7/gometrics/internal/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type metricsServer struct {
+	metricspb.UnimplementedMetricsServer
+
+	metricsService metrics.MetricsService
+	hashKey        string
+	replay         *replay.Guard
+}
+
+type MetricsServer interface {
+	metricspb.MetricsServer
+
+	Register(*grpc.Server)
+}
+
+// New создаёт сервер метрик. С общим ключом key обновления должны быть
+// подписаны, а guard, если задан, отклоняет повторы подписанных вызовов.
+func New(s metrics.MetricsService, key string, guard *replay.Guard) MetricsServer {
+	return &metricsServer{
+		metricsService: s,
+		hashKey:        key,
+		replay:         guard,
+	}
+}
+
+func (h *metricsServer) Register(s *grpc.Server) {
+	metricspb.RegisterMetricsServer(s, h)
+}
+
+// metric проверяет подпись и поля обновления так же, как HTTP-ручки:
+// если на сервере задан ключ, метрика без подписи отклоняется.
+func (h *metricsServer) metric(req *metricspb.UpdateRequest) (model.Metrics, error) {
+	pb := req.GetMetric()
+	if pb == nil {
+		return model.Metrics{}, status.Error(codes.InvalidArgument, "metric is missing")
+	}
+
+	if h.hashKey != "" {
+		if pb.GetHash() == "" {
+			return model.Metrics{}, status.Error(codes.Unauthenticated, "hash is missing")
+		}
+		expectedHash, err := metricspb.Sign(pb, h.hashKey)
+		if err != nil {
+			return model.Metrics{}, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if !utils.VerifySHA256(expectedHash, pb.GetHash()) {
+			return model.Metrics{}, status.Error(codes.Unauthenticated, "bad hash")
+		}
+	}
+
+	m := pb.ToModel()
+	m.Hash = ""
+
+	if !model.IsKnownType(m.MType) {
+		return m, status.Error(codes.InvalidArgument, "bad type")
+	}
+	if m.ID == "" {
+		return m, status.Error(codes.InvalidArgument, "bad id")
+	}
+
+	var err error
+	switch m.MType {
+	case model.Counter:
+		if m.Delta == nil {
+			err = errors.New("'Delta' is missing")
+		}
+	case model.Gauge:
+		if m.Value == nil {
+			err = errors.New("'Value' is missing")
+		}
+	case model.Histogram:
+		err = model.ValidateHistogram(m)
+	case model.Summary:
+		err = model.ValidateSummary(m)
+	}
+	if err != nil {
+		return m, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return m, nil
+}
+
+// updateError переводит ошибку сервиса в статус gRPC.
+func updateError(err error) error {
+	if errors.Is(err, model.ErrBucketsMismatch) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return status.Error(codes.Internal, "cannot update metrics")
+}
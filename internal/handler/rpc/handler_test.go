@@ -0,0 +1,534 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/7StaSH7/gometrics/api/metricspb"
+	"github.com/7StaSH7/gometrics/internal/auth"
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/replay"
+	storagerepository "github.com/7StaSH7/gometrics/internal/repository/storage"
+	metricsservice "github.com/7StaSH7/gometrics/internal/service/metrics"
+	"github.com/7StaSH7/gometrics/internal/storage"
+	"github.com/7StaSH7/gometrics/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const testKey = "secret"
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func setupTestClient(t *testing.T, opts ...grpc.ServerOption) metricspb.MetricsClient {
+	return dial(t, newTestServer(t, testKey, nil, opts...), signing(t, testKey)...)
+}
+
+func newTestClient(t *testing.T, key string, opts ...grpc.ServerOption) metricspb.MetricsClient {
+	return dial(t, newTestServer(t, key, nil, opts...))
+}
+
+func newTestServer(t *testing.T, key string, guard *replay.Guard, opts ...grpc.ServerOption) *bufconn.Listener {
+	backend := storagerepository.NewMemStorageRepository(storage.NewStorage(&config.ServerConfig{}))
+	service := metricsservice.New(backend, model.RetentionPolicy{}, []float64{1, 5}, model.DedupPolicy{TTL: time.Minute, Size: 100})
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(opts...)
+	New(service, key, guard).Register(srv)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	return lis
+}
+
+func dial(t *testing.T, lis *bufconn.Listener, opts ...grpc.DialOption) metricspb.MetricsClient {
+	opts = append(opts,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	conn, err := grpc.NewClient("passthrough:///bufnet", opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return metricspb.NewMetricsClient(conn)
+}
+
+// signing подписывает ключом key метрики без подписи и сами вызовы, как агент.
+func signing(t *testing.T, key string) []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithUnaryInterceptor(func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			if r, ok := req.(*metricspb.UpdateRequest); ok {
+				signMetric(t, r, key)
+				ctx = stamped(t, ctx, r.GetMetric().GetHash(), key)
+			}
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}),
+		grpc.WithStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			var batchID string
+			if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(batchIDMetadata)) > 0 {
+				batchID = md.Get(batchIDMetadata)[0]
+			}
+			cs, err := streamer(stamped(t, ctx, batchID, key), desc, cc, method, opts...)
+			if err != nil {
+				return nil, err
+			}
+			return &signingStream{ClientStream: cs, t: t, key: key}, nil
+		}),
+	}
+}
+
+type signingStream struct {
+	grpc.ClientStream
+
+	t   *testing.T
+	key string
+}
+
+func (s *signingStream) SendMsg(m any) error {
+	if r, ok := m.(*metricspb.UpdateRequest); ok {
+		signMetric(s.t, r, s.key)
+	}
+	return s.ClientStream.SendMsg(m)
+}
+
+func signMetric(t *testing.T, req *metricspb.UpdateRequest, key string) {
+	if m := req.GetMetric(); m != nil && m.GetHash() == "" {
+		hash, err := metricspb.Sign(m, key)
+		require.NoError(t, err)
+		m.Hash = hash
+	}
+}
+
+// stamped подписывает вызов с новыми временем и nonce.
+func stamped(t *testing.T, ctx context.Context, body, key string) context.Context {
+	timestamp, nonce, err := replay.Stamp()
+	require.NoError(t, err)
+
+	return callMetadata(ctx, timestamp, nonce, replay.Payload(timestamp, nonce, body), key)
+}
+
+// callMetadata добавляет к вызову время, nonce и подпись строки signed.
+func callMetadata(ctx context.Context, timestamp, nonce, signed, key string) context.Context {
+	ctx = metadata.AppendToOutgoingContext(ctx, HashMetadata, utils.GenerateSHA256(signed, key))
+	if timestamp != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, timestampMetadata, timestamp, nonceMetadata, nonce)
+	}
+
+	return ctx
+}
+
+func signed(t *testing.T, m *metricspb.Metric) *metricspb.UpdateRequest {
+	req := &metricspb.UpdateRequest{Metric: m}
+	signMetric(t, req, testKey)
+
+	return req
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name         string
+		req          *metricspb.UpdateRequest
+		expectedCode codes.Code
+	}{
+		{
+			name:         "counter",
+			req:          &metricspb.UpdateRequest{Metric: &metricspb.Metric{Id: "PollCount", Type: model.Counter, Delta: ptr(int64(5))}},
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "signed gauge",
+			req:          signed(t, &metricspb.Metric{Id: "Alloc", Type: model.Gauge, Value: ptr(1.5), Labels: map[string]string{"host": "a"}}),
+			expectedCode: codes.OK,
+		},
+		{
+			name: "bad hash",
+			req: &metricspb.UpdateRequest{Metric: &metricspb.Metric{
+				Id: "Alloc", Type: model.Gauge, Value: ptr(1.5), Hash: "0000",
+			}},
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			name:         "missing metric",
+			req:          &metricspb.UpdateRequest{},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "unknown type",
+			req:          &metricspb.UpdateRequest{Metric: &metricspb.Metric{Id: "Alloc", Type: "timer", Value: ptr(1.5)}},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "missing delta",
+			req:          &metricspb.UpdateRequest{Metric: &metricspb.Metric{Id: "PollCount", Type: model.Counter}},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "empty id",
+			req:          &metricspb.UpdateRequest{Metric: &metricspb.Metric{Type: model.Counter, Delta: ptr(int64(1))}},
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	client := setupTestClient(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.Update(context.Background(), tt.req)
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+		})
+	}
+}
+
+func TestUpdateBatch(t *testing.T) {
+	client := setupTestClient(t)
+	ctx := context.Background()
+
+	stream, err := client.UpdateBatch(ctx)
+	require.NoError(t, err)
+
+	histogram := metricspb.FromModel(model.Observation(0.5, []float64{1, 5}))
+	histogram.Id = "Latency"
+
+	reqs := []*metricspb.UpdateRequest{
+		{Metric: &metricspb.Metric{Id: "PollCount", Type: model.Counter, Delta: ptr(int64(2))}},
+		{Metric: &metricspb.Metric{Id: "PollCount", Type: model.Counter, Delta: ptr(int64(3))}},
+		signed(t, &metricspb.Metric{Id: "Alloc", Type: model.Gauge, Value: ptr(7.0)}),
+		{Metric: histogram},
+	}
+	for _, req := range reqs {
+		require.NoError(t, stream.Send(req))
+	}
+
+	res, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(reqs)), res.GetAccepted())
+
+	got, err := client.GetValue(ctx, &metricspb.GetValueRequest{Id: "PollCount", Type: model.Counter})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), got.GetMetric().GetDelta())
+
+	got, err = client.GetValue(ctx, &metricspb.GetValueRequest{Id: "Latency", Type: model.Histogram})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), got.GetMetric().GetCount())
+	assert.Len(t, got.GetMetric().GetBuckets(), 2)
+}
+
+func TestUpdateBatchInvalid(t *testing.T) {
+	client := setupTestClient(t)
+
+	stream, err := client.UpdateBatch(context.Background())
+	require.NoError(t, err)
+
+	require.NoError(t, stream.Send(&metricspb.UpdateRequest{Metric: &metricspb.Metric{Id: "PollCount", Type: model.Counter}}))
+
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestUpdateBatchIsAtomic(t *testing.T) {
+	client := setupTestClient(t)
+	ctx := context.Background()
+
+	stream, err := client.UpdateBatch(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&metricspb.UpdateRequest{Metric: &metricspb.Metric{Id: "PollCount", Type: model.Counter, Delta: ptr(int64(2))}}))
+	require.NoError(t, stream.Send(&metricspb.UpdateRequest{Metric: &metricspb.Metric{Id: "PollCount", Type: model.Counter}}))
+	_, err = stream.CloseAndRecv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// обновления до ошибки в потоке не применены
+	_, err = client.GetValue(ctx, &metricspb.GetValueRequest{Id: "PollCount", Type: model.Counter})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestUpdateBatchDuplicate(t *testing.T) {
+	client := setupTestClient(t)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-batch-id", "batch-1")
+
+	for i := 0; i < 2; i++ {
+		stream, err := client.UpdateBatch(ctx)
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&metricspb.UpdateRequest{Metric: &metricspb.Metric{Id: "PollCount", Type: model.Counter, Delta: ptr(int64(2))}}))
+		res, err := stream.CloseAndRecv()
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), res.GetAccepted())
+	}
+
+	// повтор пачки подтверждён, но не применён второй раз
+	got, err := client.GetValue(ctx, &metricspb.GetValueRequest{Id: "PollCount", Type: model.Counter})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), got.GetMetric().GetDelta())
+}
+
+func TestUpdateReplay(t *testing.T) {
+	client := dial(t, newTestServer(t, testKey, replay.NewGuard(time.Minute, 100)))
+	req := signed(t, &metricspb.Metric{Id: "PollCount", Type: model.Counter, Delta: ptr(int64(1))})
+	hash := req.GetMetric().GetHash()
+
+	timestamp, nonce, err := replay.Stamp()
+	require.NoError(t, err)
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		req          *metricspb.UpdateRequest
+		expectedCode codes.Code
+	}{
+		{name: "fresh", ctx: callMetadata(context.Background(), timestamp, nonce, replay.Payload(timestamp, nonce, hash), testKey), req: req, expectedCode: codes.OK},
+		{name: "replayed", ctx: callMetadata(context.Background(), timestamp, nonce, replay.Payload(timestamp, nonce, hash), testKey), req: req, expectedCode: codes.Unauthenticated},
+		{name: "timestamp not signed", ctx: callMetadata(context.Background(), timestamp, "other", replay.Payload("0", "other", hash), testKey), req: req, expectedCode: codes.Unauthenticated},
+		{name: "stale", ctx: callMetadata(context.Background(), stale, "old", replay.Payload(stale, "old", hash), testKey), req: req, expectedCode: codes.Unauthenticated},
+		{name: "metric only signature", ctx: callMetadata(context.Background(), "", "", hash, testKey), req: req, expectedCode: codes.Unauthenticated},
+		{name: "unsigned call", ctx: context.Background(), req: req, expectedCode: codes.Unauthenticated},
+		{
+			name:         "unsigned metric",
+			ctx:          stamped(t, context.Background(), "", testKey),
+			req:          &metricspb.UpdateRequest{Metric: &metricspb.Metric{Id: "PollCount", Type: model.Counter, Delta: ptr(int64(1))}},
+			expectedCode: codes.Unauthenticated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.Update(tt.ctx, tt.req)
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+		})
+	}
+
+	got, err := client.GetValue(context.Background(), &metricspb.GetValueRequest{Id: "PollCount", Type: model.Counter})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), got.GetMetric().GetDelta())
+}
+
+func TestUpdateBatchReplayed(t *testing.T) {
+	client := dial(t, newTestServer(t, testKey, replay.NewGuard(time.Minute, 100)))
+
+	timestamp, nonce, err := replay.Stamp()
+	require.NoError(t, err)
+	send := func(batchID string) (*metricspb.UpdateBatchResponse, error) {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-batch-id", batchID)
+		stream, err := client.UpdateBatch(callMetadata(ctx, timestamp, nonce, replay.Payload(timestamp, nonce, batchID), testKey))
+		require.NoError(t, err)
+		_ = stream.Send(signed(t, &metricspb.Metric{Id: "PollCount", Type: model.Counter, Delta: ptr(int64(2))}))
+
+		return stream.CloseAndRecv()
+	}
+
+	res, err := send("batch-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.GetAccepted())
+
+	// повтор после потерянного ответа подтверждается, но не применяется
+	res, err = send("batch-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.GetAccepted())
+
+	// с чужим nonce неприменённую пачку протащить нельзя
+	_, err = send("batch-2")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	got, err := client.GetValue(context.Background(), &metricspb.GetValueRequest{Id: "PollCount", Type: model.Counter})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), got.GetMetric().GetDelta())
+}
+
+func TestGetValue(t *testing.T) {
+	client := setupTestClient(t)
+	ctx := context.Background()
+
+	_, err := client.Update(ctx, &metricspb.UpdateRequest{Metric: &metricspb.Metric{
+		Id: "Alloc", Type: model.Gauge, Value: ptr(3.25), Labels: map[string]string{"host": "a"},
+	}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		req           *metricspb.GetValueRequest
+		expectedCode  codes.Code
+		expectedValue float64
+	}{
+		{
+			name:          "gauge with labels",
+			req:           &metricspb.GetValueRequest{Id: "Alloc", Type: model.Gauge, Labels: map[string]string{"host": "a"}},
+			expectedCode:  codes.OK,
+			expectedValue: 3.25,
+		},
+		{
+			name:         "other series",
+			req:          &metricspb.GetValueRequest{Id: "Alloc", Type: model.Gauge},
+			expectedCode: codes.NotFound,
+		},
+		{
+			name:         "unknown type",
+			req:          &metricspb.GetValueRequest{Id: "Alloc", Type: "timer"},
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := client.GetValue(ctx, tt.req)
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+			if tt.expectedCode == codes.OK {
+				assert.Equal(t, tt.expectedValue, res.GetMetric().GetValue())
+			}
+		})
+	}
+}
+
+func TestTrustedSubnet(t *testing.T) {
+	subnets, err := utils.ParseSubnets("10.0.0.0/8,fd00::/8")
+	require.NoError(t, err)
+	client := setupTestClient(t, TrustedSubnet(subnets)...)
+
+	update := &metricspb.UpdateRequest{Metric: &metricspb.Metric{Id: "PollCount", Type: model.Counter, Delta: ptr(int64(1))}}
+
+	tests := []struct {
+		name         string
+		realIP       string
+		expectedCode codes.Code
+	}{
+		{name: "trusted ipv4", realIP: "10.0.0.7", expectedCode: codes.OK},
+		{name: "trusted ipv6", realIP: "fd00::7", expectedCode: codes.OK},
+		{name: "untrusted", realIP: "8.8.8.8", expectedCode: codes.PermissionDenied},
+		{name: "missing", expectedCode: codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.realIP != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "x-real-ip", tt.realIP)
+			}
+
+			_, err := client.Update(ctx, update)
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+
+			stream, err := client.UpdateBatch(ctx)
+			require.NoError(t, err)
+			// отказ может прийти раньше, чем уйдёт сообщение: тогда Send вернёт io.EOF,
+			// а статус достаётся из CloseAndRecv
+			_ = stream.Send(update)
+			_, err = stream.CloseAndRecv()
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+		})
+	}
+
+	// чтение не фильтруется
+	_, err = client.GetValue(context.Background(), &metricspb.GetValueRequest{Id: "PollCount", Type: model.Counter})
+	assert.NoError(t, err)
+}
+
+func TestAgentAuth(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"agent": "web-1", "key": "k1", "tenant": "team-a"},
+		{"agent": "db-1", "key": "k2", "tenant": "team-b"}
+	]`), 0600))
+	keys, err := auth.NewFileKeyStore(path)
+	require.NoError(t, err)
+
+	// с ключами агентов общий ключ сервера не задаётся
+	client := newTestClient(t, "", AgentAuth(keys, replay.NewGuard(time.Minute, 100))...)
+
+	as := func(agent string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "x-agent-id", agent)
+	}
+	update := func(key string, delta int64) *metricspb.UpdateRequest {
+		m := &metricspb.Metric{Id: "PollCount", Type: model.Counter, Delta: ptr(delta)}
+		hash, err := metricspb.Sign(m, key)
+		require.NoError(t, err)
+		m.Hash = hash
+
+		return &metricspb.UpdateRequest{Metric: m}
+	}
+	get := func(agent, key string) (*metricspb.GetValueResponse, error) {
+		req := &metricspb.GetValueRequest{Id: "PollCount", Type: model.Counter}
+		hash, err := metricspb.SignMessage(req, key)
+		require.NoError(t, err)
+
+		return client.GetValue(metadata.AppendToOutgoingContext(as(agent), HashMetadata, hash), req)
+	}
+
+	updateTests := []struct {
+		name         string
+		ctx          context.Context
+		req          *metricspb.UpdateRequest
+		callKey      string
+		expectedCode codes.Code
+	}{
+		{name: "own key", ctx: as("web-1"), req: update("k1", 5), callKey: "k1", expectedCode: codes.OK},
+		{name: "key of other agent", ctx: as("web-1"), req: update("k2", 5), callKey: "k2", expectedCode: codes.Unauthenticated},
+		{name: "call signed with other key", ctx: as("web-1"), req: update("k1", 5), callKey: "k2", expectedCode: codes.Unauthenticated},
+		{name: "unsigned call", ctx: as("web-1"), req: update("k1", 5), expectedCode: codes.Unauthenticated},
+		{
+			name:         "unsigned",
+			ctx:          as("web-1"),
+			req:          &metricspb.UpdateRequest{Metric: &metricspb.Metric{Id: "PollCount", Type: model.Counter, Delta: ptr(int64(5))}},
+			callKey:      "k1",
+			expectedCode: codes.Unauthenticated,
+		},
+		{name: "unknown agent", ctx: as("stranger"), req: update("k1", 5), callKey: "k1", expectedCode: codes.Unauthenticated},
+		{name: "missing agent", ctx: context.Background(), req: update("k1", 5), callKey: "k1", expectedCode: codes.Unauthenticated},
+	}
+
+	for _, tt := range updateTests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, streamCtx := tt.ctx, tt.ctx
+			if tt.callKey != "" {
+				ctx = stamped(t, tt.ctx, tt.req.GetMetric().GetHash(), tt.callKey)
+				streamCtx = stamped(t, tt.ctx, "", tt.callKey)
+			}
+
+			_, err := client.Update(ctx, tt.req)
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+
+			stream, err := client.UpdateBatch(streamCtx)
+			require.NoError(t, err)
+			_ = stream.Send(tt.req)
+			_, err = stream.CloseAndRecv()
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+		})
+	}
+
+	// повтор вызова с тем же nonce отклоняется
+	req := update("k1", 5)
+	ctx := stamped(t, as("web-1"), req.GetMetric().GetHash(), "k1")
+	_, err = client.Update(ctx, req)
+	require.NoError(t, err)
+	_, err = client.Update(ctx, req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// web-1 записал 5 через Update, 5 через UpdateBatch и ещё 5 до повтора,
+	// db-1 видит только своё
+	req = update("k2", 1)
+	_, err = client.Update(stamped(t, as("db-1"), req.GetMetric().GetHash(), "k2"), req)
+	require.NoError(t, err)
+
+	res, err := get("web-1", "k1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), res.GetMetric().GetDelta())
+
+	res, err = get("db-1", "k2")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.GetMetric().GetDelta())
+
+	_, err = get("db-1", "k1")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
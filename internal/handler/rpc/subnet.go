@@ -0,0 +1,54 @@
+package rpc
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+
+	"github.com/7StaSH7/gometrics/api/metricspb"
+	"github.com/7StaSH7/gometrics/internal/logger"
+	"github.com/7StaSH7/gometrics/internal/utils"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TrustedSubnet — то же, что middleware.TrustedSubnetMiddleware для HTTP:
+// Update и UpdateBatch принимаются только от агентов из подсетей.
+// Адрес агента берётся из метаданных x-real-ip.
+func TrustedSubnet(subnets []netip.Prefix) []grpc.ServerOption {
+	if len(subnets) == 0 {
+		return nil
+	}
+
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := checkSubnet(ctx, subnets, info.FullMethod); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := checkSubnet(ss.Context(), subnets, info.FullMethod); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+}
+
+func checkSubnet(ctx context.Context, subnets []netip.Prefix, method string) error {
+	if method != metricspb.Metrics_Update_FullMethodName && method != metricspb.Metrics_UpdateBatch_FullMethodName {
+		return nil
+	}
+
+	ip := firstMetadata(ctx, strings.ToLower(utils.RealIPHeader))
+
+	if !utils.InSubnets(subnets, ip) {
+		logger.Log.Info("push from untrusted address", zap.String("ip", ip), zap.String("method", method))
+		return status.Error(codes.PermissionDenied, "untrusted address")
+	}
+
+	return nil
+}
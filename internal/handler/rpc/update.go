@@ -0,0 +1,112 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/7StaSH7/gometrics/api/metricspb"
+	"github.com/7StaSH7/gometrics/internal/logger"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/replay"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (h *metricsServer) Update(ctx context.Context, req *metricspb.UpdateRequest) (*metricspb.UpdateResponse, error) {
+	m, err := h.metric(req)
+	if err != nil {
+		return nil, err
+	}
+	if h.hashKey != "" {
+		if err := verifyCall(ctx, req.GetMetric().GetHash(), h.hashKey); err != nil {
+			return nil, err
+		}
+		if err := replayError(checkReplay(ctx, h.replay)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := h.metricsService.Updates(ctx, []model.Metrics{m}); err != nil {
+		logger.Log.Debug("cannot update metric", zap.Error(err))
+		return nil, updateError(err)
+	}
+
+	return &metricspb.UpdateResponse{}, nil
+}
+
+// UpdateBatch применяет весь поток одной пачкой после CloseSend: обрыв
+// посередине ничего не меняет, и агент может повторить поток целиком.
+// Если в метаданных x-batch-id передан идентификатор пачки, повтор уже
+// применённого потока подтверждается без повторного применения, даже если
+// nonce вызова уже встречался.
+func (h *metricsServer) UpdateBatch(stream metricspb.Metrics_UpdateBatchServer) error {
+	ctx := stream.Context()
+
+	batchID := firstMetadata(ctx, batchIDMetadata)
+	if len(batchID) > model.MaxBatchIDLen {
+		return status.Error(codes.InvalidArgument, "batch id is too long")
+	}
+
+	replayed := replay.Replayed(ctx)
+	if h.hashKey != "" {
+		if err := verifyCall(ctx, batchID, h.hashKey); err != nil {
+			return err
+		}
+		if err := checkReplay(ctx, h.replay); errors.Is(err, replay.ErrReplay) && batchID != "" {
+			replayed = true
+		} else if err != nil {
+			return replayError(err)
+		}
+	}
+	if replayed {
+		applied, err := h.metricsService.BatchApplied(ctx, batchID)
+		if err != nil {
+			logger.Log.Error("cannot look up batch", zap.String("batch", batchID), zap.Error(err))
+			return status.Error(codes.Internal, "cannot look up batch")
+		}
+		if !applied {
+			return replayError(replay.ErrReplay)
+		}
+	}
+
+	var batch []model.Metrics
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		m, err := h.metric(req)
+		if err != nil {
+			return err
+		}
+
+		batch = append(batch, m)
+	}
+
+	if replayed {
+		logger.Log.Info("duplicate batch acknowledged", zap.String("batch", batchID))
+	} else if len(batch) > 0 {
+		var err error
+		applied := true
+		if batchID != "" {
+			applied, err = h.metricsService.UpdatesOnce(ctx, batchID, batch)
+		} else {
+			err = h.metricsService.Updates(ctx, batch)
+		}
+		if err != nil {
+			logger.Log.Debug("cannot update metrics", zap.Error(err))
+			return updateError(err)
+		}
+		if !applied {
+			logger.Log.Info("duplicate batch acknowledged", zap.String("batch", batchID))
+		}
+	}
+
+	return stream.SendAndClose(&metricspb.UpdateBatchResponse{Accepted: int64(len(batch))})
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/7StaSH7/gometrics/internal/auth"
+	"github.com/7StaSH7/gometrics/internal/logger"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/replay"
+	"github.com/7StaSH7/gometrics/internal/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// AgentAuthMiddleware проверяет подпись запроса ключом агента из заголовка auth.AgentHeader
+// и кладёт в контекст запроса арендатора этого агента. Подписывается тело запроса,
+// а у запросов без тела — путь вместе с query. Если задан guard, запрос должен нести
+// подписанные время и nonce (см. пакет replay). Без хранилища ключей проверка выключена.
+// Обязательна проверка только для обновлений /update*: чтение без заголовка агента
+// (страница метрик, /metrics, /ping) открыто и видит арендатора по умолчанию.
+func AgentAuthMiddleware(keys auth.KeyStore, guard *replay.Guard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if keys == nil {
+			c.Next()
+			return
+		}
+
+		agent := c.GetHeader(auth.AgentHeader)
+		if agent == "" && !strings.HasPrefix(c.Request.URL.Path, "/update") {
+			c.Next()
+			return
+		}
+		if agent == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "agent id is missing"})
+			return
+		}
+
+		cred, err := keys.Lookup(c.Request.Context(), agent)
+		if err != nil {
+			if errors.Is(err, auth.ErrUnknownAgent) {
+				logger.Log.Info("request from unknown agent", zap.String("agent", agent))
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unknown agent"})
+				return
+			}
+			logger.Log.Error("cannot look up agent key", zap.String("agent", agent), zap.Error(err))
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		c.Request.Body.Close()
+		if err != nil {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		payload := string(body)
+		if len(body) == 0 {
+			payload = c.Request.URL.RequestURI()
+		}
+
+		hash := c.GetHeader("HashSHA256")
+		payload = replay.HeaderPayload(c.Request.Header, payload)
+		if hash == "" || !utils.VerifySHA256(utils.GenerateSHA256(payload, cred.Key), hash) {
+			logger.Log.Info("bad agent signature", zap.String("agent", agent))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "bad hash"})
+			return
+		}
+
+		ctx := c.Request.Context()
+		if guard != nil {
+			err := guard.Check(c.GetHeader(replay.TimestampHeader), c.GetHeader(replay.NonceHeader))
+			switch {
+			case err == nil:
+			// о повторе пачки решает ручка /updates/: уже применённую пачку она подтверждает
+			case errors.Is(err, replay.ErrReplay) && c.Request.URL.Path == "/updates/" && c.GetHeader(model.BatchIDHeader) != "":
+				ctx = replay.WithReplayed(ctx)
+			case errors.Is(err, replay.ErrFull):
+				logger.Log.Warn("nonce cache is full", zap.String("agent", agent))
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+				return
+			default:
+				logger.Log.Info("rejected replayed request", zap.String("agent", agent), zap.Error(err))
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		c.Request = c.Request.WithContext(auth.WithTenant(ctx, cred.Tenant))
+
+		c.Next()
+	}
+}
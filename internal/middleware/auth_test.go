@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/auth"
+	"github.com/7StaSH7/gometrics/internal/replay"
+	"github.com/7StaSH7/gometrics/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type testKeys map[string]auth.Credential
+
+func (k testKeys) Lookup(_ context.Context, agent string) (auth.Credential, error) {
+	if agent == "broken" {
+		return auth.Credential{}, errors.New("db is down")
+	}
+	cred, ok := k[agent]
+	if !ok {
+		return auth.Credential{}, fmt.Errorf("%w %q", auth.ErrUnknownAgent, agent)
+	}
+
+	return cred, nil
+}
+
+func (k testKeys) Close() error {
+	return nil
+}
+
+func TestAgentAuthMiddleware(t *testing.T) {
+	keys := testKeys{
+		"web-1": {Agent: "web-1", Key: "k1", Tenant: "team-a"},
+		"db-1":  {Agent: "db-1", Key: "k2", Tenant: "team-b"},
+	}
+	body := `[{"id":"PollCount","type":"counter","delta":1}]`
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		agent          string
+		hash           string
+		expectedStatus int
+		expectedTenant string
+	}{
+		{
+			name: "signed push", method: http.MethodPost, path: "/updates/", body: body,
+			agent: "web-1", hash: utils.GenerateSHA256(body, "k1"),
+			expectedStatus: http.StatusOK, expectedTenant: "team-a",
+		},
+		{
+			name: "signed read without body", method: http.MethodGet, path: "/value/counter/PollCount?host=a",
+			agent: "db-1", hash: utils.GenerateSHA256("/value/counter/PollCount?host=a", "k2"),
+			expectedStatus: http.StatusOK, expectedTenant: "team-b",
+		},
+		{
+			name: "signed with other agent key", method: http.MethodPost, path: "/updates/", body: body,
+			agent: "db-1", hash: utils.GenerateSHA256(body, "k1"),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "unsigned", method: http.MethodPost, path: "/updates/", body: body,
+			agent: "web-1", expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "missing agent", method: http.MethodPost, path: "/updates/", body: body,
+			hash: utils.GenerateSHA256(body, "k1"), expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "unknown agent", method: http.MethodPost, path: "/updates/", body: body,
+			agent: "stranger", hash: utils.GenerateSHA256(body, "k1"), expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "key store error", method: http.MethodPost, path: "/updates/", body: body,
+			agent: "broken", hash: utils.GenerateSHA256(body, "k1"), expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "health check is open", method: http.MethodGet, path: "/ping",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "prometheus scrape is open", method: http.MethodGet, path: "/metrics",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "metrics page is open", method: http.MethodGet, path: "/",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "read with bad signature", method: http.MethodGet, path: "/",
+			agent: "web-1", hash: utils.GenerateSHA256("/", "k2"), expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "url update without agent", method: http.MethodPost, path: "/update/counter/PollCount/1",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(AgentAuthMiddleware(keys, nil))
+
+			var tenant, received string
+			router.Any("/*path", func(c *gin.Context) {
+				tenant = auth.Tenant(c.Request.Context())
+				data, _ := c.GetRawData()
+				received = string(data)
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.agent != "" {
+				req.Header.Set(auth.AgentHeader, tt.agent)
+			}
+			if tt.hash != "" {
+				req.Header.Set("HashSHA256", tt.hash)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, tt.expectedTenant, tenant)
+				assert.Equal(t, tt.body, received)
+			}
+		})
+	}
+}
+
+func TestAgentAuthMiddlewareReplay(t *testing.T) {
+	keys := testKeys{"web-1": {Agent: "web-1", Key: "k1", Tenant: "team-a"}}
+	body := `[{"id":"PollCount","type":"counter","delta":1}]`
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(AgentAuthMiddleware(keys, replay.NewGuard(time.Minute, 2)))
+	router.POST("/updates/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	timestamp, nonce, err := replay.Stamp()
+	assert.NoError(t, err)
+	_, second, err := replay.Stamp()
+	assert.NoError(t, err)
+	_, third, err := replay.Stamp()
+	assert.NoError(t, err)
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name           string
+		timestamp      string
+		nonce          string
+		signed         string
+		expectedStatus int
+	}{
+		{name: "fresh", timestamp: timestamp, nonce: nonce, signed: replay.Payload(timestamp, nonce, body), expectedStatus: http.StatusOK},
+		{name: "replayed", timestamp: timestamp, nonce: nonce, signed: replay.Payload(timestamp, nonce, body), expectedStatus: http.StatusUnauthorized},
+		{name: "timestamp not signed", timestamp: timestamp, nonce: "other", signed: replay.Payload("0", "other", body), expectedStatus: http.StatusUnauthorized},
+		{name: "stale", timestamp: stale, nonce: "old", signed: replay.Payload(stale, "old", body), expectedStatus: http.StatusUnauthorized},
+		{name: "body only signature", signed: body, expectedStatus: http.StatusUnauthorized},
+		{name: "second fresh", timestamp: timestamp, nonce: second, signed: replay.Payload(timestamp, second, body), expectedStatus: http.StatusOK},
+		// nonce в окне не вытесняются: пока кэш полон, новые запросы отклоняются
+		{name: "cache is full", timestamp: timestamp, nonce: third, signed: replay.Payload(timestamp, third, body), expectedStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body))
+			req.Header.Set(auth.AgentHeader, "web-1")
+			req.Header.Set("HashSHA256", utils.GenerateSHA256(tt.signed, "k1"))
+			if tt.timestamp != "" {
+				req.Header.Set(replay.TimestampHeader, tt.timestamp)
+				req.Header.Set(replay.NonceHeader, tt.nonce)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/7StaSH7/gometrics/internal/encryption"
+	"github.com/7StaSH7/gometrics/internal/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// maxEncryptedBody ограничивает зашифрованное тело: оно читается в память целиком.
+const maxEncryptedBody = 16 << 20
+
+// DecryptMiddleware расшифровывает тела запросов, помеченные заголовком encryption.Header.
+// Без закрытого ключа такие запросы отклоняются: прочитать их всё равно нельзя.
+// С ключом, наоборот, отклоняются незашифрованные тела обновлений /update*.
+func DecryptMiddleware(key *rsa.PrivateKey) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scheme := c.GetHeader(encryption.Header)
+		if scheme == "" {
+			if key != nil && c.Request.ContentLength != 0 && strings.HasPrefix(c.Request.URL.Path, "/update") {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "body must be encrypted"})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if key == nil || scheme != encryption.Scheme {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "unsupported encryption"})
+			return
+		}
+
+		message, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxEncryptedBody))
+		c.Request.Body.Close()
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "body is too large"})
+				return
+			}
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		body, err := encryption.Decrypt(key, message)
+		if err != nil {
+			logger.Log.Debug("cannot decrypt request body", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "cannot decrypt body"})
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Request.ContentLength = int64(len(body))
+		c.Request.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		c.Request.Header.Del(encryption.Header)
+
+		c.Next()
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/7StaSH7/gometrics/internal/encryption"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecryptMiddleware(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	plain := []byte(`[{"id":"PollCount","type":"counter","delta":1}]`)
+	encrypted, err := encryption.Encrypt(&key.PublicKey, plain)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		key            *rsa.PrivateKey
+		path           string
+		body           []byte
+		scheme         string
+		expectedStatus int
+		expectedBody   []byte
+	}{
+		{name: "encrypted body", key: key, path: "/updates/", body: encrypted, scheme: encryption.Scheme, expectedStatus: http.StatusOK, expectedBody: plain},
+		{name: "plaintext update with key", key: key, path: "/updates/", body: plain, expectedStatus: http.StatusBadRequest},
+		{name: "plaintext read with key", key: key, path: "/value/", body: plain, expectedStatus: http.StatusOK, expectedBody: plain},
+		{name: "url update with key", key: key, path: "/update/counter/PollCount/1", expectedStatus: http.StatusOK},
+		{name: "plaintext without key", path: "/updates/", body: plain, expectedStatus: http.StatusOK, expectedBody: plain},
+		{name: "encrypted without key", path: "/updates/", body: encrypted, scheme: encryption.Scheme, expectedStatus: http.StatusBadRequest},
+		{name: "unknown scheme", key: key, path: "/updates/", body: encrypted, scheme: "rot13", expectedStatus: http.StatusBadRequest},
+		{name: "garbage", key: key, path: "/updates/", body: []byte("garbage"), scheme: encryption.Scheme, expectedStatus: http.StatusBadRequest},
+		{name: "too large", key: key, path: "/updates/", body: make([]byte, maxEncryptedBody+1), scheme: encryption.Scheme, expectedStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(DecryptMiddleware(tt.key))
+
+			var got []byte
+			router.POST("/*path", func(c *gin.Context) {
+				got, _ = io.ReadAll(c.Request.Body)
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(tt.body))
+			if tt.scheme != "" {
+				req.Header.Set(encryption.Header, tt.scheme)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedBody != nil {
+				assert.Equal(t, tt.expectedBody, got)
+			}
+		})
+	}
+}
@@ -14,6 +14,8 @@ import (
 type compressWriter struct {
 	w  gin.ResponseWriter
 	zw *gzip.Writer
+	// plain — у ответа не может быть тела (1xx, 204, 304): он не сжимается и не помечается
+	plain bool
 }
 
 func (c *compressWriter) Header() http.Header {
@@ -21,11 +23,18 @@ func (c *compressWriter) Header() http.Header {
 }
 
 func (c *compressWriter) Write(p []byte) (int, error) {
+	if c.plain {
+		return c.w.Write(p)
+	}
 	return c.zw.Write(p)
 }
 
+// WriteHeader помечает сжатым любой ответ с телом: тело ошибок тоже идёт через gzip.Writer.
 func (c *compressWriter) WriteHeader(statusCode int) {
-	if statusCode < 300 {
+	c.plain = !bodyAllowed(statusCode)
+	if c.plain {
+		c.w.Header().Del("Content-Encoding")
+	} else {
 		c.w.Header().Set("Content-Encoding", "gzip")
 		c.w.Header().Del("Content-Length")
 	}
@@ -33,7 +42,7 @@ func (c *compressWriter) WriteHeader(statusCode int) {
 }
 
 func (c *compressWriter) WriteString(s string) (int, error) {
-	return c.zw.Write([]byte(s))
+	return c.Write([]byte(s))
 }
 
 func (c *compressWriter) Status() int {
@@ -57,7 +66,9 @@ func (c *compressWriter) CloseNotify() <-chan bool {
 }
 
 func (c *compressWriter) Flush() {
-	c.zw.Flush()
+	if !c.plain {
+		c.zw.Flush()
+	}
 	if f, ok := c.w.(http.Flusher); ok {
 		f.Flush()
 	}
@@ -75,9 +86,17 @@ func (c *compressWriter) WriteHeaderNow() {
 }
 
 func (c *compressWriter) Close() error {
+	if c.plain {
+		return nil
+	}
 	return c.zw.Close()
 }
 
+// bodyAllowed повторяет правило net/http: у 1xx, 204 и 304 тела нет.
+func bodyAllowed(status int) bool {
+	return (status < 100 || status >= 200) && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
 func newCompressWriter(w gin.ResponseWriter) *compressWriter {
 	return &compressWriter{
 		w:  w,
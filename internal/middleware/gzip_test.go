@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGzipMiddleware(t *testing.T) {
+	tests := []struct {
+		name         string
+		acceptGzip   bool
+		status       int
+		body         string
+		expectedGzip bool
+	}{
+		{name: "ok", acceptGzip: true, status: http.StatusOK, body: `{"status":"success"}`, expectedGzip: true},
+		{name: "error body is compressed", acceptGzip: true, status: http.StatusBadRequest, body: `{"error":"bad type"}`, expectedGzip: true},
+		{name: "ok without body", acceptGzip: true, status: http.StatusOK, expectedGzip: true},
+		{name: "no content", acceptGzip: true, status: http.StatusNoContent},
+		{name: "not modified", acceptGzip: true, status: http.StatusNotModified},
+		{name: "client without gzip", status: http.StatusOK, body: `{"status":"success"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(GzipMiddleware)
+			router.GET("/", func(c *gin.Context) {
+				c.Status(tt.status)
+				if tt.body != "" {
+					c.Writer.WriteString(tt.body)
+				}
+			})
+
+			srv := httptest.NewServer(router)
+			defer srv.Close()
+
+			req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+			require.NoError(t, err)
+			if tt.acceptGzip {
+				req.Header.Set("Accept-Encoding", "gzip")
+			}
+			// транспорт не распаковывает ответ сам, если Accept-Encoding задан явно
+			res, err := http.DefaultTransport.RoundTrip(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			raw, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.status, res.StatusCode)
+			if !tt.expectedGzip {
+				assert.Empty(t, res.Header.Get("Content-Encoding"))
+				assert.Equal(t, tt.body, string(raw))
+				return
+			}
+
+			assert.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+			zr, err := gzip.NewReader(bytes.NewReader(raw))
+			require.NoError(t, err)
+			plain, err := io.ReadAll(zr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.body, string(plain))
+		})
+	}
+}
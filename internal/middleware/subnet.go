@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/7StaSH7/gometrics/internal/logger"
+	"github.com/7StaSH7/gometrics/internal/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// TrustedSubnetMiddleware пропускает запросы на /update* только от агентов,
+// чей X-Real-IP входит в одну из подсетей. Без подсетей проверка выключена.
+func TrustedSubnetMiddleware(subnets []netip.Prefix) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(subnets) == 0 || !strings.HasPrefix(c.Request.URL.Path, "/update") {
+			c.Next()
+			return
+		}
+
+		ip := c.GetHeader(utils.RealIPHeader)
+		if !utils.InSubnets(subnets, ip) {
+			logger.Log.Info("push from untrusted address", zap.String("ip", ip), zap.String("remote", c.Request.RemoteAddr))
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "untrusted address"})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/7StaSH7/gometrics/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedSubnetMiddleware(t *testing.T) {
+	subnets, err := utils.ParseSubnets("10.0.0.0/8, 192.168.1.0/24,fd00::/8")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		realIP         string
+		expectedStatus int
+	}{
+		{name: "ipv4 in first subnet", path: "/update/", realIP: "10.1.2.3", expectedStatus: http.StatusOK},
+		{name: "ipv4 in second subnet", path: "/updates/", realIP: "192.168.1.200", expectedStatus: http.StatusOK},
+		{name: "ipv4 outside subnets", path: "/updates/", realIP: "192.168.2.1", expectedStatus: http.StatusForbidden},
+		{name: "ipv6 in subnet", path: "/update/", realIP: "fd12:3456::1", expectedStatus: http.StatusOK},
+		{name: "ipv6 outside subnets", path: "/update/", realIP: "2001:db8::1", expectedStatus: http.StatusForbidden},
+		{name: "ipv4 mapped to ipv6", path: "/update/", realIP: "::ffff:10.0.0.1", expectedStatus: http.StatusOK},
+		{name: "url update", path: "/update/gauge/Alloc/1", realIP: "8.8.8.8", expectedStatus: http.StatusForbidden},
+		{name: "missing header", path: "/update/", expectedStatus: http.StatusForbidden},
+		{name: "garbage header", path: "/update/", realIP: "10.0.0.1, 8.8.8.8", expectedStatus: http.StatusForbidden},
+		{name: "reads are not filtered", method: http.MethodGet, path: "/value/gauge/Alloc", realIP: "8.8.8.8", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(TrustedSubnetMiddleware(subnets))
+			router.Any("/*path", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req := httptest.NewRequest(method, tt.path, nil)
+			if tt.realIP != "" {
+				req.Header.Set(utils.RealIPHeader, tt.realIP)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+
+	t.Run("no subnets accepts any", func(t *testing.T) {
+		router := gin.New()
+		router.Use(TrustedSubnetMiddleware(nil))
+		router.POST("/update/", func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/update/", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// BatchIDHeader — заголовок с идентификатором пачки /updates/. Повторная отправка
+// той же пачки (например, ретрай после таймаута) подтверждается, но не применяется.
+const BatchIDHeader = "X-Batch-ID"
+
+// MaxBatchIDLen ограничивает длину идентификатора пачки.
+const MaxBatchIDLen = 128
+
+// DedupPolicy задаёт, сколько помнить применённые пачки. Нулевой TTL отключает дедупликацию.
+// Size ограничивает число пачек, которые сервер держит в памяти.
+type DedupPolicy struct {
+	TTL  time.Duration
+	Size int
+}
@@ -0,0 +1,112 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var ErrBucketsMismatch = errors.New("histogram buckets do not match the stored series")
+
+// ValidateHistogram проверяет, что границы корзин строго возрастают,
+// а накопленные счётчики не убывают и не превышают Count.
+func ValidateHistogram(m Metrics) error {
+	if m.Count == nil || m.Sum == nil {
+		return errors.New("'count' and 'sum' are required")
+	}
+	if *m.Count < 0 {
+		return errors.New("'count' must not be negative")
+	}
+
+	var prev *Bucket
+	for i := range m.Buckets {
+		b := &m.Buckets[i]
+		if b.Count < 0 || b.Count > *m.Count {
+			return fmt.Errorf("bucket le=%v: count must be within [0, count]", b.UpperBound)
+		}
+		if prev != nil && (b.UpperBound <= prev.UpperBound || b.Count < prev.Count) {
+			return fmt.Errorf("bucket le=%v: buckets must be sorted and cumulative", b.UpperBound)
+		}
+		prev = b
+	}
+
+	return nil
+}
+
+// ValidateSummary проверяет, что квантили лежат в [0, 1].
+func ValidateSummary(m Metrics) error {
+	if m.Count == nil || m.Sum == nil {
+		return errors.New("'count' and 'sum' are required")
+	}
+
+	for _, q := range m.Quantiles {
+		if q.Quantile < 0 || q.Quantile > 1 {
+			return fmt.Errorf("quantile %v must be within [0, 1]", q.Quantile)
+		}
+	}
+
+	return nil
+}
+
+// MergeHistogram прибавляет наблюдения delta к накопленной гистограмме stored.
+// Границы корзин должны совпадать, если stored не пустая.
+func MergeHistogram(stored *Metrics, delta Metrics) error {
+	if stored.Count == nil {
+		count, sum := *delta.Count, *delta.Sum
+		stored.Count, stored.Sum = &count, &sum
+		stored.Buckets = append([]Bucket(nil), delta.Buckets...)
+		return nil
+	}
+
+	if len(stored.Buckets) != len(delta.Buckets) {
+		return ErrBucketsMismatch
+	}
+	for i := range stored.Buckets {
+		if stored.Buckets[i].UpperBound != delta.Buckets[i].UpperBound {
+			return ErrBucketsMismatch
+		}
+	}
+
+	count, sum := *stored.Count+*delta.Count, *stored.Sum+*delta.Sum
+	stored.Count, stored.Sum = &count, &sum
+
+	buckets := make([]Bucket, len(stored.Buckets))
+	for i := range stored.Buckets {
+		buckets[i] = Bucket{
+			UpperBound: stored.Buckets[i].UpperBound,
+			Count:      stored.Buckets[i].Count + delta.Buckets[i].Count,
+		}
+	}
+	stored.Buckets = buckets
+
+	return nil
+}
+
+// Observation возвращает гистограмму из одного наблюдения value с границами bounds.
+func Observation(value float64, bounds []float64) Metrics {
+	count, sum := int64(1), value
+
+	sorted := append([]float64(nil), bounds...)
+	sort.Float64s(sorted)
+
+	buckets := make([]Bucket, 0, len(sorted))
+	for _, le := range sorted {
+		var c int64
+		if value <= le {
+			c = 1
+		}
+		buckets = append(buckets, Bucket{UpperBound: le, Count: c})
+	}
+
+	return Metrics{MType: Histogram, Count: &count, Sum: &sum, Buckets: buckets}
+}
+
+// Bounds возвращает верхние границы корзин гистограммы.
+func (m Metrics) Bounds() []float64 {
+	bounds := make([]float64, 0, len(m.Buckets))
+	for _, b := range m.Buckets {
+		bounds = append(bounds, b.UpperBound)
+	}
+
+	return bounds
+}
@@ -0,0 +1,81 @@
+package model
+
+import "time"
+
+const (
+	AggRate     = "rate"
+	AggIncrease = "increase"
+	AggAvg      = "avg"
+	AggMin      = "min"
+	AggMax      = "max"
+	AggP50      = "p50"
+	AggP95      = "p95"
+	AggP99      = "p99"
+)
+
+// Aggregations — допустимые агрегатные функции для каждого типа метрики.
+var Aggregations = map[string][]string{
+	Counter: {AggRate, AggIncrease},
+	Gauge:   {AggAvg, AggMin, AggMax, AggP50, AggP95, AggP99},
+}
+
+// Quantiles — уровни квантилей для агрегатных функций pNN.
+var Quantiles = map[string]float64{
+	AggP50: 0.5,
+	AggP95: 0.95,
+	AggP99: 0.99,
+}
+
+const (
+	ResolutionRaw    time.Duration = 0
+	ResolutionMinute               = time.Minute
+	ResolutionHour                 = time.Hour
+)
+
+// RetentionPolicy задаёт, сколько хранить сырые значения и минутные/часовые агрегаты.
+// Нулевой Raw отключает компактизацию: сырые значения хранятся без ограничения.
+type RetentionPolicy struct {
+	Raw    time.Duration
+	Minute time.Duration
+	Hour   time.Duration
+}
+
+// Sample — значение серии в момент времени. Для counter хранится накопленное значение.
+type Sample struct {
+	Timestamp time.Time `json:"t"`
+	Value     float64   `json:"v"`
+}
+
+// Rollup — агрегат значений серии за интервал Resolution, начинающийся в Timestamp.
+type Rollup struct {
+	Timestamp time.Time
+	Count     int64
+	Sum       float64
+	Min       float64
+	Max       float64
+	Last      float64
+}
+
+// RangeQuery описывает запрос истории серии за интервал [From, To].
+// Step, если задан, разбивает интервал на корзины, в каждую из которых попадает последнее значение.
+// Agg задаёт агрегатную функцию, применяемую к значениям каждой корзины.
+// Resolution выбирает источник: сырые значения или минутные/часовые агрегаты.
+type RangeQuery struct {
+	Tenant     string
+	ID         string
+	MType      string
+	Labels     Labels
+	From       time.Time
+	To         time.Time
+	Step       time.Duration
+	Agg        string
+	Resolution time.Duration
+}
+
+type Series struct {
+	ID     string   `json:"id"`
+	MType  string   `json:"type"`
+	Labels Labels   `json:"labels,omitempty"`
+	Agg    string   `json:"agg,omitempty"`
+	Points []Sample `json:"points"`
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Labels — набор пар ключ/значение, который вместе с ID определяет серию.
+type Labels map[string]string
+
+// String возвращает каноническое представление вида {a="1",b="2"}
+// с отсортированными ключами. Пары с пустым ключом или значением не учитываются,
+// для пустого набора возвращается "".
+func (l Labels) String() string {
+	keys := make([]string, 0, len(l))
+	for k, v := range l {
+		if k == "" || v == "" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, "%s=%q", k, l[k])
+	}
+	sb.WriteByte('}')
+
+	return sb.String()
+}
+
+// Normalize возвращает не-nil копию набора без пустых ключей и значений.
+func (l Labels) Normalize() Labels {
+	res := make(Labels, len(l))
+	for k, v := range l {
+		if k == "" || v == "" {
+			continue
+		}
+		res[k] = v
+	}
+
+	return res
+}
+
+// SeriesKey — ключ серии: имя метрики вместе с лейблами.
+func SeriesKey(id string, labels Labels) string {
+	return id + labels.String()
+}
+
+// TenantSeriesKey — ключ серии внутри арендатора. Для арендатора по умолчанию
+// совпадает с SeriesKey, так что данные, записанные до появления арендаторов, не теряются.
+func TenantSeriesKey(tenant, id string, labels Labels) string {
+	if tenant == "" {
+		return SeriesKey(id, labels)
+	}
+
+	return "\x00" + tenant + "\x00" + SeriesKey(id, labels)
+}
+
+// ParseLabels разбирает строку вида "a=1,b=2".
+func ParseLabels(s string) (Labels, error) {
+	labels := make(Labels)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		k, v, ok := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("bad label %q, expected key=value", pair)
+		}
+		labels[k] = strings.TrimSpace(v)
+	}
+
+	return labels, nil
+}
@@ -1,8 +1,10 @@
 package model
 
 const (
-	Counter = "counter"
-	Gauge   = "gauge"
+	Counter   = "counter"
+	Gauge     = "gauge"
+	Histogram = "histogram"
+	Summary   = "summary"
 )
 
 // NOTE: Не усложняем пример, вводя иерархическую вложенность структур.
@@ -16,4 +18,38 @@ type Metrics struct {
 	Delta *int64   `json:"delta,omitempty"`
 	Value *float64 `json:"value,omitempty"`
 	Hash  string   `json:"hash,omitempty"`
+
+	Labels Labels `json:"labels,omitempty"`
+
+	// Tenant — пространство имён агента. Проставляется сервером по проверенному
+	// ключу агента и в JSON не читается и не выводится.
+	Tenant string `json:"-"`
+
+	// Поля histogram и summary. Count и Sum — количество и сумма наблюдений,
+	// Buckets — накопленные счётчики по верхним границам (корзина +Inf равна Count),
+	// Quantiles — значения квантилей summary.
+	Count     *int64     `json:"count,omitempty"`
+	Sum       *float64   `json:"sum,omitempty"`
+	Buckets   []Bucket   `json:"buckets,omitempty"`
+	Quantiles []Quantile `json:"quantiles,omitempty"`
+}
+
+type Bucket struct {
+	UpperBound float64 `json:"le"`
+	Count      int64   `json:"count"`
+}
+
+type Quantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+// IsKnownType сообщает, поддерживается ли тип метрики.
+func IsKnownType(mType string) bool {
+	switch mType {
+	case Counter, Gauge, Histogram, Summary:
+		return true
+	}
+
+	return false
 }
@@ -0,0 +1,179 @@
+// Package replay защищает подписанные запросы от повторной отправки.
+// Агент добавляет к запросу время отправки и случайный nonce, оба входят в подпись.
+// Сервер отклоняет запросы со временем вне допустимого окна и с уже виденным nonce.
+package replay
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/utils"
+)
+
+const (
+	TimestampHeader = "X-Timestamp"
+	NonceHeader     = "X-Nonce"
+
+	// maxNonceLen ограничивает память, которую один запрос занимает в кэше.
+	maxNonceLen = 64
+)
+
+var (
+	ErrMissing  = errors.New("timestamp and nonce are required")
+	ErrBadNonce = errors.New("bad nonce")
+	ErrStale    = errors.New("timestamp is outside of allowed window")
+	ErrReplay   = errors.New("nonce was already used")
+	ErrFull     = errors.New("nonce cache is full, retry later")
+)
+
+// Payload возвращает строку, которая подписывается вместо голого тела запроса.
+func Payload(timestamp, nonce, body string) string {
+	return timestamp + "\n" + nonce + "\n" + body
+}
+
+// HeaderPayload возвращает подписываемую строку для тела запроса с заголовками h.
+// Запросы без времени и nonce подписываются по-старому, только телом.
+func HeaderPayload(h http.Header, body string) string {
+	timestamp, nonce := h.Get(TimestampHeader), h.Get(NonceHeader)
+	if timestamp == "" && nonce == "" {
+		return body
+	}
+
+	return Payload(timestamp, nonce, body)
+}
+
+// Sign подписывает body ключом key с новыми временем и nonce и записывает подпись
+// в заголовки h. Вызывается перед каждой попыткой отправки: повтор с прежним
+// nonce сервер примет только как дубликат уже применённой пачки.
+func Sign(h http.Header, body, key string) error {
+	timestamp, nonce, err := Stamp()
+	if err != nil {
+		return err
+	}
+
+	h.Set("HashSHA256", utils.GenerateSHA256(Payload(timestamp, nonce, body), key))
+	h.Set(TimestampHeader, timestamp)
+	h.Set(NonceHeader, nonce)
+
+	return nil
+}
+
+type replayedKey struct{}
+
+// WithReplayed помечает запрос, nonce которого уже встречался, но решение о нём
+// отложено: повтор пачки /updates/ подтверждается, если пачка уже применена.
+func WithReplayed(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replayedKey{}, true)
+}
+
+// Replayed сообщает, помечен ли запрос через WithReplayed.
+func Replayed(ctx context.Context) bool {
+	replayed, _ := ctx.Value(replayedKey{}).(bool)
+	return replayed
+}
+
+// Stamp возвращает время отправки и новый nonce для подписи запроса.
+func Stamp() (string, string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("cannot generate nonce: %w", err)
+	}
+
+	return strconv.FormatInt(time.Now().Unix(), 10), hex.EncodeToString(buf), nil
+}
+
+type seen struct {
+	nonce string
+	ts    time.Time
+}
+
+// Guard проверяет время и уникальность nonce подписанных запросов.
+// Nonce хранятся, пока их время не выйдет из окна: запрос с таким временем
+// всё равно будет отклонён как устаревший. Раньше nonce не забываются:
+// иначе, завалив кэш свежими nonce, можно было бы повторить старый запрос.
+// Если кэш переполнен, новые запросы отклоняются с ErrFull, пока записи не устареют.
+type Guard struct {
+	window time.Duration
+	size   int
+	now    func() time.Time
+
+	mu    sync.Mutex
+	nonce map[string]struct{}
+	order []seen
+}
+
+// NewGuard создаёт проверку с окном ±window вокруг времени сервера
+// и кэшем не больше чем на size nonce. Нулевое окно выключает проверку: вернётся nil.
+func NewGuard(window time.Duration, size int) *Guard {
+	if window <= 0 {
+		return nil
+	}
+
+	return &Guard{
+		window: window,
+		size:   size,
+		now:    time.Now,
+		nonce:  make(map[string]struct{}),
+	}
+}
+
+// Check принимает значения заголовков TimestampHeader и NonceHeader и запоминает nonce.
+// Вызывается после проверки подписи, чтобы чужой запрос не занял nonce агента.
+func (g *Guard) Check(timestamp, nonce string) error {
+	if timestamp == "" || nonce == "" {
+		return ErrMissing
+	}
+	if len(nonce) > maxNonceLen {
+		return ErrBadNonce
+	}
+
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad timestamp %q: %w", timestamp, err)
+	}
+	ts := time.Unix(sec, 0)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// время берётся под блокировкой, чтобы очередь оставалась упорядоченной
+	now := g.now()
+	if ts.Before(now.Add(-g.window)) || ts.After(now.Add(g.window)) {
+		return ErrStale
+	}
+
+	g.expire(now)
+	if _, ok := g.nonce[nonce]; ok {
+		return ErrReplay
+	}
+	if len(g.order) >= g.size {
+		return ErrFull
+	}
+	g.nonce[nonce] = struct{}{}
+	g.order = append(g.order, seen{nonce: nonce, ts: now})
+
+	return nil
+}
+
+// expire удаляет nonce, записанные раньше начала окна. Записи идут по времени
+// сервера, поэтому устаревшие всегда в начале очереди.
+func (g *Guard) expire(now time.Time) {
+	// запрос с временем в будущем принимается до now+window и живёт в окне до now+2*window
+	cutoff := now.Add(-2 * g.window)
+	for len(g.order) > 0 && g.order[0].ts.Before(cutoff) {
+		g.evict()
+	}
+}
+
+func (g *Guard) evict() {
+	delete(g.nonce, g.order[0].nonce)
+	g.order[0] = seen{}
+	g.order = g.order[1:]
+}
@@ -0,0 +1,76 @@
+package replay
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestGuard(size int) (*Guard, *time.Time) {
+	now := time.Unix(1_700_000_000, 0)
+	g := NewGuard(time.Minute, size)
+	g.now = func() time.Time { return now }
+
+	return g, &now
+}
+
+func unix(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+func TestCheck(t *testing.T) {
+	g, now := newTestGuard(10)
+	assert.NoError(t, g.Check(unix(*now), "used"))
+
+	tests := []struct {
+		name      string
+		timestamp string
+		nonce     string
+		wantErr   error
+	}{
+		{name: "fresh", timestamp: unix(*now), nonce: "a"},
+		{name: "skew inside window", timestamp: unix(now.Add(-time.Minute)), nonce: "b"},
+		{name: "clock ahead inside window", timestamp: unix(now.Add(time.Minute)), nonce: "c"},
+		{name: "replay", timestamp: unix(*now), nonce: "used", wantErr: ErrReplay},
+		{name: "too old", timestamp: unix(now.Add(-2 * time.Minute)), nonce: "d", wantErr: ErrStale},
+		{name: "too far ahead", timestamp: unix(now.Add(2 * time.Minute)), nonce: "e", wantErr: ErrStale},
+		{name: "missing nonce", timestamp: unix(*now), wantErr: ErrMissing},
+		{name: "missing timestamp", nonce: "f", wantErr: ErrMissing},
+		{name: "long nonce", timestamp: unix(*now), nonce: string(make([]byte, 65)), wantErr: ErrBadNonce},
+		{name: "bad timestamp", timestamp: "yesterday", nonce: "g", wantErr: strconv.ErrSyntax},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := g.Check(tt.timestamp, tt.nonce)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCacheBounds(t *testing.T) {
+	g, now := newTestGuard(2)
+
+	for _, nonce := range []string{"a", "b"} {
+		assert.NoError(t, g.Check(unix(*now), nonce))
+	}
+	// переполненный кэш не вытесняет nonce, которые ещё в окне
+	assert.ErrorIs(t, g.Check(unix(*now), "c"), ErrFull)
+	assert.Len(t, g.order, 2)
+	assert.ErrorIs(t, g.Check(unix(*now), "a"), ErrReplay)
+
+	// за пределами двух окон nonce забываются, их время уже не пройдёт проверку
+	*now = now.Add(3 * time.Minute)
+	assert.NoError(t, g.Check(unix(*now), "c"))
+	assert.Len(t, g.order, 1)
+}
+
+func TestNewGuardDisabled(t *testing.T) {
+	assert.Nil(t, NewGuard(0, 10))
+}
@@ -0,0 +1,66 @@
+package bolt
+
+import (
+	"context"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/repository"
+	bbolt "go.etcd.io/bbolt"
+)
+
+func init() {
+	repository.Register("bolt", newBoltBackend)
+}
+
+// buckets — по одному bolt-бакету на тип метрики, ключ — model.SeriesKey.
+var buckets = []string{model.Counter, model.Gauge, model.Histogram, model.Summary}
+
+type boltRepository struct {
+	db *bbolt.DB
+}
+
+// NewBoltRepository открывает (или создаёт) файл базы. Каждая запись — отдельная
+// транзакция с fsync, поэтому после падения процесса теряются только незавершённые обновления.
+func NewBoltRepository(path string) (repository.Backend, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range buckets {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &boltRepository{
+		db: db,
+	}, nil
+}
+
+func newBoltBackend(_ context.Context, opts repository.Options) (repository.Backend, error) {
+	return NewBoltRepository(opts.Server.BoltPath)
+}
+
+// Snapshot ничего не делает: каждая транзакция уже сброшена на диск.
+func (rep *boltRepository) Snapshot(_ context.Context) error {
+	return nil
+}
+
+func (rep *boltRepository) Health(_ context.Context) error {
+	return rep.db.View(func(_ *bbolt.Tx) error {
+		return nil
+	})
+}
+
+func (rep *boltRepository) Close() error {
+	return rep.db.Close()
+}
@@ -0,0 +1,128 @@
+package bolt
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func openTestRepository(t *testing.T, path string) repository.Backend {
+	t.Helper()
+
+	rep, err := NewBoltRepository(path)
+	require.NoError(t, err)
+
+	return rep
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	labels := model.Labels{"host": "a"}
+
+	latency := model.Observation(0.3, []float64{0.1, 0.5})
+	latency.ID = "Latency"
+
+	rep := openTestRepository(t, path)
+	require.NoError(t, rep.Update(ctx, model.Metrics{ID: "PollCount", MType: model.Counter, Labels: labels, Delta: ptr(int64(2))}))
+	require.NoError(t, rep.Updates(ctx, []model.Metrics{
+		{ID: "PollCount", MType: model.Counter, Labels: labels, Delta: ptr(int64(3))},
+		{ID: "Alloc", MType: model.Gauge, Value: ptr(1.5)},
+		{ID: "Alloc", MType: model.Gauge, Value: ptr(2.5)},
+		latency,
+		latency,
+		{ID: "RPC", MType: model.Summary, Count: ptr(int64(4)), Sum: ptr(2.0), Quantiles: []model.Quantile{{Quantile: 0.5, Value: 0.4}}},
+	}))
+	require.NoError(t, rep.Close())
+
+	// значения переживают повторное открытие файла
+	rep = openTestRepository(t, path)
+	defer rep.Close()
+
+	m, err := rep.Read(ctx, "", model.Counter, "PollCount", labels)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *m.Delta)
+
+	m, err = rep.Read(ctx, "", model.Gauge, "Alloc", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, *m.Value)
+
+	m, err = rep.Read(ctx, "", model.Histogram, "Latency", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *m.Count)
+	assert.Equal(t, []model.Bucket{{UpperBound: 0.1, Count: 0}, {UpperBound: 0.5, Count: 2}}, m.Buckets)
+
+	m, err = rep.Read(ctx, "", model.Summary, "RPC", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), *m.Count)
+
+	_, err = rep.Read(ctx, "", model.Counter, "PollCount", nil)
+	assert.True(t, errors.Is(err, repository.ErrNotFound))
+
+	all, err := rep.ReadAll(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, all, 4)
+}
+
+func TestUpdatesAreAtomic(t *testing.T) {
+	ctx := context.Background()
+	rep := openTestRepository(t, filepath.Join(t.TempDir(), "metrics.db"))
+	defer rep.Close()
+
+	latency := model.Observation(0.3, []float64{0.1, 0.5})
+	latency.ID = "Latency"
+	require.NoError(t, rep.Update(ctx, latency))
+
+	other := model.Observation(0.3, []float64{1})
+	other.ID = "Latency"
+	err := rep.Updates(ctx, []model.Metrics{
+		{ID: "PollCount", MType: model.Counter, Delta: ptr(int64(1))},
+		other,
+	})
+	assert.ErrorIs(t, err, model.ErrBucketsMismatch)
+
+	_, err = rep.Read(ctx, "", model.Counter, "PollCount", nil)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestTenantIsolation(t *testing.T) {
+	ctx := context.Background()
+	rep := openTestRepository(t, filepath.Join(t.TempDir(), "metrics.db"))
+	defer rep.Close()
+
+	labels := model.Labels{"host": "a"}
+	require.NoError(t, rep.Updates(ctx, []model.Metrics{
+		{ID: "PollCount", MType: model.Counter, Labels: labels, Delta: ptr(int64(1))},
+		{Tenant: "team-a", ID: "PollCount", MType: model.Counter, Labels: labels, Delta: ptr(int64(10))},
+		{Tenant: "team-b", ID: "PollCount", MType: model.Counter, Labels: labels, Delta: ptr(int64(100))},
+		{Tenant: "team-b", ID: "Alloc", MType: model.Gauge, Value: ptr(1.5)},
+	}))
+
+	for tenant, expected := range map[string]int64{"": 1, "team-a": 10, "team-b": 100} {
+		m, err := rep.Read(ctx, tenant, model.Counter, "PollCount", labels)
+		require.NoError(t, err)
+		assert.Equal(t, expected, *m.Delta)
+	}
+
+	_, err := rep.Read(ctx, "team-a", model.Gauge, "Alloc", nil)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	for tenant, expected := range map[string]int{"": 1, "team-a": 1, "team-b": 2, "team-c": 0} {
+		all, err := rep.ReadAll(ctx, tenant)
+		require.NoError(t, err)
+		assert.Len(t, all, expected, tenant)
+		for _, m := range all {
+			assert.Equal(t, tenant, m.Tenant)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package bolt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/repository"
+	bbolt "go.etcd.io/bbolt"
+)
+
+func (rep *boltRepository) Read(_ context.Context, tenant, mType, name string, labels model.Labels) (model.Metrics, error) {
+	var m model.Metrics
+
+	err := rep.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(mType))
+		if b == nil {
+			return fmt.Errorf("%w: unknown type '%s'", repository.ErrNotFound, mType)
+		}
+
+		found, err := get(b, tenant, name, labels)
+		if err != nil {
+			return err
+		}
+		if found == nil {
+			return fmt.Errorf("%w: %s metric '%s'", repository.ErrNotFound, mType, model.SeriesKey(name, labels))
+		}
+		m = *found
+
+		return nil
+	})
+
+	return m, err
+}
+
+// ReadAll проходит по всем бакетам в одной транзакции чтения и собирает
+// серии арендатора в один срез.
+func (rep *boltRepository) ReadAll(_ context.Context, tenant string) ([]model.Metrics, error) {
+	metrics := make([]model.Metrics, 0)
+
+	err := rep.db.View(func(tx *bbolt.Tx) error {
+		for _, name := range buckets {
+			err := tx.Bucket([]byte(name)).ForEach(func(_, v []byte) error {
+				m, err := decode(v)
+				if err != nil {
+					return err
+				}
+				if m.Tenant == tenant {
+					metrics = append(metrics, m)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return metrics, nil
+}
+
+func get(b *bbolt.Bucket, tenant, name string, labels model.Labels) (*model.Metrics, error) {
+	v := b.Get([]byte(model.TenantSeriesKey(tenant, name, labels)))
+	if v == nil {
+		return nil, nil
+	}
+
+	m, err := decode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// record — значение серии в бакете. Арендатор хранится отдельным полем:
+// в JSON model.Metrics он не попадает.
+type record struct {
+	model.Metrics
+	Tenant string `json:"tenant,omitempty"`
+}
+
+func decode(v []byte) (model.Metrics, error) {
+	var r record
+	if err := json.Unmarshal(v, &r); err != nil {
+		return model.Metrics{}, err
+	}
+	r.Metrics.Tenant = r.Tenant
+
+	return r.Metrics, nil
+}
+
+func encode(m model.Metrics) ([]byte, error) {
+	return json.Marshal(record{Metrics: m, Tenant: m.Tenant})
+}
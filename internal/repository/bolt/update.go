@@ -0,0 +1,67 @@
+package bolt
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/7StaSH7/gometrics/internal/model"
+	bbolt "go.etcd.io/bbolt"
+)
+
+func (rep *boltRepository) Update(_ context.Context, m model.Metrics) error {
+	return rep.db.Update(func(tx *bbolt.Tx) error {
+		return update(tx, m)
+	})
+}
+
+// Updates применяет пачку в одной транзакции: либо все обновления, либо ни одного.
+func (rep *boltRepository) Updates(_ context.Context, metrics []model.Metrics) error {
+	return rep.db.Update(func(tx *bbolt.Tx) error {
+		for _, m := range metrics {
+			if err := update(tx, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func update(tx *bbolt.Tx, m model.Metrics) error {
+	b := tx.Bucket([]byte(m.MType))
+	if b == nil {
+		return fmt.Errorf("unknown type '%s'", m.MType)
+	}
+
+	stored, err := get(b, m.Tenant, m.ID, m.Labels)
+	if err != nil {
+		return err
+	}
+
+	next := model.Metrics{Tenant: m.Tenant, ID: m.ID, MType: m.MType, Labels: m.Labels.Normalize()}
+	switch m.MType {
+	case model.Counter:
+		delta := *m.Delta
+		if stored != nil {
+			delta += *stored.Delta
+		}
+		next.Delta = &delta
+	case model.Gauge:
+		next.Value = m.Value
+	case model.Histogram:
+		if stored != nil {
+			next = *stored
+		}
+		if err := model.MergeHistogram(&next, m); err != nil {
+			return err
+		}
+	case model.Summary:
+		next.Count, next.Sum, next.Quantiles = m.Count, m.Sum, m.Quantiles
+	}
+
+	v, err := encode(next)
+	if err != nil {
+		return err
+	}
+
+	return b.Put([]byte(model.TenantSeriesKey(m.Tenant, m.ID, m.Labels)), v)
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/repository"
+)
+
+// UpdatesOnce записывает идентификатор пачки в applied_batches в той же транзакции,
+// что и метрики: пачка либо применена и запомнена, либо ни то ни другое.
+// Одновременный повтор ждёт на уникальном ключе, пока оригинал не завершится.
+func (rep *databaseRepository) UpdatesOnce(ctx context.Context, tenant, batchID string, metrics []model.Metrics) (err error) {
+	tx, err := rep.startTransaction(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		rep.introspectTransaction(ctx, tx, err)
+	}()
+
+	// устаревшие пачки удаляет ExpireBatches из цикла сжатия; запись старше TTL,
+	// которую он ещё не удалил, не мешает применить пачку заново
+	now := time.Now()
+	tag, err := tx.Exec(ctx, `
+		insert into applied_batches (tenant, batch_id, applied_at) values ($1, $2, $3)
+		on conflict (tenant, batch_id) do update set applied_at = excluded.applied_at
+		where applied_batches.applied_at < $4
+	`, tenant, batchID, now, now.Add(-rep.batchTTL))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		err = repository.ErrDuplicateBatch
+		return err
+	}
+
+	for _, m := range metrics {
+		if err = rep.update(ctx, tx, m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (rep *databaseRepository) BatchApplied(ctx context.Context, tenant, batchID string) (bool, error) {
+	var applied bool
+	err := rep.db.QueryRow(ctx, `
+		select exists (select 1 from applied_batches where tenant = $1 and batch_id = $2 and applied_at >= $3)
+	`, tenant, batchID, time.Now().Add(-rep.batchTTL)).Scan(&applied)
+
+	return applied, err
+}
+
+func (rep *databaseRepository) ExpireBatches(ctx context.Context, before time.Time) error {
+	_, err := rep.db.Exec(ctx, `delete from applied_batches where applied_at < $1`, before)
+
+	return err
+}
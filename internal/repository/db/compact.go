@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pgerrors "github.com/7StaSH7/gometrics/internal/config/db/errors"
+	"github.com/7StaSH7/gometrics/internal/model"
+)
+
+// rollupSQL сворачивает завершившиеся интервалы источника в агрегаты разрешения resolution.
+// Отметка свёрнутого ведётся для каждой серии отдельно, и последние два интервала серии
+// сворачиваются заново: значение, записанное транзакцией, которая закоммитилась после
+// прошлого сжатия, попадает в свой агрегат. Пересчёт не уменьшает агрегат, поэтому
+// частично удалённый по сроку хранения источник не портит уже свёрнутое.
+func rollupSQL(resolution time.Duration) string {
+	seconds := int(resolution.Seconds())
+
+	source := `
+		select tenant, id, labels, mType, ts, 1 as count, value as sum, value as min, value as max, value as last
+		from metric_samples
+	`
+	if resolution == model.ResolutionHour {
+		source = fmt.Sprintf(`
+			select tenant, id, labels, mType, ts, count, sum, min, max, last
+			from metric_rollups
+			where resolution = %d
+		`, int(model.ResolutionMinute.Seconds()))
+	}
+
+	return fmt.Sprintf(`
+		with marks as (
+			select tenant, id, mType, labels, max(ts) - interval '%[1]d seconds' as since
+			from metric_rollups
+			where resolution = %[1]d
+			group by tenant, id, mType, labels
+		)
+		insert into metric_rollups (tenant, id, labels, mType, resolution, ts, count, sum, min, max, last)
+		select src.tenant, src.id, src.labels, src.mType, %[1]d,
+			to_timestamp(floor(extract(epoch from src.ts) / %[1]d) * %[1]d) as bucket,
+			sum(src.count), sum(src.sum), min(src.min), max(src.max), (array_agg(src.last order by src.ts desc))[1]
+		from (%[2]s) src
+		left join marks m
+			on m.tenant = src.tenant and m.id = src.id and m.mType = src.mType and m.labels = src.labels
+		where src.ts < $1 and src.ts >= coalesce(m.since, '-infinity')
+		group by src.tenant, src.id, src.labels, src.mType, bucket
+		on conflict (tenant, id, mType, labels, resolution, ts) do update
+		set count = excluded.count, sum = excluded.sum, min = excluded.min, max = excluded.max, last = excluded.last
+		where excluded.count >= metric_rollups.count;
+	`, seconds, source)
+}
+
+func (rep *databaseRepository) Compact(ctx context.Context, now time.Time, policy model.RetentionPolicy) (err error) {
+	tx, err := rep.startTransaction(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		rep.introspectTransaction(ctx, tx, err)
+	}()
+
+	statements := []pgerrors.SQL{
+		{Query: rollupSQL(model.ResolutionMinute), Args: []any{now.Truncate(time.Minute)}},
+		{Query: rollupSQL(model.ResolutionHour), Args: []any{now.Truncate(time.Hour)}},
+		{Query: "delete from metric_samples where ts < $1;", Args: []any{now.Add(-policy.Raw)}},
+	}
+	if policy.Minute > 0 {
+		statements = append(statements, pgerrors.SQL{
+			Query: "delete from metric_rollups where resolution = $1 and ts < $2;",
+			Args:  []any{int(model.ResolutionMinute.Seconds()), now.Add(-policy.Minute)},
+		})
+	}
+	if policy.Hour > 0 {
+		statements = append(statements, pgerrors.SQL{
+			Query: "delete from metric_rollups where resolution = $1 and ts < $2;",
+			Args:  []any{int(model.ResolutionHour.Seconds()), now.Add(-policy.Hour)},
+		})
+	}
+
+	for _, sql := range statements {
+		if err = pgerrors.ExecuteWithRetry(ctx, nil, tx, sql); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -2,28 +2,44 @@ package db
 
 import (
 	"context"
+	"time"
 
-	"github.com/jackc/pgx/v5"
+	dbconfig "github.com/7StaSH7/gometrics/internal/config/db"
+	"github.com/7StaSH7/gometrics/internal/repository"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-type databaseRepository struct {
-	db *pgxpool.Pool
+func init() {
+	repository.Register("postgres", newPostgresBackend)
 }
 
-type DatabaseRepository interface {
-	StartTransaction(context.Context) (pgx.Tx, error)
-	IntrospectTransaction(ctx context.Context, tx pgx.Tx, err error)
-	Replace(ctx context.Context, tx pgx.Tx, name string, value float64) error
-	Add(ctx context.Context, tx pgx.Tx, name string, value int64) error
-	ReadCounter(string) (int64, error)
-	ReadGauge(string) (float64, error)
-	ReadAll() map[string]string
-	Ping() bool
+type databaseRepository struct {
+	db *pgxpool.Pool
+	// batchTTL — сколько помнить применённые пачки (см. UpdatesOnce)
+	batchTTL time.Duration
 }
 
-func NewDatabaseRepository(pool *pgxpool.Pool) DatabaseRepository {
+func NewDatabaseRepository(pool *pgxpool.Pool) repository.Backend {
 	return &databaseRepository{
 		db: pool,
 	}
 }
+
+func newPostgresBackend(ctx context.Context, opts repository.Options) (repository.Backend, error) {
+	pool, err := dbconfig.NewPostgresDriver(ctx, opts.Postgres)
+	if err != nil {
+		return nil, err
+	}
+
+	return &databaseRepository{db: pool, batchTTL: opts.Server.Dedup().TTL}, nil
+}
+
+func (rep *databaseRepository) Snapshot(_ context.Context) error {
+	return nil
+}
+
+func (rep *databaseRepository) Close() error {
+	rep.db.Close()
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/model"
+)
+
+// historySource возвращает подзапрос с колонками ts, value, vmin, vmax, vsum, vcount
+// для сырых значений или агрегатов нужного разрешения. К агрегатам добавляется
+// ещё не свёрнутый хвост серии из более подробного источника.
+// Параметры $1..$4 — tenant, id, mType и labels серии.
+func historySource(resolution time.Duration) string {
+	if resolution == model.ResolutionRaw {
+		return `
+			select ts, value, value as vmin, value as vmax, value as vsum, 1 as vcount
+			from metric_samples
+			where tenant = $1 and id = $2 and mType = $3 and labels = $4
+		`
+	}
+
+	finer := model.ResolutionRaw
+	if resolution == model.ResolutionHour {
+		finer = model.ResolutionMinute
+	}
+
+	return fmt.Sprintf(`
+		select ts, last as value, min as vmin, max as vmax, sum as vsum, count as vcount
+		from metric_rollups
+		where tenant = $1 and id = $2 and mType = $3 and labels = $4 and resolution = %[1]d
+		union all
+		select * from (%[2]s) tail
+		where tail.ts >= coalesce((
+			select max(ts) + interval '%[1]d seconds'
+			from metric_rollups
+			where tenant = $1 and id = $2 and mType = $3 and labels = $4 and resolution = %[1]d
+		), '-infinity')
+	`, int(resolution.Seconds()), historySource(finer))
+}
+
+func (rep *databaseRepository) ReadRange(ctx context.Context, q model.RangeQuery) ([]model.Sample, error) {
+	sql := `
+		with src as (` + historySource(q.Resolution) + `)
+		select ts, value from src
+		where ts between $5 and $6
+		order by ts;
+	`
+	rows, err := rep.db.Query(ctx, sql, q.Tenant, q.ID, q.MType, q.Labels.Normalize(), q.From, q.To)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := make([]model.Sample, 0)
+	for rows.Next() {
+		var s model.Sample
+		if err := rows.Scan(&s.Timestamp, &s.Value); err != nil {
+			return nil, err
+		}
+		samples = append(samples, s)
+	}
+
+	return samples, rows.Err()
+}
+
+func (rep *databaseRepository) Aggregate(ctx context.Context, q model.RangeQuery) ([]model.Sample, error) {
+	var sql string
+	args := []any{q.Tenant, q.ID, q.MType, q.Labels.Normalize(), q.From, q.To, q.Step.Seconds()}
+
+	switch q.Agg {
+	case model.AggRate, model.AggIncrease:
+		// прирост считается оконной функцией по всей серии до конца интервала,
+		// чтобы у первой точки интервала было предыдущее значение
+		sql = `
+			with src as (` + historySource(q.Resolution) + `),
+			deltas as (
+				select ts, value, value - coalesce(lag(value) over (order by ts), value) as delta
+				from src
+				where ts <= $6
+			)
+			select floor(extract(epoch from ts - $5::timestamptz) / $7)::bigint as bucket,
+				sum(case when delta < 0 then value else delta end)
+			from deltas
+			where ts >= $5
+			group by bucket
+			order by bucket;
+		`
+	default:
+		fn := "sum(vsum) / sum(vcount)"
+		switch q.Agg {
+		case model.AggMin:
+			fn = "min(vmin)"
+		case model.AggMax:
+			fn = "max(vmax)"
+		case model.AggP50, model.AggP95, model.AggP99:
+			// по агрегатам квантиль считается приближённо, по средним значениям
+			fn = "percentile_cont($8) within group (order by vsum / vcount)"
+			args = append(args, model.Quantiles[q.Agg])
+		}
+
+		sql = `
+			with src as (` + historySource(q.Resolution) + `)
+			select floor(extract(epoch from ts - $5::timestamptz) / $7)::bigint as bucket, ` + fn + `
+			from src
+			where ts between $5 and $6
+			group by bucket
+			order by bucket;
+		`
+	}
+
+	rows, err := rep.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := make([]model.Sample, 0)
+	for rows.Next() {
+		var bucket int64
+		var value float64
+		if err := rows.Scan(&bucket, &value); err != nil {
+			return nil, err
+		}
+
+		if q.Agg == model.AggRate {
+			value /= q.Step.Seconds()
+		}
+
+		samples = append(samples, model.Sample{
+			Timestamp: q.From.Add(time.Duration(bucket) * q.Step),
+			Value:     value,
+		})
+	}
+
+	return samples, rows.Err()
+}
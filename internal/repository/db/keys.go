@@ -0,0 +1,47 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/7StaSH7/gometrics/internal/auth"
+	dbconfig "github.com/7StaSH7/gometrics/internal/config/db"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type keyStore struct {
+	db *pgxpool.Pool
+}
+
+// NewKeyStore возвращает ключи агентов из таблицы agent_keys.
+// Ключи читаются при каждом запросе, так что изменения в таблице применяются сразу.
+func NewKeyStore(ctx context.Context, cfg *dbconfig.PostgresConfig) (auth.KeyStore, error) {
+	pool, err := dbconfig.NewPostgresDriver(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &keyStore{db: pool}, nil
+}
+
+func (s *keyStore) Lookup(ctx context.Context, agent string) (auth.Credential, error) {
+	cred := auth.Credential{Agent: agent}
+
+	err := s.db.QueryRow(ctx, "select key, tenant from agent_keys where agent = $1", agent).Scan(&cred.Key, &cred.Tenant)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return auth.Credential{}, fmt.Errorf("%w %q", auth.ErrUnknownAgent, agent)
+		}
+		return auth.Credential{}, err
+	}
+
+	return cred, nil
+}
+
+func (s *keyStore) Close() error {
+	s.db.Close()
+
+	return nil
+}
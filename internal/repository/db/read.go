@@ -2,64 +2,63 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/repository"
+	"github.com/jackc/pgx/v5"
 )
 
-func (rep *databaseRepository) ReadAll() map[string]string {
-	metrics := make(map[string]string, 0)
-	rows, err := rep.db.Query(context.Background(), "select id, value, delta from metrics;")
-	if err != nil {
-		return map[string]string{}
-	}
-	defer rows.Close()
+func (rep *databaseRepository) Read(ctx context.Context, tenant, mType, name string, labels model.Labels) (model.Metrics, error) {
+	m := model.Metrics{Tenant: tenant, ID: name, MType: mType, Labels: labels.Normalize()}
 
-	for rows.Next() {
-		var m model.Metrics
-		err = rows.Scan(&m.ID, &m.Value, &m.Delta)
-		if err != nil {
-			return map[string]string{}
-		}
-		if m.Value != nil {
-			metrics[m.ID] = fmt.Sprintf("%v", *m.Value)
-		}
-		if m.Delta != nil {
-			metrics[m.ID] = fmt.Sprintf("%v", *m.Delta)
+	var err error
+	switch mType {
+	case model.Counter:
+		err = rep.db.QueryRow(ctx, "select delta from metrics where tenant = $1 and id = $2 and labels = $3 and mType = 'counter'", tenant, name, labels.Normalize()).Scan(&m.Delta)
+	case model.Gauge:
+		err = rep.db.QueryRow(ctx, "select value from metrics where tenant = $1 and id = $2 and labels = $3 and mType = 'gauge'", tenant, name, labels.Normalize()).Scan(&m.Value)
+	case model.Histogram:
+		err = rep.db.QueryRow(ctx, "select count, sum, buckets from metrics where tenant = $1 and id = $2 and labels = $3 and mType = 'histogram'", tenant, name, labels.Normalize()).Scan(&m.Count, &m.Sum, &m.Buckets)
+	case model.Summary:
+		err = rep.db.QueryRow(ctx, "select count, sum, quantiles from metrics where tenant = $1 and id = $2 and labels = $3 and mType = 'summary'", tenant, name, labels.Normalize()).Scan(&m.Count, &m.Sum, &m.Quantiles)
+	default:
+		return model.Metrics{}, fmt.Errorf("%w: unknown type '%s'", repository.ErrNotFound, mType)
+	}
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.Metrics{}, fmt.Errorf("%w: %s metric '%s'", repository.ErrNotFound, mType, model.SeriesKey(name, labels))
 		}
+		return model.Metrics{}, err
 	}
 
-	return metrics
+	return m, nil
 }
 
-func (rep *databaseRepository) ReadCounter(name string) (int64, error) {
-	var res int64
-
-	if err := rep.db.QueryRow(context.Background(), "select delta from metrics where id = $1", name).Scan(&res); err != nil {
-		return 0, err
+func (rep *databaseRepository) ReadAll(ctx context.Context, tenant string) ([]model.Metrics, error) {
+	rows, err := rep.db.Query(ctx, "select id, labels, mType, delta, value, count, sum, buckets, quantiles from metrics where tenant = $1 order by id;", tenant)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return res, nil
-}
-
-func (rep *databaseRepository) ReadGauge(name string) (float64, error) {
-	var res float64
-
-	if err := rep.db.QueryRow(context.Background(), "select value from metrics where id = $1", name).Scan(&res); err != nil {
-		return 0, err
+	metrics := make([]model.Metrics, 0)
+	for rows.Next() {
+		m := model.Metrics{Tenant: tenant}
+		if err := rows.Scan(&m.ID, &m.Labels, &m.MType, &m.Delta, &m.Value, &m.Count, &m.Sum, &m.Buckets, &m.Quantiles); err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m)
 	}
 
-	return res, nil
+	return metrics, rows.Err()
 }
 
-func (rep *databaseRepository) Ping() bool {
+func (rep *databaseRepository) Health(ctx context.Context) error {
 	if rep.db == nil {
-		return false
-	}
-
-	if err := rep.db.Ping(context.Background()); err != nil {
-		return false
+		return errors.New("connection is nil")
 	}
 
-	return true
+	return rep.db.Ping(ctx)
 }
@@ -8,11 +8,11 @@ import (
 	"go.uber.org/zap"
 )
 
-func (rep *databaseRepository) StartTransaction(ctx context.Context) (pgx.Tx, error) {
+func (rep *databaseRepository) startTransaction(ctx context.Context) (pgx.Tx, error) {
 	return rep.db.Begin(ctx)
 }
 
-func (rep *databaseRepository) IntrospectTransaction(ctx context.Context, tx pgx.Tx, err error) {
+func (rep *databaseRepository) introspectTransaction(ctx context.Context, tx pgx.Tx, err error) {
 	if tx != nil {
 		var e error
 		if err != nil {
@@ -2,23 +2,69 @@ package db
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	pgerrors "github.com/7StaSH7/gometrics/internal/config/db/errors"
+	"github.com/7StaSH7/gometrics/internal/model"
 	"github.com/jackc/pgx/v5"
 )
 
-func (rep *databaseRepository) Add(ctx context.Context, tx pgx.Tx, name string, delta int64) error {
+func (rep *databaseRepository) Update(ctx context.Context, m model.Metrics) error {
+	return rep.update(ctx, nil, m)
+}
+
+func (rep *databaseRepository) Updates(ctx context.Context, metrics []model.Metrics) (err error) {
+	tx, err := rep.startTransaction(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		rep.introspectTransaction(ctx, tx, err)
+	}()
+
+	for _, m := range metrics {
+		if err = rep.update(ctx, tx, m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (rep *databaseRepository) update(ctx context.Context, tx pgx.Tx, m model.Metrics) error {
+	switch m.MType {
+	case model.Counter:
+		return rep.add(ctx, tx, m.Tenant, m.ID, m.Labels, *m.Delta)
+	case model.Gauge:
+		return rep.replace(ctx, tx, m.Tenant, m.ID, m.Labels, *m.Value)
+	case model.Histogram:
+		return rep.mergeHistogram(ctx, tx, m.Tenant, m.ID, m.Labels, m)
+	case model.Summary:
+		return rep.replaceSummary(ctx, tx, m.Tenant, m.ID, m.Labels, m)
+	}
+
+	return fmt.Errorf("unknown type '%s'", m.MType)
+}
+
+func (rep *databaseRepository) add(ctx context.Context, tx pgx.Tx, tenant, name string, labels model.Labels, delta int64) error {
 	sql := `
-		insert into metrics (id, mType, delta) values ($1,'counter', $2)
-		on conflict (id) do update
-    set	delta = metrics.delta + excluded.delta;
+		with upserted as (
+			insert into metrics (tenant, id, labels, mType, delta) values ($1, $2, $3, 'counter', $4)
+			on conflict (tenant, id, mType, labels) do update
+			set	delta = metrics.delta + excluded.delta
+			returning tenant, id, labels, delta
+		)
+		insert into metric_samples (tenant, id, labels, mType, ts, value)
+		select tenant, id, labels, 'counter', now(), delta from upserted;
   `
+	args := []any{tenant, name, labels.Normalize(), delta}
 	if tx != nil {
-		if err := pgerrors.ExecuteWithRetry(ctx, nil, tx, pgerrors.SQL{Query: sql, Args: []any{name, delta}}); err != nil {
+		if err := pgerrors.ExecuteWithRetry(ctx, nil, tx, pgerrors.SQL{Query: sql, Args: args}); err != nil {
 			return err
 		}
 	} else {
-		if err := pgerrors.ExecuteWithRetry(ctx, rep.db, nil, pgerrors.SQL{Query: sql, Args: []any{name, delta}}); err != nil {
+		if err := pgerrors.ExecuteWithRetry(ctx, rep.db, nil, pgerrors.SQL{Query: sql, Args: args}); err != nil {
 			return err
 		}
 	}
@@ -26,18 +72,79 @@ func (rep *databaseRepository) Add(ctx context.Context, tx pgx.Tx, name string,
 	return nil
 }
 
-func (rep *databaseRepository) Replace(ctx context.Context, tx pgx.Tx, name string, value float64) error {
+func (rep *databaseRepository) replace(ctx context.Context, tx pgx.Tx, tenant, name string, labels model.Labels, value float64) error {
 	sql := `
-		insert into metrics (id, mType, value) values ($1, 'gauge', $2)
-		on conflict (id) do update
-    set	value = excluded.value;
+		with upserted as (
+			insert into metrics (tenant, id, labels, mType, value) values ($1, $2, $3, 'gauge', $4)
+			on conflict (tenant, id, mType, labels) do update
+			set	value = excluded.value
+			returning tenant, id, labels, value
+		)
+		insert into metric_samples (tenant, id, labels, mType, ts, value)
+		select tenant, id, labels, 'gauge', now(), value from upserted;
   `
+	args := []any{tenant, name, labels.Normalize(), value}
+	if tx != nil {
+		if err := pgerrors.ExecuteWithRetry(ctx, nil, tx, pgerrors.SQL{Query: sql, Args: args}); err != nil {
+			return err
+		}
+	} else {
+		if err := pgerrors.ExecuteWithRetry(ctx, rep.db, nil, pgerrors.SQL{Query: sql, Args: args}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (rep *databaseRepository) mergeHistogram(ctx context.Context, tx pgx.Tx, tenant, name string, labels model.Labels, delta model.Metrics) (err error) {
+	if tx == nil {
+		tx, err = rep.startTransaction(ctx)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			rep.introspectTransaction(ctx, tx, err)
+		}()
+	}
+
+	stored := model.Metrics{Tenant: tenant, ID: name, MType: model.Histogram}
+	err = tx.QueryRow(ctx, `
+		select count, sum, buckets from metrics
+		where tenant = $1 and id = $2 and labels = $3 and mType = 'histogram'
+		for update;
+	`, tenant, name, labels.Normalize()).Scan(&stored.Count, &stored.Sum, &stored.Buckets)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	if err = model.MergeHistogram(&stored, delta); err != nil {
+		return err
+	}
+
+	sql := `
+		insert into metrics (tenant, id, labels, mType, count, sum, buckets) values ($1, $2, $3, 'histogram', $4, $5, $6)
+		on conflict (tenant, id, mType, labels) do update
+		set	count = excluded.count, sum = excluded.sum, buckets = excluded.buckets;
+	`
+	args := []any{tenant, name, labels.Normalize(), *stored.Count, *stored.Sum, stored.Buckets}
+
+	return pgerrors.ExecuteWithRetry(ctx, nil, tx, pgerrors.SQL{Query: sql, Args: args})
+}
+
+func (rep *databaseRepository) replaceSummary(ctx context.Context, tx pgx.Tx, tenant, name string, labels model.Labels, value model.Metrics) error {
+	sql := `
+		insert into metrics (tenant, id, labels, mType, count, sum, quantiles) values ($1, $2, $3, 'summary', $4, $5, $6)
+		on conflict (tenant, id, mType, labels) do update
+		set	count = excluded.count, sum = excluded.sum, quantiles = excluded.quantiles;
+	`
+	args := []any{tenant, name, labels.Normalize(), *value.Count, *value.Sum, value.Quantiles}
 	if tx != nil {
-		if err := pgerrors.ExecuteWithRetry(ctx, nil, tx, pgerrors.SQL{Query: sql, Args: []any{name, value}}); err != nil {
+		if err := pgerrors.ExecuteWithRetry(ctx, nil, tx, pgerrors.SQL{Query: sql, Args: args}); err != nil {
 			return err
 		}
 	} else {
-		if err := pgerrors.ExecuteWithRetry(ctx, rep.db, nil, pgerrors.SQL{Query: sql, Args: []any{name, value}}); err != nil {
+		if err := pgerrors.ExecuteWithRetry(ctx, rep.db, nil, pgerrors.SQL{Query: sql, Args: args}); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/config/db"
+	"github.com/7StaSH7/gometrics/internal/model"
+)
+
+var (
+	ErrNotFound           = errors.New("metric not found")
+	ErrUnknownBackend     = errors.New("unknown storage backend")
+	ErrHistoryUnsupported = errors.New("storage backend does not keep history")
+	ErrDuplicateBatch     = errors.New("batch was already applied")
+)
+
+// Backend — хранилище метрик. Реализации регистрируются через Register
+// и выбираются при старте сервера по имени из конфигурации.
+// Серии разных арендаторов (model.Metrics.Tenant) не пересекаются.
+type Backend interface {
+	// Update применяет одно обновление: counter и histogram накапливаются, gauge и summary заменяются.
+	Update(ctx context.Context, m model.Metrics) error
+	// Updates применяет пачку обновлений; если хранилище это поддерживает — атомарно.
+	Updates(ctx context.Context, metrics []model.Metrics) error
+	// Read возвращает текущее значение серии арендатора или ошибку, оборачивающую ErrNotFound.
+	Read(ctx context.Context, tenant, mType, name string, labels model.Labels) (model.Metrics, error)
+	// ReadAll возвращает все серии арендатора.
+	ReadAll(ctx context.Context, tenant string) ([]model.Metrics, error)
+	// Snapshot сбрасывает состояние на диск, если хранилище это умеет.
+	Snapshot(ctx context.Context) error
+	Health(ctx context.Context) error
+	Close() error
+}
+
+// History реализуют хранилища, которые ведут историю значений.
+// Арендатор запроса передаётся в model.RangeQuery.Tenant, Compact обрабатывает всех.
+type History interface {
+	ReadRange(ctx context.Context, q model.RangeQuery) ([]model.Sample, error)
+	Aggregate(ctx context.Context, q model.RangeQuery) ([]model.Sample, error)
+	Compact(ctx context.Context, now time.Time, policy model.RetentionPolicy) error
+}
+
+// Batches реализуют хранилища, которые сами помнят применённые пачки
+// и проверяют повтор в одной транзакции с записью метрик.
+// Для остальных хранилищ пачки помнит сервис, в памяти.
+type Batches interface {
+	// UpdatesOnce применяет пачку, если пачка batchID арендатора ещё не применялась,
+	// иначе возвращает ErrDuplicateBatch.
+	UpdatesOnce(ctx context.Context, tenant, batchID string, metrics []model.Metrics) error
+	// BatchApplied сообщает, помнит ли хранилище применённую пачку batchID арендатора.
+	BatchApplied(ctx context.Context, tenant, batchID string) (bool, error)
+	// ExpireBatches забывает пачки, применённые раньше before. Вызывается из цикла сжатия.
+	ExpireBatches(ctx context.Context, before time.Time) error
+}
+
+type Options struct {
+	Server   *config.ServerConfig
+	Postgres *db.PostgresConfig
+}
+
+type Factory func(ctx context.Context, opts Options) (Backend, error)
+
+var (
+	mu        sync.RWMutex
+	factories = make(map[string]Factory)
+)
+
+// Register делает хранилище доступным по имени. Вызывается из init пакета реализации.
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("storage backend %q registered twice", name))
+	}
+	factories[name] = factory
+}
+
+func New(ctx context.Context, name string, opts Options) (Backend, error) {
+	mu.RLock()
+	factory, ok := factories[name]
+	mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w %q, available: %v", ErrUnknownBackend, name, Names())
+	}
+
+	return factory(ctx, opts)
+}
+
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
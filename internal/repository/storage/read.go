@@ -1,13 +1,55 @@
 package storage
 
-func (rep *memStorageRepository) ReadAll() map[string]string {
-	return rep.storage.ReadAll()
+import (
+	"context"
+	"fmt"
+
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/repository"
+)
+
+func (rep *memStorageRepository) Read(_ context.Context, tenant, mType, name string, labels model.Labels) (model.Metrics, error) {
+	m := model.Metrics{Tenant: tenant, ID: name, MType: mType, Labels: labels.Normalize()}
+
+	var err error
+	switch mType {
+	case model.Counter:
+		var delta int64
+		delta, err = rep.storage.ReadCounter(tenant, name, labels)
+		m.Delta = &delta
+	case model.Gauge:
+		var value float64
+		value, err = rep.storage.ReadGauge(tenant, name, labels)
+		m.Value = &value
+	case model.Histogram:
+		m, err = rep.storage.ReadHistogram(tenant, name, labels)
+	case model.Summary:
+		m, err = rep.storage.ReadSummary(tenant, name, labels)
+	default:
+		err = fmt.Errorf("unknown type '%s'", mType)
+	}
+	if err != nil {
+		return model.Metrics{}, fmt.Errorf("%w: %v", repository.ErrNotFound, err)
+	}
+
+	return m, nil
+}
+
+func (rep *memStorageRepository) ReadAll(_ context.Context, tenant string) ([]model.Metrics, error) {
+	metrics := make([]model.Metrics, 0)
+	for _, m := range rep.storage.ReadMetrics() {
+		if m.Tenant == tenant {
+			metrics = append(metrics, m)
+		}
+	}
+
+	return metrics, nil
 }
 
-func (rep *memStorageRepository) ReadCounter(name string) (int64, error) {
-	return rep.storage.ReadCounter(name)
+func (rep *memStorageRepository) ReadRange(_ context.Context, q model.RangeQuery) ([]model.Sample, error) {
+	return rep.storage.ReadRange(q), nil
 }
 
-func (rep *memStorageRepository) ReadGauge(name string) (float64, error) {
-	return rep.storage.ReadGauge(name)
+func (rep *memStorageRepository) Aggregate(_ context.Context, q model.RangeQuery) ([]model.Sample, error) {
+	return rep.storage.Aggregate(q), nil
 }
@@ -1,25 +1,55 @@
 package storage
 
 import (
+	"context"
+
+	"github.com/7StaSH7/gometrics/internal/repository"
 	"github.com/7StaSH7/gometrics/internal/storage"
 )
 
-type memStorageRepository struct {
-	storage storage.MemStorageInterface
+func init() {
+	repository.Register("memory", newMemoryBackend)
+	repository.Register("file", newFileBackend)
 }
 
-type MemStorageRepository interface {
-	Replace(name string, value float64) error
-	Add(name string, value int64) error
-	ReadCounter(string) (int64, error)
-	ReadGauge(string) (float64, error)
-	ReadAll() map[string]string
-	Restore() error
-	Store() error
+type memStorageRepository struct {
+	storage storage.MemStorageInterface
 }
 
-func NewMemStorageRepository(storage storage.MemStorageInterface) MemStorageRepository {
+func NewMemStorageRepository(storage storage.MemStorageInterface) repository.Backend {
 	return &memStorageRepository{
 		storage: storage,
 	}
 }
+
+// newMemoryBackend — хранилище только в памяти, без записи на диск.
+func newMemoryBackend(_ context.Context, opts repository.Options) (repository.Backend, error) {
+	cfg := *opts.Server
+	cfg.StoreFilePath = ""
+
+	return NewMemStorageRepository(storage.NewStorage(&cfg)), nil
+}
+
+// newFileBackend — хранилище в памяти с журналом обновлений и снапшотами в FILE_STORAGE_PATH.
+// Без восстановления прежнее содержимое файла сразу заменяется пустым снапшотом.
+func newFileBackend(_ context.Context, opts repository.Options) (repository.Backend, error) {
+	stor := storage.NewStorage(opts.Server)
+
+	load := stor.Store
+	if opts.Server.Restore {
+		load = stor.Restore
+	}
+	if err := load(); err != nil {
+		return nil, err
+	}
+
+	return NewMemStorageRepository(stor), nil
+}
+
+func (rep *memStorageRepository) Health(_ context.Context) error {
+	return nil
+}
+
+func (rep *memStorageRepository) Close() error {
+	return rep.storage.Close()
+}
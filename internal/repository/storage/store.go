@@ -1,9 +1,7 @@
 package storage
 
-func (rep *memStorageRepository) Store() error {
-	return rep.storage.Store()
-}
+import "context"
 
-func (rep *memStorageRepository) Restore() error {
-	return rep.storage.Restore()
+func (rep *memStorageRepository) Snapshot(_ context.Context) error {
+	return rep.storage.Store()
 }
@@ -1,13 +1,22 @@
 package storage
 
-func (rep *memStorageRepository) Add(name string, value int64) error {
-	rep.storage.Add(name, value)
+import (
+	"context"
+	"time"
 
-	return nil
+	"github.com/7StaSH7/gometrics/internal/model"
+)
+
+func (rep *memStorageRepository) Update(_ context.Context, m model.Metrics) error {
+	return rep.storage.Updates([]model.Metrics{m})
+}
+
+func (rep *memStorageRepository) Updates(_ context.Context, metrics []model.Metrics) error {
+	return rep.storage.Updates(metrics)
 }
 
-func (rep *memStorageRepository) Replace(name string, value float64) error {
-	rep.storage.Replace(name, value)
+func (rep *memStorageRepository) Compact(_ context.Context, now time.Time, policy model.RetentionPolicy) error {
+	rep.storage.Compact(now, policy)
 
 	return nil
 }
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/repository"
+)
+
+// batchCache помнит пачки, применённые хранилищами без собственной
+// дедупликации (repository.Batches). Пачки забываются через TTL или,
+// если их больше Size, начиная с самых старых.
+type batchCache struct {
+	policy model.DedupPolicy
+	now    func() time.Time
+
+	mu      sync.Mutex
+	batches map[string]*batchEntry
+	// order — применённые пачки в порядке применения
+	order []string
+}
+
+type batchEntry struct {
+	// done закрывается, когда применение завершилось, успешно или нет
+	done    chan struct{}
+	applied bool
+	at      time.Time
+}
+
+func newBatchCache(policy model.DedupPolicy) *batchCache {
+	return &batchCache{
+		policy:  policy,
+		now:     time.Now,
+		batches: make(map[string]*batchEntry),
+	}
+}
+
+// apply вызывает update, если пачка key ещё не применялась, иначе возвращает
+// repository.ErrDuplicateBatch. Повтор, пришедший во время применения оригинала
+// (ретрай после таймаута), ждёт его результата: если оригинал не применился,
+// повтор применяет пачку сам.
+func (c *batchCache) apply(ctx context.Context, key string, update func() error) error {
+	for {
+		c.mu.Lock()
+		c.expire()
+		e, ok := c.batches[key]
+		if !ok {
+			e = &batchEntry{done: make(chan struct{})}
+			c.batches[key] = e
+			c.mu.Unlock()
+
+			return c.finish(key, e, update())
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if e.applied {
+			return repository.ErrDuplicateBatch
+		}
+	}
+}
+
+// applied сообщает, применена ли пачка key. Пачка, которая применяется
+// прямо сейчас, ещё не считается применённой.
+func (c *batchCache) applied(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire()
+	e, ok := c.batches[key]
+
+	return ok && e.applied
+}
+
+func (c *batchCache) finish(key string, e *batchEntry, err error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer close(e.done)
+
+	if err != nil {
+		delete(c.batches, key)
+		return err
+	}
+
+	e.applied, e.at = true, c.now()
+	c.order = append(c.order, key)
+	for len(c.order) > c.policy.Size {
+		c.evict()
+	}
+
+	return nil
+}
+
+func (c *batchCache) expire() {
+	cutoff := c.now().Add(-c.policy.TTL)
+	for len(c.order) > 0 && c.batches[c.order[0]].at.Before(cutoff) {
+		c.evict()
+	}
+}
+
+func (c *batchCache) evict() {
+	delete(c.batches, c.order[0])
+	c.order[0] = ""
+	c.order = c.order[1:]
+}
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchCache(t *testing.T) {
+	ctx := context.Background()
+	c := newBatchCache(model.DedupPolicy{TTL: time.Minute, Size: 2})
+	now := time.Unix(1_700_000_000, 0)
+	c.now = func() time.Time { return now }
+
+	var calls int
+	update := func() error {
+		calls++
+		return nil
+	}
+
+	assert.NoError(t, c.apply(ctx, "a", update))
+	assert.ErrorIs(t, c.apply(ctx, "a", update), repository.ErrDuplicateBatch)
+	assert.Equal(t, 1, calls)
+
+	// неудачная попытка не запоминается
+	assert.Error(t, c.apply(ctx, "b", func() error { return errors.New("db is down") }))
+	assert.NoError(t, c.apply(ctx, "b", update))
+	assert.Equal(t, 2, calls)
+
+	// переполнение вытесняет самую старую пачку
+	assert.NoError(t, c.apply(ctx, "c", update))
+	assert.NoError(t, c.apply(ctx, "a", update))
+	assert.ErrorIs(t, c.apply(ctx, "c", update), repository.ErrDuplicateBatch)
+
+	// по истечении TTL пачка применяется снова
+	now = now.Add(2 * time.Minute)
+	assert.NoError(t, c.apply(ctx, "c", update))
+	assert.Len(t, c.order, 1)
+}
+
+func TestBatchCacheConcurrentRetry(t *testing.T) {
+	ctx := context.Background()
+	c := newBatchCache(model.DedupPolicy{TTL: time.Minute, Size: 10})
+
+	var calls atomic.Int32
+	started, release := make(chan struct{}), make(chan struct{})
+	original := make(chan error)
+	go func() {
+		original <- c.apply(ctx, "a", func() error {
+			calls.Add(1)
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	retry := make(chan error)
+	go func() {
+		retry <- c.apply(ctx, "a", func() error {
+			calls.Add(1)
+			return nil
+		})
+	}()
+
+	// ретрай ждёт оригинал, пока тот не применится
+	select {
+	case err := <-retry:
+		t.Fatalf("retry finished before original: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+
+	assert.NoError(t, <-original)
+	assert.ErrorIs(t, <-retry, repository.ErrDuplicateBatch)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+// expiringBackend — хранилище, которое само помнит пачки.
+type expiringBackend struct {
+	repository.Backend
+	before []time.Time
+}
+
+func (b *expiringBackend) UpdatesOnce(context.Context, string, string, []model.Metrics) error {
+	return nil
+}
+
+func (b *expiringBackend) BatchApplied(context.Context, string, string) (bool, error) {
+	return false, nil
+}
+
+func (b *expiringBackend) ExpireBatches(_ context.Context, before time.Time) error {
+	b.before = append(b.before, before)
+	return nil
+}
+
+func TestCompactExpiresBatches(t *testing.T) {
+	now := time.Now()
+
+	backend := &expiringBackend{}
+	s := New(backend, model.RetentionPolicy{}, nil, model.DedupPolicy{TTL: time.Minute, Size: 10}).(*metricsService)
+	assert.NoError(t, s.compact(context.Background(), now))
+	assert.Equal(t, []time.Time{now.Add(-time.Minute)}, backend.before)
+
+	// без дедупликации чистить нечего
+	backend = &expiringBackend{}
+	s = New(backend, model.RetentionPolicy{}, nil, model.DedupPolicy{}).(*metricsService)
+	assert.NoError(t, s.compact(context.Background(), now))
+	assert.Empty(t, backend.before)
+}
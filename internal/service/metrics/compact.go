@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/logger"
+	"github.com/7StaSH7/gometrics/internal/repository"
+	"go.uber.org/zap"
+)
+
+// Compact периодически сворачивает историю в минутные и часовые агрегаты,
+// удаляет данные старше сроков хранения и забывает устаревшие пачки.
+func (s *metricsService) Compact(ctx context.Context, interval time.Duration) error {
+	if _, err := s.history(); err != nil {
+		logger.Log.Info("history compaction disabled", zap.Error(err))
+		if s.expiringBatches() == nil {
+			return nil
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			if err := s.compact(ctx, now); err != nil {
+				logger.Log.Error("history compaction failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (s *metricsService) compact(ctx context.Context, now time.Time) error {
+	var errs []error
+	if h, err := s.history(); err == nil && s.retention.Raw > 0 {
+		errs = append(errs, h.Compact(ctx, now, s.retention))
+	}
+	if b := s.expiringBatches(); b != nil {
+		errs = append(errs, b.ExpireBatches(ctx, now.Add(-s.dedup.TTL)))
+	}
+
+	return errors.Join(errs...)
+}
+
+// expiringBatches возвращает хранилище, которое само помнит пачки и которому
+// нужна очистка. Кэш пачек в памяти сервиса чистится сам.
+func (s *metricsService) expiringBatches() repository.Batches {
+	b, ok := s.backend.(repository.Batches)
+	if !ok || s.dedup.TTL <= 0 {
+		return nil
+	}
+
+	return b
+}
@@ -1,25 +1,65 @@
 package metrics
 
-func (s *metricsService) GetCounter(name string) (int64, error) {
-	if s.dbRep.Ping() {
-		return s.dbRep.ReadCounter(name)
+import (
+	"context"
+	"fmt"
+
+	"github.com/7StaSH7/gometrics/internal/auth"
+	"github.com/7StaSH7/gometrics/internal/logger"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"go.uber.org/zap"
+)
+
+func (s *metricsService) GetCounter(ctx context.Context, name string, labels model.Labels) (int64, error) {
+	m, err := s.backend.Read(ctx, auth.Tenant(ctx), model.Counter, name, labels)
+	if err != nil {
+		return 0, err
 	}
 
-	return s.storageRep.ReadCounter(name)
+	return *m.Delta, nil
 }
 
-func (s *metricsService) GetGauge(name string) (float64, error) {
-	if s.dbRep.Ping() {
-		return s.dbRep.ReadGauge(name)
+func (s *metricsService) GetGauge(ctx context.Context, name string, labels model.Labels) (float64, error) {
+	m, err := s.backend.Read(ctx, auth.Tenant(ctx), model.Gauge, name, labels)
+	if err != nil {
+		return 0, err
 	}
 
-	return s.storageRep.ReadGauge(name)
+	return *m.Value, nil
+}
+
+func (s *metricsService) GetHistogram(ctx context.Context, name string, labels model.Labels) (model.Metrics, error) {
+	return s.backend.Read(ctx, auth.Tenant(ctx), model.Histogram, name, labels)
+}
+
+func (s *metricsService) GetSummary(ctx context.Context, name string, labels model.Labels) (model.Metrics, error) {
+	return s.backend.Read(ctx, auth.Tenant(ctx), model.Summary, name, labels)
 }
 
-func (s *metricsService) GetMany() map[string]string {
-	if s.dbRep.Ping() {
-		return s.dbRep.ReadAll()
+func (s *metricsService) GetMany(ctx context.Context) map[string]string {
+	result := make(map[string]string)
+
+	metrics, err := s.GetAll(ctx)
+	if err != nil {
+		logger.Log.Error("cannot read metrics", zap.Error(err))
+		return result
+	}
+
+	for _, m := range metrics {
+		key := model.SeriesKey(m.ID, m.Labels)
+		switch {
+		case m.Delta != nil:
+			result[key] = fmt.Sprint(*m.Delta)
+		case m.Value != nil:
+			result[key] = fmt.Sprint(*m.Value)
+		case m.Count != nil && m.Sum != nil:
+			result[key] = fmt.Sprintf("count=%d sum=%v", *m.Count, *m.Sum)
+		}
 	}
 
-	return s.storageRep.ReadAll()
+	return result
+}
+
+func (s *metricsService) GetAll(ctx context.Context) ([]model.Metrics, error) {
+	return s.backend.ReadAll(ctx, auth.Tenant(ctx))
 }
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/auth"
+	"github.com/7StaSH7/gometrics/internal/model"
+)
+
+var (
+	ErrBadRange       = errors.New("'from' must not be after 'to'")
+	ErrBadAggregation = errors.New("aggregation is not supported for this metric type")
+)
+
+func (s *metricsService) QueryRange(ctx context.Context, q model.RangeQuery) (*model.Series, error) {
+	if q.From.After(q.To) {
+		return nil, ErrBadRange
+	}
+
+	q.Tenant = auth.Tenant(ctx)
+	q.Resolution = s.resolution(q.From, time.Now())
+
+	h, err := s.history()
+	if err != nil {
+		return nil, err
+	}
+
+	samples, err := h.ReadRange(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.Step > 0 {
+		samples = lastPerStep(samples, q)
+	}
+
+	return &model.Series{
+		ID:     q.ID,
+		MType:  q.MType,
+		Labels: q.Labels.Normalize(),
+		Points: samples,
+	}, nil
+}
+
+func (s *metricsService) Aggregate(ctx context.Context, q model.RangeQuery) (*model.Series, error) {
+	if q.From.After(q.To) {
+		return nil, ErrBadRange
+	}
+	if !slices.Contains(model.Aggregations[q.MType], q.Agg) {
+		return nil, ErrBadAggregation
+	}
+
+	// без шага весь интервал — одна корзина
+	if q.Step <= 0 {
+		q.Step = max(q.To.Sub(q.From), time.Second)
+	}
+	q.Tenant = auth.Tenant(ctx)
+	q.Resolution = s.resolution(q.From, time.Now())
+
+	h, err := s.history()
+	if err != nil {
+		return nil, err
+	}
+
+	samples, err := h.Aggregate(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Series{
+		ID:     q.ID,
+		MType:  q.MType,
+		Labels: q.Labels.Normalize(),
+		Agg:    q.Agg,
+		Points: samples,
+	}, nil
+}
+
+// resolution выбирает самое подробное разрешение, которое ещё хранится для момента from.
+func (s *metricsService) resolution(from, now time.Time) time.Duration {
+	age := now.Sub(from)
+
+	switch {
+	case s.retention.Raw <= 0 || age <= s.retention.Raw:
+		return model.ResolutionRaw
+	case s.retention.Minute <= 0 || age <= s.retention.Minute:
+		return model.ResolutionMinute
+	default:
+		return model.ResolutionHour
+	}
+}
+
+// lastPerStep оставляет по одному (последнему) значению в каждой корзине шириной q.Step,
+// метка времени точки — начало корзины. Значения должны быть упорядочены по времени.
+func lastPerStep(samples []model.Sample, q model.RangeQuery) []model.Sample {
+	res := make([]model.Sample, 0)
+
+	for _, sample := range samples {
+		bucket := q.From.Add(sample.Timestamp.Sub(q.From) / q.Step * q.Step)
+		if n := len(res); n > 0 && res[n-1].Timestamp.Equal(bucket) {
+			res[n-1].Value = sample.Value
+			continue
+		}
+		res = append(res, model.Sample{Timestamp: bucket, Value: sample.Value})
+	}
+
+	return res
+}
@@ -2,31 +2,65 @@ package metrics
 
 import (
 	"context"
+	"time"
 
 	"github.com/7StaSH7/gometrics/internal/model"
-	"github.com/7StaSH7/gometrics/internal/repository/db"
-	"github.com/7StaSH7/gometrics/internal/repository/storage"
-	"github.com/jackc/pgx/v5"
+	"github.com/7StaSH7/gometrics/internal/repository"
 )
 
+// MetricsService читает и пишет метрики арендатора из контекста запроса (auth.Tenant).
 type MetricsService interface {
-	UpdateCounter(ctx context.Context, tx pgx.Tx, name string, value int64) error
-	UpdateGauge(ctx context.Context, tx pgx.Tx, name string, value float64) error
-	GetCounter(name string) (int64, error)
-	GetGauge(name string) (float64, error)
-	GetMany() map[string]string
-	Store(ctx context.Context, restore bool, interval int) error
+	UpdateCounter(ctx context.Context, name string, labels model.Labels, value int64) error
+	UpdateGauge(ctx context.Context, name string, labels model.Labels, value float64) error
+	UpdateHistogram(ctx context.Context, name string, labels model.Labels, delta model.Metrics) error
+	ObserveHistogram(ctx context.Context, name string, labels model.Labels, value float64) error
+	UpdateSummary(ctx context.Context, name string, labels model.Labels, value model.Metrics) error
+	GetCounter(ctx context.Context, name string, labels model.Labels) (int64, error)
+	GetGauge(ctx context.Context, name string, labels model.Labels) (float64, error)
+	GetHistogram(ctx context.Context, name string, labels model.Labels) (model.Metrics, error)
+	GetSummary(ctx context.Context, name string, labels model.Labels) (model.Metrics, error)
+	GetMany(ctx context.Context) map[string]string
+	GetAll(ctx context.Context) ([]model.Metrics, error)
+	Store(ctx context.Context, interval int) error
+	Compact(ctx context.Context, interval time.Duration) error
 	Updates(ctx context.Context, metrics []model.Metrics) error
+	// UpdatesOnce применяет пачку batchID, если она ещё не применялась.
+	// Для повтора возвращает false и не меняет метрики.
+	UpdatesOnce(ctx context.Context, batchID string, metrics []model.Metrics) (bool, error)
+	// BatchApplied сообщает, применена ли уже пачка batchID арендатора из контекста.
+	BatchApplied(ctx context.Context, batchID string) (bool, error)
+	QueryRange(ctx context.Context, q model.RangeQuery) (*model.Series, error)
+	Aggregate(ctx context.Context, q model.RangeQuery) (*model.Series, error)
 }
 
 type metricsService struct {
-	storageRep storage.MemStorageRepository
-	dbRep      db.DatabaseRepository
+	backend   repository.Backend
+	retention model.RetentionPolicy
+	buckets   []float64
+	dedup     model.DedupPolicy
+	batches   *batchCache
 }
 
-func New(storageRep storage.MemStorageRepository, dbRep db.DatabaseRepository) MetricsService {
-	return &metricsService{
-		storageRep: storageRep,
-		dbRep:      dbRep,
+func New(backend repository.Backend, retention model.RetentionPolicy, buckets []float64, dedup model.DedupPolicy) MetricsService {
+	s := &metricsService{
+		backend:   backend,
+		retention: retention,
+		buckets:   buckets,
+		dedup:     dedup,
 	}
+	if _, ok := backend.(repository.Batches); !ok && dedup.TTL > 0 {
+		s.batches = newBatchCache(dedup)
+	}
+
+	return s
+}
+
+// history возвращает историю выбранного хранилища, если оно её ведёт.
+func (s *metricsService) history() (repository.History, error) {
+	h, ok := s.backend.(repository.History)
+	if !ok {
+		return nil, repository.ErrHistoryUnsupported
+	}
+
+	return h, nil
 }
@@ -5,22 +5,16 @@ import (
 	"time"
 )
 
-func (s *metricsService) Store(ctx context.Context, restore bool, interval int) error {
+func (s *metricsService) Store(ctx context.Context, interval int) error {
 	metricStore := time.NewTicker(time.Duration(interval) * time.Second)
 	defer metricStore.Stop()
 
-	if restore {
-		if err := s.storageRep.Restore(); err != nil {
-			return err
-		}
-	}
-
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
 		case <-metricStore.C:
-			if err := s.storageRep.Store(); err != nil {
+			if err := s.backend.Snapshot(ctx); err != nil {
 				return err
 			}
 		}
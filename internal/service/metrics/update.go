@@ -2,65 +2,127 @@ package metrics
 
 import (
 	"context"
+	"errors"
 
+	"github.com/7StaSH7/gometrics/internal/auth"
 	"github.com/7StaSH7/gometrics/internal/model"
-	"github.com/jackc/pgx/v5"
+	"github.com/7StaSH7/gometrics/internal/repository"
 )
 
-func (s *metricsService) UpdateCounter(ctx context.Context, tx pgx.Tx, name string, value int64) error {
-	if s.dbRep.Ping() {
-		if err := s.dbRep.Add(ctx, tx, name, value); err != nil {
-			return err
-		}
-		return nil
-	}
+func (s *metricsService) UpdateCounter(ctx context.Context, name string, labels model.Labels, value int64) error {
+	return s.backend.Update(ctx, model.Metrics{Tenant: auth.Tenant(ctx), ID: name, MType: model.Counter, Labels: labels, Delta: &value})
+}
+
+func (s *metricsService) UpdateGauge(ctx context.Context, name string, labels model.Labels, value float64) error {
+	return s.backend.Update(ctx, model.Metrics{Tenant: auth.Tenant(ctx), ID: name, MType: model.Gauge, Labels: labels, Value: &value})
+}
 
-	if err := s.storageRep.Add(name, value); err != nil {
+func (s *metricsService) UpdateHistogram(ctx context.Context, name string, labels model.Labels, delta model.Metrics) error {
+	if err := model.ValidateHistogram(delta); err != nil {
 		return err
 	}
 
-	return nil
+	delta.Tenant, delta.ID, delta.MType, delta.Labels = auth.Tenant(ctx), name, model.Histogram, labels
+
+	return s.backend.Update(ctx, delta)
 }
 
-func (s *metricsService) UpdateGauge(ctx context.Context, tx pgx.Tx, name string, value float64) error {
-	if s.dbRep.Ping() {
-		if err := s.dbRep.Replace(ctx, tx, name, value); err != nil {
-			return err
-		}
-		return nil
+// ObserveHistogram добавляет в гистограмму одно наблюдение. Для новой серии
+// используются границы корзин из конфигурации, для существующей — её собственные.
+func (s *metricsService) ObserveHistogram(ctx context.Context, name string, labels model.Labels, value float64) error {
+	bounds := s.buckets
+	stored, err := s.backend.Read(ctx, auth.Tenant(ctx), model.Histogram, name, labels)
+	switch {
+	case err == nil:
+		bounds = stored.Bounds()
+	case !errors.Is(err, repository.ErrNotFound):
+		return err
 	}
 
-	if err := s.storageRep.Replace(name, value); err != nil {
+	return s.UpdateHistogram(ctx, name, labels, model.Observation(value, bounds))
+}
+
+func (s *metricsService) UpdateSummary(ctx context.Context, name string, labels model.Labels, value model.Metrics) error {
+	if err := model.ValidateSummary(value); err != nil {
 		return err
 	}
 
-	return nil
+	value.Tenant, value.ID, value.MType, value.Labels = auth.Tenant(ctx), name, model.Summary, labels
+
+	return s.backend.Update(ctx, value)
 }
 
+// Updates применяет пачку от имени арендатора из контекста: арендатор,
+// указанный в самих метриках, заменяется.
 func (s *metricsService) Updates(ctx context.Context, metrics []model.Metrics) error {
-	var tx pgx.Tx
-	var err error
+	metrics, err := prepare(auth.Tenant(ctx), metrics)
+	if err != nil {
+		return err
+	}
 
-	if s.dbRep.Ping() {
-		tx, err = s.dbRep.StartTransaction(ctx)
-		if err != nil {
-			return err
-		}
+	return s.backend.Updates(ctx, metrics)
+}
+
+func (s *metricsService) UpdatesOnce(ctx context.Context, batchID string, metrics []model.Metrics) (bool, error) {
+	tenant := auth.Tenant(ctx)
+	metrics, err := prepare(tenant, metrics)
+	if err != nil {
+		return false, err
+	}
+
+	batches, ok := s.backend.(repository.Batches)
+
+	switch {
+	case ok && s.dedup.TTL > 0:
+		err = batches.UpdatesOnce(ctx, tenant, batchID, metrics)
+	case s.batches != nil:
+		err = s.batches.apply(ctx, tenant+"\x00"+batchID, func() error {
+			return s.backend.Updates(ctx, metrics)
+		})
+	default:
+		err = s.backend.Updates(ctx, metrics)
+	}
+	if errors.Is(err, repository.ErrDuplicateBatch) {
+		return false, nil
 	}
 
-	for _, m := range metrics {
+	return err == nil, err
+}
+
+func (s *metricsService) BatchApplied(ctx context.Context, batchID string) (bool, error) {
+	tenant := auth.Tenant(ctx)
+
+	batches, ok := s.backend.(repository.Batches)
+	switch {
+	case ok && s.dedup.TTL > 0:
+		return batches.BatchApplied(ctx, tenant, batchID)
+	case s.batches != nil:
+		return s.batches.applied(tenant + "\x00" + batchID), nil
+	default:
+		return false, nil
+	}
+}
+
+// prepare возвращает копию пачки с арендатором tenant и проверяет распределения.
+// Срез вызывающего не меняется.
+func prepare(tenant string, metrics []model.Metrics) ([]model.Metrics, error) {
+	prepared := make([]model.Metrics, len(metrics))
+	for i, m := range metrics {
+		m.Tenant = tenant
+
+		var err error
 		switch m.MType {
-		case model.Counter:
-			err = s.UpdateCounter(ctx, tx, m.ID, *m.Delta)
-		case model.Gauge:
-			err = s.UpdateGauge(ctx, tx, m.ID, *m.Value)
+		case model.Histogram:
+			err = model.ValidateHistogram(m)
+		case model.Summary:
+			err = model.ValidateSummary(m)
+		}
+		if err != nil {
+			return nil, err
 		}
-	}
 
-	s.dbRep.IntrospectTransaction(ctx, tx, err)
-	if err != nil {
-		return err
+		prepared[i] = m
 	}
 
-	return nil
+	return prepared, nil
 }
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/7StaSH7/gometrics/internal/auth"
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/model"
+	storagerepository "github.com/7StaSH7/gometrics/internal/repository/storage"
+	"github.com/7StaSH7/gometrics/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdatesDoNotChangeBatch(t *testing.T) {
+	backend := storagerepository.NewMemStorageRepository(storage.NewStorage(&config.ServerConfig{}))
+	s := New(backend, model.RetentionPolicy{}, nil, model.DedupPolicy{})
+	ctx := auth.WithTenant(context.Background(), "team-a")
+
+	delta := int64(1)
+	batch := []model.Metrics{{ID: "PollCount", MType: model.Counter, Delta: &delta}}
+	require.NoError(t, s.Updates(ctx, batch))
+	_, err := s.UpdatesOnce(ctx, "batch-1", batch)
+	require.NoError(t, err)
+
+	// арендатор проставлен копии, а не пачке вызывающего
+	assert.Empty(t, batch[0].Tenant)
+
+	m, err := backend.Read(ctx, "team-a", model.Counter, "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *m.Delta)
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/model"
+)
+
+func (s *MemStorage) Aggregate(q model.RangeQuery) []model.Sample {
+	h := s.findHistory(q)
+	if h == nil {
+		return []model.Sample{}
+	}
+	defer h.mu.Unlock()
+
+	switch q.Agg {
+	case model.AggRate, model.AggIncrease:
+		// для прироста нужна и точка перед началом интервала
+		return aggregateIncrease(h.rollups(q.Resolution, time.Time{}, q.To), q)
+	default:
+		return aggregateValues(h.rollups(q.Resolution, q.From, q.To), q)
+	}
+}
+
+// aggregateIncrease считает прирост накопленного счётчика в каждой корзине.
+// Уменьшение значения считается сбросом счётчика.
+func aggregateIncrease(rollups []model.Rollup, q model.RangeQuery) []model.Sample {
+	res := make([]model.Sample, 0)
+
+	for i, cur := range rollups {
+		var delta float64
+		if i > 0 {
+			delta = cur.Last - rollups[i-1].Last
+			if delta < 0 {
+				delta = cur.Last
+			}
+		}
+
+		if cur.Timestamp.Before(q.From) {
+			continue
+		}
+
+		bucket := bucketStart(cur.Timestamp, q)
+		if n := len(res); n > 0 && res[n-1].Timestamp.Equal(bucket) {
+			res[n-1].Value += delta
+			continue
+		}
+		res = append(res, model.Sample{Timestamp: bucket, Value: delta})
+	}
+
+	if q.Agg == model.AggRate {
+		for i := range res {
+			res[i].Value /= q.Step.Seconds()
+		}
+	}
+
+	return res
+}
+
+func aggregateValues(rollups []model.Rollup, q model.RangeQuery) []model.Sample {
+	res := make([]model.Sample, 0)
+
+	var group []model.Rollup
+	flush := func(bucket time.Time) {
+		if len(group) > 0 {
+			res = append(res, model.Sample{Timestamp: bucket, Value: aggregate(q.Agg, group)})
+		}
+		group = group[:0]
+	}
+
+	var bucket time.Time
+	for _, r := range rollups {
+		b := bucketStart(r.Timestamp, q)
+		if !b.Equal(bucket) {
+			flush(bucket)
+			bucket = b
+		}
+		group = append(group, r)
+	}
+	flush(bucket)
+
+	return res
+}
+
+func aggregate(agg string, rollups []model.Rollup) float64 {
+	switch agg {
+	case model.AggMin:
+		res := rollups[0].Min
+		for _, r := range rollups[1:] {
+			res = math.Min(res, r.Min)
+		}
+		return res
+	case model.AggMax:
+		res := rollups[0].Max
+		for _, r := range rollups[1:] {
+			res = math.Max(res, r.Max)
+		}
+		return res
+	case model.AggP50, model.AggP95, model.AggP99:
+		// по агрегатам квантиль считается приближённо, по средним значениям
+		values := make([]float64, 0, len(rollups))
+		for _, r := range rollups {
+			values = append(values, r.Sum/float64(r.Count))
+		}
+		return percentile(values, model.Quantiles[agg])
+	default:
+		var sum float64
+		var count int64
+		for _, r := range rollups {
+			sum += r.Sum
+			count += r.Count
+		}
+		return sum / float64(count)
+	}
+}
+
+// percentile повторяет percentile_cont из Postgres: линейная интерполяция между соседними значениями.
+func percentile(values []float64, p float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	pos := p * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(pos-float64(lower))
+}
+
+func bucketStart(ts time.Time, q model.RangeQuery) time.Time {
+	return q.From.Add(ts.Sub(q.From) / q.Step * q.Step)
+}
@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/model"
+)
+
+// ring — кольцевой буфер последних значений серии фиксированного размера.
+type ring struct {
+	samples []model.Sample
+	head    int
+	size    int
+}
+
+func newRing(size int) *ring {
+	return &ring{samples: make([]model.Sample, size)}
+}
+
+func (r *ring) at(i int) model.Sample {
+	return r.samples[(r.head+i)%len(r.samples)]
+}
+
+func (r *ring) push(s model.Sample) {
+	if r.size == len(r.samples) {
+		r.samples[r.head] = s
+		r.head = (r.head + 1) % len(r.samples)
+		return
+	}
+
+	r.samples[(r.head+r.size)%len(r.samples)] = s
+	r.size++
+}
+
+// trim удаляет значения старше before.
+func (r *ring) trim(before time.Time) {
+	for r.size > 0 && r.at(0).Timestamp.Before(before) {
+		r.head = (r.head + 1) % len(r.samples)
+		r.size--
+	}
+}
+
+// between возвращает значения из [from, to] в порядке записи.
+func (r *ring) between(from, to time.Time) []model.Sample {
+	res := make([]model.Sample, 0)
+
+	for i := 0; i < r.size; i++ {
+		s := r.at(i)
+		if s.Timestamp.Before(from) || s.Timestamp.After(to) {
+			continue
+		}
+		res = append(res, s)
+	}
+
+	return res
+}
+
+// seriesHistory — история серии: сырые значения и минутные/часовые агрегаты.
+type seriesHistory struct {
+	mu sync.Mutex
+	// removed выставляется, когда Compact удалил опустевшую историю из карты
+	removed bool
+
+	raw    *ring
+	minute []model.Rollup
+	hour   []model.Rollup
+
+	// сырые значения до rolledMinute уже свёрнуты в минутные агрегаты,
+	// минутные до rolledHour — в часовые
+	rolledMinute time.Time
+	rolledHour   time.Time
+}
+
+// historyKey — ключ истории серии с ключом model.TenantSeriesKey.
+func historyKey(mType, seriesKey string) string {
+	return mType + ":" + seriesKey
+}
+
+// lockHistory возвращает заблокированную историю серии, при отсутствии создаёт её.
+func (s *MemStorage) lockHistory(sh *shard, key string) *seriesHistory {
+	for {
+		h := getOrCreate(sh, sh.history, key, func() *seriesHistory {
+			return &seriesHistory{raw: newRing(s.historySize)}
+		})
+
+		h.mu.Lock()
+		if !h.removed {
+			return h
+		}
+		h.mu.Unlock()
+	}
+}
+
+func (h *seriesHistory) record(value float64) {
+	h.raw.push(model.Sample{Timestamp: time.Now(), Value: value})
+}
+
+// findHistory возвращает заблокированную историю серии или nil.
+func (s *MemStorage) findHistory(q model.RangeQuery) *seriesHistory {
+	seriesKey := model.TenantSeriesKey(q.Tenant, q.ID, q.Labels)
+	key := historyKey(q.MType, seriesKey)
+	sh := s.shard(seriesKey)
+
+	sh.mu.RLock()
+	h, ok := sh.history[key]
+	sh.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	h.mu.Lock()
+	return h
+}
+
+func (s *MemStorage) ReadRange(q model.RangeQuery) []model.Sample {
+	h := s.findHistory(q)
+	if h == nil {
+		return []model.Sample{}
+	}
+	defer h.mu.Unlock()
+
+	if q.Resolution == model.ResolutionRaw {
+		return h.raw.between(q.From, q.To)
+	}
+
+	res := make([]model.Sample, 0)
+	for _, r := range h.rollups(q.Resolution, q.From, q.To) {
+		res = append(res, model.Sample{Timestamp: r.Timestamp, Value: r.Last})
+	}
+
+	return res
+}
+
+// rollups возвращает агрегаты нужного разрешения из [from, to].
+// Для сырых значений каждое значение превращается в агрегат из одной точки.
+// Ещё не свёрнутый хвост берётся из более подробного источника как есть.
+func (h *seriesHistory) rollups(resolution time.Duration, from, to time.Time) []model.Rollup {
+	var (
+		src    []model.Rollup
+		rolled time.Time
+		finer  time.Duration
+	)
+	switch resolution {
+	case model.ResolutionRaw:
+		return samplesToRollups(h.raw.between(from, to))
+	case model.ResolutionMinute:
+		src, rolled, finer = h.minute, h.rolledMinute, model.ResolutionRaw
+	default:
+		src, rolled, finer = h.hour, h.rolledHour, model.ResolutionMinute
+	}
+
+	start := sort.Search(len(src), func(i int) bool { return !src[i].Timestamp.Before(from) })
+	end := sort.Search(len(src), func(i int) bool { return src[i].Timestamp.After(to) })
+	res := src[start:end]
+	if to.Before(rolled) {
+		return res
+	}
+
+	return append(slices.Clip(res), h.rollups(finer, later(from, rolled), to)...)
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func (s *MemStorage) Compact(now time.Time, policy model.RetentionPolicy) {
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for key, h := range sh.history {
+			h.mu.Lock()
+			h.rollup(now)
+			h.trim(now, policy)
+
+			if h.raw.size == 0 && len(h.minute) == 0 && len(h.hour) == 0 {
+				h.removed = true
+				delete(sh.history, key)
+			}
+			h.mu.Unlock()
+		}
+		sh.mu.Unlock()
+	}
+}
+
+// rollup сворачивает завершившиеся минуты в минутные агрегаты, а завершившиеся часы — в часовые.
+func (h *seriesHistory) rollup(now time.Time) {
+	minuteEnd := now.Truncate(time.Minute)
+	if minuteEnd.After(h.rolledMinute) {
+		samples := h.raw.between(h.rolledMinute, minuteEnd.Add(-time.Nanosecond))
+		h.minute = append(h.minute, mergeRollups(samplesToRollups(samples), time.Minute)...)
+		h.rolledMinute = minuteEnd
+	}
+
+	hourEnd := now.Truncate(time.Hour)
+	if hourEnd.After(h.rolledHour) {
+		minutes := h.rollups(model.ResolutionMinute, h.rolledHour, hourEnd.Add(-time.Nanosecond))
+		h.hour = append(h.hour, mergeRollups(minutes, time.Hour)...)
+		h.rolledHour = hourEnd
+	}
+}
+
+func (h *seriesHistory) trim(now time.Time, policy model.RetentionPolicy) {
+	h.raw.trim(now.Add(-policy.Raw))
+	if policy.Minute > 0 {
+		h.minute = trimRollups(h.minute, now.Add(-policy.Minute))
+	}
+	if policy.Hour > 0 {
+		h.hour = trimRollups(h.hour, now.Add(-policy.Hour))
+	}
+}
+
+func trimRollups(rollups []model.Rollup, before time.Time) []model.Rollup {
+	i := sort.Search(len(rollups), func(i int) bool { return !rollups[i].Timestamp.Before(before) })
+
+	return rollups[i:]
+}
+
+func samplesToRollups(samples []model.Sample) []model.Rollup {
+	res := make([]model.Rollup, 0, len(samples))
+	for _, s := range samples {
+		res = append(res, model.Rollup{
+			Timestamp: s.Timestamp,
+			Count:     1,
+			Sum:       s.Value,
+			Min:       s.Value,
+			Max:       s.Value,
+			Last:      s.Value,
+		})
+	}
+
+	return res
+}
+
+// mergeRollups объединяет упорядоченные по времени агрегаты в агрегаты разрешения resolution.
+func mergeRollups(rollups []model.Rollup, resolution time.Duration) []model.Rollup {
+	res := make([]model.Rollup, 0)
+
+	for _, r := range rollups {
+		ts := r.Timestamp.Truncate(resolution)
+		if n := len(res); n > 0 && res[n-1].Timestamp.Equal(ts) {
+			cur := &res[n-1]
+			cur.Count += r.Count
+			cur.Sum += r.Sum
+			cur.Min = min(cur.Min, r.Min)
+			cur.Max = max(cur.Max, r.Max)
+			cur.Last = r.Last
+			continue
+		}
+
+		r.Timestamp = ts
+		res = append(res, r)
+	}
+
+	return res
+}
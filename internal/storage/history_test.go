@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollupsIncludeUnrolledTail(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	h := &seriesHistory{raw: newRing(10)}
+	for _, s := range []model.Sample{
+		{Timestamp: t0.Add(10 * time.Second), Value: 1},
+		{Timestamp: t0.Add(20 * time.Second), Value: 2},
+		{Timestamp: t0.Add(70 * time.Second), Value: 3},
+		{Timestamp: t0.Add(130 * time.Second), Value: 4},
+	} {
+		h.raw.push(s)
+	}
+	h.rollup(t0.Add(2 * time.Minute))
+
+	last := func(rollups []model.Rollup) map[time.Time]float64 {
+		res := make(map[time.Time]float64)
+		for _, r := range rollups {
+			res[r.Timestamp] = r.Last
+		}
+		return res
+	}
+
+	// минуты 0 и 1 уже свёрнуты, значение третьей минуты ещё сырое
+	assert.Equal(t, map[time.Time]float64{
+		t0:                        2,
+		t0.Add(time.Minute):       3,
+		t0.Add(130 * time.Second): 4,
+	}, last(h.rollups(model.ResolutionMinute, t0, t0.Add(time.Hour))))
+
+	// часовых агрегатов ещё нет: весь час берётся из минутных и сырых
+	assert.Equal(t, map[time.Time]float64{
+		t0:                        2,
+		t0.Add(time.Minute):       3,
+		t0.Add(130 * time.Second): 4,
+	}, last(h.rollups(model.ResolutionHour, t0, t0.Add(time.Hour))))
+
+	// интервал целиком до свёрнутого хвост не добавляет
+	assert.Len(t, h.rollups(model.ResolutionMinute, t0, t0.Add(time.Minute)), 2)
+}
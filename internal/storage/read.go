@@ -1,33 +1,88 @@
 package storage
 
-import "fmt"
+import (
+	"fmt"
+	"math"
 
-func (s *MemStorage) ReadAll() map[string]string {
-	result := make(map[string]string)
+	"github.com/7StaSH7/gometrics/internal/model"
+)
 
-	for name, value := range s.counter {
-		result[name] = fmt.Sprint(value)
+func (s *MemStorage) ReadMetrics() []model.Metrics {
+	metrics := make([]model.Metrics, 0)
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		for _, series := range sh.gauges {
+			value := math.Float64frombits(series.bits.Load())
+			metrics = append(metrics, model.Metrics{
+				Tenant: series.tenant,
+				ID:     series.id,
+				MType:  model.Gauge,
+				Value:  &value,
+				Labels: series.labels,
+			})
+		}
+		for _, series := range sh.counter {
+			delta := series.value.Load()
+			metrics = append(metrics, model.Metrics{
+				Tenant: series.tenant,
+				ID:     series.id,
+				MType:  model.Counter,
+				Delta:  &delta,
+				Labels: series.labels,
+			})
+		}
+		for _, m := range sh.histograms {
+			metrics = append(metrics, *m)
+		}
+		for _, m := range sh.summaries {
+			metrics = append(metrics, *m)
+		}
+		sh.mu.RUnlock()
 	}
 
-	for name, value := range s.gauges {
-		result[name] = fmt.Sprint(value)
+	return metrics
+}
+
+func (s *MemStorage) ReadCounter(tenant, name string, labels model.Labels) (int64, error) {
+	series, exists := find(s, func(sh *shard) map[string]*counterSeries { return sh.counter }, tenant, name, labels)
+	if !exists {
+		return 0, fmt.Errorf("counter metric '%s' not found", model.SeriesKey(name, labels))
 	}
+	return series.value.Load(), nil
+}
 
-	return result
+func (s *MemStorage) ReadGauge(tenant, name string, labels model.Labels) (float64, error) {
+	series, exists := find(s, func(sh *shard) map[string]*gaugeSeries { return sh.gauges }, tenant, name, labels)
+	if !exists {
+		return 0, fmt.Errorf("gauge metric '%s' not found", model.SeriesKey(name, labels))
+	}
+	return math.Float64frombits(series.bits.Load()), nil
 }
 
-func (s *MemStorage) ReadCounter(name string) (int64, error) {
-	value, exists := s.counter[name]
+func (s *MemStorage) ReadHistogram(tenant, name string, labels model.Labels) (model.Metrics, error) {
+	m, exists := find(s, func(sh *shard) map[string]*model.Metrics { return sh.histograms }, tenant, name, labels)
 	if !exists {
-		return 0, fmt.Errorf("counter metric '%s' not found", name)
+		return model.Metrics{}, fmt.Errorf("histogram metric '%s' not found", model.SeriesKey(name, labels))
 	}
-	return value, nil
+	return *m, nil
 }
 
-func (s *MemStorage) ReadGauge(name string) (float64, error) {
-	value, exists := s.gauges[name]
+func (s *MemStorage) ReadSummary(tenant, name string, labels model.Labels) (model.Metrics, error) {
+	m, exists := find(s, func(sh *shard) map[string]*model.Metrics { return sh.summaries }, tenant, name, labels)
 	if !exists {
-		return 0, fmt.Errorf("gauge metric '%s' not found", name)
+		return model.Metrics{}, fmt.Errorf("summary metric '%s' not found", model.SeriesKey(name, labels))
 	}
-	return value, nil
+	return *m, nil
+}
+
+// find ищет серию в карте, которую series выбирает из нужной части хранилища.
+func find[T any](s *MemStorage, series func(sh *shard) map[string]*T, tenant, name string, labels model.Labels) (*T, bool) {
+	key := model.TenantSeriesKey(tenant, name, labels)
+	sh := s.shard(key)
+
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	v, ok := series(sh)[key]
+	return v, ok
 }
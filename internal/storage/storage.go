@@ -1,31 +1,101 @@
 package storage
 
 import (
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/model"
 )
 
+// shardCount — число независимо блокируемых частей хранилища.
+const shardCount = 64
+
+type gaugeSeries struct {
+	tenant string
+	id     string
+	labels model.Labels
+	bits   atomic.Uint64 // math.Float64bits значения
+}
+
+type counterSeries struct {
+	tenant string
+	id     string
+	labels model.Labels
+	value  atomic.Int64
+}
+
+// shard — часть хранилища со своей блокировкой. Блокировка защищает только
+// сами карты: значения counter и gauge меняются атомарно, histogram и summary
+// заменяются целиком, история защищена собственной блокировкой.
+type shard struct {
+	mu         sync.RWMutex
+	gauges     map[string]*gaugeSeries
+	counter    map[string]*counterSeries
+	histograms map[string]*model.Metrics
+	summaries  map[string]*model.Metrics
+	history    map[string]*seriesHistory
+}
+
 type MemStorage struct {
-	gauges   map[string]float64
-	counter  map[string]int64
+	shards   [shardCount]*shard
+	seed     maphash.Seed
 	filePath string
-	isSync   bool
+
+	// walMu упорядочивает изменения и запись в журнал относительно снапшотов
+	walMu sync.Mutex
+	wal   *wal
+
+	historySize int
 }
 
 type MemStorageInterface interface {
-	Replace(name string, value float64)
-	Add(name string, value int64)
-	ReadCounter(name string) (int64, error)
-	ReadGauge(name string) (float64, error)
-	ReadAll() map[string]string
+	Replace(tenant, name string, labels model.Labels, value float64) error
+	Add(tenant, name string, labels model.Labels, value int64) error
+	MergeHistogram(tenant, name string, labels model.Labels, delta model.Metrics) error
+	ReplaceSummary(tenant, name string, labels model.Labels, value model.Metrics) error
+	Updates(metrics []model.Metrics) error
+	ReadCounter(tenant, name string, labels model.Labels) (int64, error)
+	ReadGauge(tenant, name string, labels model.Labels) (float64, error)
+	ReadHistogram(tenant, name string, labels model.Labels) (model.Metrics, error)
+	ReadSummary(tenant, name string, labels model.Labels) (model.Metrics, error)
+	// ReadMetrics возвращает метрики всех арендаторов, каждая с заполненным Tenant.
+	ReadMetrics() []model.Metrics
+	ReadRange(q model.RangeQuery) []model.Sample
+	Aggregate(q model.RangeQuery) []model.Sample
+	Compact(now time.Time, policy model.RetentionPolicy)
 	Store() error
 	Restore() error
+	Close() error
 }
 
 func NewStorage(cfg *config.ServerConfig) MemStorageInterface {
-	return &MemStorage{
-		gauges:   make(map[string]float64),
-		counter:  make(map[string]int64),
+	s := &MemStorage{
+		seed:     maphash.MakeSeed(),
 		filePath: cfg.StoreFilePath,
-		isSync:   cfg.StoreInterval == 0,
+
+		historySize: cfg.HistorySize,
 	}
+	for i := range s.shards {
+		s.shards[i] = &shard{
+			gauges:     make(map[string]*gaugeSeries),
+			counter:    make(map[string]*counterSeries),
+			histograms: make(map[string]*model.Metrics),
+			summaries:  make(map[string]*model.Metrics),
+			history:    make(map[string]*seriesHistory),
+		}
+	}
+
+	return s
+}
+
+// shard возвращает часть хранилища, в которой лежит серия с ключом model.TenantSeriesKey.
+func (s *MemStorage) shard(key string) *shard {
+	return s.shards[s.shardIndex(key)]
+}
+
+func (s *MemStorage) shardIndex(key string) uint64 {
+	return maphash.String(s.seed, key) % shardCount
 }
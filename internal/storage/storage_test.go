@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// batch — пачка, похожая на ту, что агент присылает в /updates/.
+func batch(worker, i int) []model.Metrics {
+	latency := model.Observation(float64(i%10), []float64{1, 5})
+	latency.ID = "Latency"
+
+	return []model.Metrics{
+		{ID: "PollCount", MType: model.Counter, Delta: ptr(int64(1))},
+		{ID: "PollCount", MType: model.Counter, Labels: model.Labels{"host": fmt.Sprint(worker % 4)}, Delta: ptr(int64(1))},
+		{ID: "Alloc", MType: model.Gauge, Labels: model.Labels{"host": fmt.Sprint(worker)}, Value: ptr(float64(i))},
+		{ID: "RandomValue", MType: model.Gauge, Value: ptr(float64(worker))},
+		latency,
+	}
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	const workers, batches = 8, 200
+
+	tests := []struct {
+		name string
+		cfg  func(t *testing.T) *config.ServerConfig
+	}{
+		{
+			name: "memory",
+			cfg: func(t *testing.T) *config.ServerConfig {
+				return &config.ServerConfig{HistorySize: 100}
+			},
+		},
+		{
+			name: "memory without history",
+			cfg: func(t *testing.T) *config.ServerConfig {
+				return &config.ServerConfig{}
+			},
+		},
+		{
+			name: "file",
+			cfg: func(t *testing.T) *config.ServerConfig {
+				return &config.ServerConfig{HistorySize: 100, StoreFilePath: filepath.Join(t.TempDir(), "metrics.json")}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg(t)
+			s := NewStorage(cfg)
+
+			done := make(chan struct{})
+			var readers sync.WaitGroup
+			readers.Add(1)
+			go func() {
+				defer readers.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+
+					assert.NoError(t, s.Store())
+					s.ReadMetrics()
+					s.ReadRange(model.RangeQuery{ID: "PollCount", MType: model.Counter, To: time.Now()})
+					s.Compact(time.Now(), model.RetentionPolicy{Raw: time.Hour})
+				}
+			}()
+
+			var writers sync.WaitGroup
+			for w := 0; w < workers; w++ {
+				writers.Add(1)
+				go func() {
+					defer writers.Done()
+					for i := 0; i < batches; i++ {
+						assert.NoError(t, s.Updates(batch(w, i)))
+					}
+				}()
+			}
+			writers.Wait()
+			close(done)
+			readers.Wait()
+
+			total, err := s.ReadCounter("", "PollCount", nil)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(workers*batches), total)
+
+			h, err := s.ReadHistogram("", "Latency", nil)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(workers*batches), *h.Count)
+
+			if cfg.StoreFilePath == "" {
+				return
+			}
+
+			// после «падения» без Close состояние восстанавливается из снапшота и журнала
+			restored := NewStorage(cfg)
+			assert.NoError(t, restored.Restore())
+
+			total, err = restored.ReadCounter("", "PollCount", nil)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(workers*batches), total)
+
+			h, err = restored.ReadHistogram("", "Latency", nil)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(workers*batches), *h.Count)
+		})
+	}
+}
+
+func TestCounterHistoryOrder(t *testing.T) {
+	s := NewStorage(&config.ServerConfig{HistorySize: 10000})
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				assert.NoError(t, s.Add("", "PollCount", nil, 1))
+			}
+		}()
+	}
+	wg.Wait()
+
+	samples := s.ReadRange(model.RangeQuery{ID: "PollCount", MType: model.Counter, To: time.Now()})
+	assert.Len(t, samples, 4000)
+	for i := 1; i < len(samples); i++ {
+		assert.Equal(t, samples[i-1].Value+1, samples[i].Value)
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	cfg := &config.ServerConfig{HistorySize: 10, StoreFilePath: filepath.Join(t.TempDir(), "metrics.json")}
+	s := NewStorage(cfg)
+
+	labels := model.Labels{"host": "a"}
+	assert.NoError(t, s.Add("", "PollCount", labels, 1))
+	assert.NoError(t, s.Add("team-a", "PollCount", labels, 10))
+	assert.NoError(t, s.Updates([]model.Metrics{
+		{Tenant: "team-b", ID: "PollCount", MType: model.Counter, Labels: labels, Delta: ptr(int64(100))},
+		{Tenant: "team-b", ID: "Alloc", MType: model.Gauge, Value: ptr(1.5)},
+	}))
+	assert.NoError(t, s.Store())
+	assert.NoError(t, s.Add("team-a", "PollCount", labels, 10))
+
+	restored := NewStorage(cfg)
+	assert.NoError(t, restored.Restore())
+
+	for _, st := range []MemStorageInterface{s, restored} {
+		for tenant, expected := range map[string]int64{"": 1, "team-a": 20, "team-b": 100} {
+			total, err := st.ReadCounter(tenant, "PollCount", labels)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, total)
+		}
+
+		_, err := st.ReadGauge("team-b", "Alloc", nil)
+		assert.NoError(t, err)
+		_, err = st.ReadGauge("team-a", "Alloc", nil)
+		assert.Error(t, err)
+	}
+
+	samples := s.ReadRange(model.RangeQuery{Tenant: "team-a", ID: "PollCount", MType: model.Counter, Labels: labels, To: time.Now()})
+	assert.Len(t, samples, 2)
+}
+
+func BenchmarkUpdates(b *testing.B) {
+	benchmarks := []struct {
+		name     string
+		history  int
+		snapshot bool
+	}{
+		{name: "no history", history: 0},
+		{name: "history", history: 1000},
+		{name: "history with snapshots", history: 1000, snapshot: true},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			s := NewStorage(&config.ServerConfig{HistorySize: bm.history})
+
+			done := make(chan struct{})
+			defer close(done)
+			if bm.snapshot {
+				go func() {
+					for {
+						select {
+						case <-done:
+							return
+						default:
+							s.ReadMetrics()
+						}
+					}
+				}()
+			}
+
+			var worker int
+			var mu sync.Mutex
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				mu.Lock()
+				w := worker
+				worker++
+				mu.Unlock()
+
+				for i := 0; pb.Next(); i++ {
+					if err := s.Updates(batch(w, i)); err != nil {
+						b.Error(err)
+					}
+				}
+			})
+		})
+	}
+}
@@ -5,98 +5,207 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"math"
 	"os"
+	"path/filepath"
 
 	"github.com/7StaSH7/gometrics/internal/model"
 )
 
+// snapshot — содержимое файла хранилища. Seq — номер последней записи журнала,
+// уже учтённой в снапшоте.
+type snapshot struct {
+	Seq     uint64   `json:"seq"`
+	Metrics []record `json:"metrics"`
+}
+
+// record — метрика в снапшоте и журнале. Арендатор хранится отдельным полем:
+// в JSON model.Metrics он не попадает.
+type record struct {
+	model.Metrics
+	Tenant string `json:"tenant,omitempty"`
+}
+
+func toRecords(metrics []model.Metrics) []record {
+	records := make([]record, len(metrics))
+	for i, m := range metrics {
+		records[i] = record{Metrics: m, Tenant: m.Tenant}
+	}
+
+	return records
+}
+
+func fromRecords(records []record) []model.Metrics {
+	metrics := make([]model.Metrics, len(records))
+	for i, r := range records {
+		metrics[i] = r.Metrics
+		metrics[i].Tenant = r.Tenant
+	}
+
+	return metrics
+}
+
+// Store сворачивает журнал в снапшот: записывает текущее состояние и очищает журнал.
 func (s *MemStorage) Store() error {
-	metrics := make([]model.Metrics, 0)
-	for name, value := range s.gauges {
-		metrics = append(metrics, model.Metrics{
-			ID:    name,
-			MType: model.Gauge,
-			Value: &value,
-		})
-	}
-	for name, value := range s.counter {
-		metrics = append(metrics, model.Metrics{
-			ID:    name,
-			MType: model.Counter,
-			Delta: &value,
-		})
-	}
-
-	if err := s.write(metrics); err != nil {
-		return err
+	if s.filePath == "" {
+		return nil
 	}
 
-	return nil
+	s.walMu.Lock()
+	defer s.walMu.Unlock()
+
+	return s.store()
 }
 
+// Restore загружает снапшот и применяет поверх него записи журнала.
 func (s *MemStorage) Restore() error {
-	file, err := os.OpenFile(s.filePath, os.O_RDONLY, 0666)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return nil
-		}
+	if s.filePath == "" {
+		return nil
+	}
+
+	s.walMu.Lock()
+	defer s.walMu.Unlock()
 
+	snap, err := s.read()
+	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	r := bufio.NewReader(file)
+	for _, metric := range fromRecords(snap.Metrics) {
+		if err := s.load(metric); err != nil {
+			return err
+		}
+	}
 
-	data, _, err := r.ReadLine()
-	if err != nil {
-		if err != io.EOF {
+	if s.wal == nil {
+		if s.wal, err = openWAL(s.walPath()); err != nil {
 			return err
 		}
 	}
 
-	metrics := []model.Metrics{}
-	json.Unmarshal(data, &metrics)
+	return s.wal.replay(snap.Seq, s.applyBatch)
+}
 
-	for _, metric := range metrics {
-		switch metric.MType {
-		case model.Counter:
-			{
-				s.counter[metric.ID] = *metric.Delta
-			}
-		case model.Gauge:
-			{
-				s.gauges[metric.ID] = *metric.Value
-			}
-		}
+// Close сворачивает журнал и закрывает его.
+func (s *MemStorage) Close() error {
+	if err := s.Store(); err != nil {
+		return err
+	}
+
+	s.walMu.Lock()
+	defer s.walMu.Unlock()
+
+	if s.wal == nil {
+		return nil
+	}
+	err := s.wal.close()
+	s.wal = nil
+
+	return err
+}
+
+// load кладёт в хранилище значение из снапшота как есть, без накопления.
+func (s *MemStorage) load(m model.Metrics) error {
+	key := model.TenantSeriesKey(m.Tenant, m.ID, m.Labels)
+	sh := s.shard(key)
+
+	switch m.MType {
+	case model.Counter:
+		series := &counterSeries{tenant: m.Tenant, id: m.ID, labels: m.Labels.Normalize()}
+		series.value.Store(*m.Delta)
+
+		sh.mu.Lock()
+		sh.counter[key] = series
+		sh.mu.Unlock()
+	case model.Gauge:
+		series := &gaugeSeries{tenant: m.Tenant, id: m.ID, labels: m.Labels.Normalize()}
+		series.bits.Store(math.Float64bits(*m.Value))
+
+		sh.mu.Lock()
+		sh.gauges[key] = series
+		sh.mu.Unlock()
+	case model.Histogram:
+		return s.mergeHistogram(m.Tenant, m.ID, m.Labels, m)
+	case model.Summary:
+		s.replaceSummary(m.Tenant, m.ID, m.Labels, m)
 	}
 
 	return nil
 }
 
-func (s *MemStorage) write(metrics []model.Metrics) error {
-	file, err := os.OpenFile(s.filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+func (s *MemStorage) walPath() string {
+	return s.filePath + ".wal"
+}
+
+func (s *MemStorage) store() error {
+	if s.wal == nil {
+		var err error
+		if s.wal, err = openWAL(s.walPath()); err != nil {
+			return err
+		}
+	}
+
+	if err := s.write(snapshot{Seq: s.wal.seq, Metrics: toRecords(s.ReadMetrics())}); err != nil {
+		return err
+	}
+
+	return s.wal.reset()
+}
+
+// read читает снапшот. Файл старого формата — просто массив метрик без журнала.
+func (s *MemStorage) read() (snapshot, error) {
+	var snap snapshot
+
+	file, err := os.OpenFile(s.filePath, os.O_RDONLY, 0666)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return nil
+			return snap, nil
 		}
 
-		return err
+		return snap, err
 	}
 	defer file.Close()
 
-	r := bufio.NewWriter(file)
+	var raw json.RawMessage
+	if err := json.NewDecoder(bufio.NewReader(file)).Decode(&raw); err != nil {
+		if errors.Is(err, io.EOF) {
+			return snap, nil
+		}
+
+		return snap, err
+	}
+
+	if len(raw) > 0 && raw[0] == '[' {
+		err = json.Unmarshal(raw, &snap.Metrics)
+	} else {
+		err = json.Unmarshal(raw, &snap)
+	}
+
+	return snap, err
+}
 
-	data, err := json.Marshal(metrics)
+// write атомарно заменяет снапшот: пишет во временный файл и переименовывает его.
+func (s *MemStorage) write(snap snapshot) error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.filePath), filepath.Base(s.filePath)+".*.tmp")
 	if err != nil {
 		return err
 	}
-	if _, err := r.Write(data); err != nil {
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	if err := json.NewEncoder(w).Encode(snap); err != nil {
 		return err
 	}
-
-	if err := r.Flush(); err != nil {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
 		return err
 	}
 
-	return nil
+	return os.Rename(tmp.Name(), s.filePath)
 }
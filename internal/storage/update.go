@@ -1,22 +1,274 @@
 package storage
 
 import (
+	"fmt"
+	"math"
+
 	"github.com/7StaSH7/gometrics/internal/logger"
+	"github.com/7StaSH7/gometrics/internal/model"
 	"go.uber.org/zap"
 )
 
-func (s *MemStorage) Replace(name string, value float64) {
-	logger.Log.Debug("replace value", zap.String("name", name), zap.Float64("value", value))
-	s.gauges[name] = value
-	if s.isSync {
-		s.Store()
+func (s *MemStorage) Replace(tenant, name string, labels model.Labels, value float64) error {
+	logger.Log.Debug("replace value", zap.String("tenant", tenant), zap.String("name", name), zap.Stringer("labels", labels), zap.Float64("value", value))
+
+	return s.Updates([]model.Metrics{{Tenant: tenant, ID: name, MType: model.Gauge, Labels: labels, Value: &value}})
+}
+
+func (s *MemStorage) Add(tenant, name string, labels model.Labels, value int64) error {
+	logger.Log.Debug("add value", zap.String("tenant", tenant), zap.String("name", name), zap.Stringer("labels", labels), zap.Int64("value", value))
+
+	return s.Updates([]model.Metrics{{Tenant: tenant, ID: name, MType: model.Counter, Labels: labels, Delta: &value}})
+}
+
+func (s *MemStorage) MergeHistogram(tenant, name string, labels model.Labels, delta model.Metrics) error {
+	logger.Log.Debug("merge histogram", zap.String("tenant", tenant), zap.String("name", name), zap.Stringer("labels", labels))
+	delta.Tenant, delta.ID, delta.MType, delta.Labels = tenant, name, model.Histogram, labels
+
+	return s.Updates([]model.Metrics{delta})
+}
+
+func (s *MemStorage) ReplaceSummary(tenant, name string, labels model.Labels, value model.Metrics) error {
+	logger.Log.Debug("replace summary", zap.String("tenant", tenant), zap.String("name", name), zap.Stringer("labels", labels))
+	value.Tenant, value.ID, value.MType, value.Labels = tenant, name, model.Summary, labels
+
+	return s.Updates([]model.Metrics{value})
+}
+
+// Updates применяет пачку целиком или не применяет ничего: сначала histogram пачки
+// сливаются с хранимыми сериями и проверяются, и только потом пачка применяется.
+// С файлом хранилища пачка пишется в журнал до того, как попадёт в память, так что
+// ошибка записи журнала не оставляет изменённой памяти. Без файла пачки применяются
+// параллельно, под блокировками частей хранилища.
+func (s *MemStorage) Updates(metrics []model.Metrics) error {
+	for _, m := range metrics {
+		if !model.IsKnownType(m.MType) {
+			return fmt.Errorf("unknown type '%s'", m.MType)
+		}
+	}
+
+	if s.filePath == "" {
+		return s.applyBatch(metrics)
+	}
+
+	s.walMu.Lock()
+	defer s.walMu.Unlock()
+
+	histograms, err := s.lockHistograms(metrics)
+	if err != nil {
+		return err
+	}
+	if err := s.appendWAL(metrics); err != nil {
+		histograms.unlock()
+		return err
+	}
+	histograms.commit()
+	for _, m := range metrics {
+		s.apply(m)
+	}
+
+	if s.wal.size > walCompactSize {
+		// пачка уже в журнале: сбой сворачивания не повод присылать её снова
+		if err := s.store(); err != nil {
+			logger.Log.Error("cannot compact wal into snapshot", zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+// applyBatch применяет пачку без записи в журнал.
+func (s *MemStorage) applyBatch(metrics []model.Metrics) error {
+	histograms, err := s.lockHistograms(metrics)
+	if err != nil {
+		return err
+	}
+	histograms.commit()
+
+	for _, m := range metrics {
+		s.apply(m)
+	}
+
+	return nil
+}
+
+func (s *MemStorage) appendWAL(metrics []model.Metrics) error {
+	if s.wal == nil {
+		var err error
+		if s.wal, err = openWAL(s.walPath()); err != nil {
+			return err
+		}
+	}
+
+	return s.wal.append(metrics)
+}
+
+// apply применяет обновление counter, gauge или summary: они не могут не примениться.
+// Histogram применяются через lockHistograms.
+func (s *MemStorage) apply(m model.Metrics) {
+	switch m.MType {
+	case model.Counter:
+		s.add(m.Tenant, m.ID, m.Labels, *m.Delta)
+	case model.Gauge:
+		s.replace(m.Tenant, m.ID, m.Labels, *m.Value)
+	case model.Summary:
+		s.replaceSummary(m.Tenant, m.ID, m.Labels, m)
 	}
 }
 
-func (s *MemStorage) Add(name string, value int64) {
-	logger.Log.Debug("add value", zap.String("name", name), zap.Int64("value", value))
-	s.counter[name] += value
-	if s.isSync {
-		s.Store()
+// pendingHistograms — histogram пачки, уже слитые с хранимыми сериями, но ещё
+// не записанные. Части хранилища с этими сериями заблокированы до commit или unlock.
+type pendingHistograms struct {
+	s      *MemStorage
+	shards []*shard
+	merged map[string]*model.Metrics
+}
+
+// lockHistograms блокирует части хранилища с histogram пачки (по порядку номеров,
+// чтобы параллельные пачки не ждали друг друга по кругу) и сливает их с хранимыми
+// сериями. Если хоть одна не сливается, блокировки снимаются и ничего не меняется.
+func (s *MemStorage) lockHistograms(metrics []model.Metrics) (*pendingHistograms, error) {
+	p := &pendingHistograms{s: s, merged: make(map[string]*model.Metrics)}
+
+	var locked [shardCount]bool
+	for _, m := range metrics {
+		if m.MType == model.Histogram {
+			locked[s.shardIndex(model.TenantSeriesKey(m.Tenant, m.ID, m.Labels))] = true
+		}
 	}
+	for i, ok := range locked {
+		if ok {
+			s.shards[i].mu.Lock()
+			p.shards = append(p.shards, s.shards[i])
+		}
+	}
+
+	for _, m := range metrics {
+		if m.MType != model.Histogram {
+			continue
+		}
+
+		key := model.TenantSeriesKey(m.Tenant, m.ID, m.Labels)
+		stored, ok := p.merged[key]
+		if !ok {
+			if stored, ok = s.shard(key).histograms[key]; !ok {
+				stored = &model.Metrics{Tenant: m.Tenant, ID: m.ID, MType: model.Histogram, Labels: m.Labels.Normalize()}
+			}
+		}
+
+		merged := *stored
+		if err := model.MergeHistogram(&merged, m); err != nil {
+			p.unlock()
+			return nil, err
+		}
+		p.merged[key] = &merged
+	}
+
+	return p, nil
+}
+
+func (p *pendingHistograms) commit() {
+	for key, m := range p.merged {
+		p.s.shard(key).histograms[key] = m
+	}
+	p.unlock()
+}
+
+func (p *pendingHistograms) unlock() {
+	for _, sh := range p.shards {
+		sh.mu.Unlock()
+	}
+}
+
+func (s *MemStorage) replace(tenant, name string, labels model.Labels, value float64) {
+	key := model.TenantSeriesKey(tenant, name, labels)
+	sh := s.shard(key)
+	series := getOrCreate(sh, sh.gauges, key, func() *gaugeSeries {
+		return &gaugeSeries{tenant: tenant, id: name, labels: labels.Normalize()}
+	})
+
+	if s.historySize <= 0 {
+		series.bits.Store(math.Float64bits(value))
+		return
+	}
+
+	h := s.lockHistory(sh, historyKey(model.Gauge, key))
+	defer h.mu.Unlock()
+	series.bits.Store(math.Float64bits(value))
+	h.record(value)
+}
+
+func (s *MemStorage) add(tenant, name string, labels model.Labels, value int64) {
+	key := model.TenantSeriesKey(tenant, name, labels)
+	sh := s.shard(key)
+	series := getOrCreate(sh, sh.counter, key, func() *counterSeries {
+		return &counterSeries{tenant: tenant, id: name, labels: labels.Normalize()}
+	})
+
+	if s.historySize <= 0 {
+		series.value.Add(value)
+		return
+	}
+
+	// история должна видеть значения в том же порядке, в каком они получены
+	h := s.lockHistory(sh, historyKey(model.Counter, key))
+	defer h.mu.Unlock()
+	h.record(float64(series.value.Add(value)))
+}
+
+func (s *MemStorage) mergeHistogram(tenant, name string, labels model.Labels, delta model.Metrics) error {
+	key := model.TenantSeriesKey(tenant, name, labels)
+	sh := s.shard(key)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	stored, ok := sh.histograms[key]
+	if !ok {
+		stored = &model.Metrics{Tenant: tenant, ID: name, MType: model.Histogram, Labels: labels.Normalize()}
+	}
+
+	merged := *stored
+	if err := model.MergeHistogram(&merged, delta); err != nil {
+		return err
+	}
+	sh.histograms[key] = &merged
+
+	return nil
+}
+
+func (s *MemStorage) replaceSummary(tenant, name string, labels model.Labels, value model.Metrics) {
+	value.Tenant, value.ID, value.MType, value.Labels = tenant, name, model.Summary, labels.Normalize()
+	value.Delta, value.Value, value.Buckets, value.Hash = nil, nil, nil, ""
+	value.Quantiles = append([]model.Quantile(nil), value.Quantiles...)
+
+	key := model.TenantSeriesKey(tenant, name, labels)
+	sh := s.shard(key)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	sh.summaries[key] = &value
+}
+
+// getOrCreate находит серию в карте части хранилища, при отсутствии создаёт её.
+// Обычный путь — только под блокировкой на чтение.
+func getOrCreate[T any](sh *shard, series map[string]*T, key string, create func() *T) *T {
+	sh.mu.RLock()
+	v, ok := series[key]
+	sh.mu.RUnlock()
+	if ok {
+		return v
+	}
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if v, ok := series[key]; ok {
+		return v
+	}
+	v = create()
+	series[key] = v
+
+	return v
 }
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/7StaSH7/gometrics/internal/logger"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"go.uber.org/zap"
+)
+
+// walCompactSize — размер журнала, после которого он сворачивается в снапшот,
+// не дожидаясь очередного Store.
+const walCompactSize = 16 << 20
+
+// walRecord — одна запись журнала: пачка обновлений, применённая целиком.
+// Для counter и histogram в ней приращения, для gauge и summary — новые значения.
+type walRecord struct {
+	Seq     uint64   `json:"seq"`
+	Metrics []record `json:"metrics"`
+}
+
+// wal — журнал обновлений, дописываемый в конец файла. Каждая запись — строка JSON,
+// после записи файл сбрасывается на диск.
+type wal struct {
+	file *os.File
+	seq  uint64
+	size int64
+}
+
+func openWAL(path string) (*wal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &wal{file: file, size: info.Size()}, nil
+}
+
+func (w *wal) append(metrics []model.Metrics) error {
+	data, err := json.Marshal(walRecord{Seq: w.seq + 1, Metrics: toRecords(metrics)})
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	n, err := w.file.Write(data)
+	w.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	w.seq++
+
+	return nil
+}
+
+// replay применяет записи с номером больше after. Хвост, оборванный при падении,
+// отрезается, чтобы новые записи не шли следом за мусором.
+func (w *wal) replay(after uint64, apply func(metrics []model.Metrics) error) error {
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	w.seq = after
+	dec := json.NewDecoder(bufio.NewReader(w.file))
+	for {
+		good := dec.InputOffset()
+
+		var rec walRecord
+		if err := dec.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			logger.Log.Warn("truncate broken wal tail", zap.Int64("offset", good), zap.Error(err))
+			if err := w.file.Truncate(good); err != nil {
+				return err
+			}
+			w.size = good
+			return w.file.Sync()
+		}
+
+		if rec.Seq <= after {
+			continue
+		}
+		if err := apply(fromRecords(rec.Metrics)); err != nil {
+			return err
+		}
+		w.seq = rec.Seq
+	}
+}
+
+// reset очищает журнал после того, как его записи попали в снапшот.
+// Нумерация записей продолжается.
+func (w *wal) reset() error {
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	w.size = 0
+
+	return w.file.Sync()
+}
+
+func (w *wal) close() error {
+	return w.file.Close()
+}
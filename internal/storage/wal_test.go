@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/7StaSH7/gometrics/internal/config"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openFileStorage открывает хранилище с файлом path так же, как сервер с -r.
+func openFileStorage(t *testing.T, path string) *MemStorage {
+	t.Helper()
+
+	s := NewStorage(&config.ServerConfig{StoreFilePath: path}).(*MemStorage)
+	require.NoError(t, s.Restore())
+
+	return s
+}
+
+// crash закрывает журнал без снапшота, как при падении процесса.
+func crash(t *testing.T, s *MemStorage) {
+	t.Helper()
+
+	require.NoError(t, s.wal.close())
+	s.wal = nil
+}
+
+func counter(t *testing.T, s MemStorageInterface, name string) int64 {
+	t.Helper()
+
+	v, err := s.ReadCounter("", name, nil)
+	require.NoError(t, err)
+
+	return v
+}
+
+func TestWALReplayAfterCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	s := openFileStorage(t, path)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, s.Updates(batch(0, i)))
+	}
+	crash(t, s)
+
+	restored := openFileStorage(t, path)
+	assert.Equal(t, int64(3), counter(t, restored, "PollCount"))
+	h, err := restored.ReadHistogram("", "Latency", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), *h.Count)
+}
+
+func TestWALTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	s := openFileStorage(t, path)
+	require.NoError(t, s.Add("", "PollCount", nil, 1))
+	require.NoError(t, s.Add("", "PollCount", nil, 2))
+	crash(t, s)
+
+	// запись, оборванная на середине
+	wal, err := os.OpenFile(path+".wal", os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = wal.WriteString(`{"seq":3,"metrics":[{"id":"PollCount","ty`)
+	require.NoError(t, err)
+	require.NoError(t, wal.Close())
+
+	s = openFileStorage(t, path)
+	assert.Equal(t, int64(3), counter(t, s, "PollCount"))
+
+	// новые записи идут сразу за целыми, а не за мусором
+	require.NoError(t, s.Add("", "PollCount", nil, 4))
+	crash(t, s)
+
+	restored := openFileStorage(t, path)
+	assert.Equal(t, int64(7), counter(t, restored, "PollCount"))
+}
+
+func TestWALCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	s := openFileStorage(t, path)
+	require.NoError(t, s.Add("", "PollCount", nil, 1))
+	require.NoError(t, s.Add("", "PollCount", nil, 2))
+	logged, err := os.ReadFile(path + ".wal")
+	require.NoError(t, err)
+
+	require.NoError(t, s.Store())
+	info, err := os.Stat(path + ".wal")
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+
+	require.NoError(t, s.Add("", "PollCount", nil, 4))
+	crash(t, s)
+
+	restored := openFileStorage(t, path)
+	assert.Equal(t, int64(7), counter(t, restored, "PollCount"))
+	crash(t, restored)
+
+	// падение между записью снапшота и очисткой журнала: записи,
+	// уже учтённые в снапшоте, не применяются второй раз
+	wal, err := os.OpenFile(path+".wal", os.O_WRONLY|os.O_TRUNC, 0600)
+	require.NoError(t, err)
+	_, err = wal.Write(logged)
+	require.NoError(t, err)
+	require.NoError(t, wal.Close())
+
+	restored = openFileStorage(t, path)
+	assert.Equal(t, int64(3), counter(t, restored, "PollCount"))
+}
+
+func TestUpdatesAreAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	s := openFileStorage(t, path)
+
+	latency := model.Observation(1, []float64{1, 5})
+	latency.ID = "Latency"
+	require.NoError(t, s.Updates([]model.Metrics{latency}))
+
+	other := model.Observation(1, []float64{10})
+	other.ID = "Latency"
+	err := s.Updates([]model.Metrics{
+		{ID: "PollCount", MType: model.Counter, Delta: ptr(int64(1))},
+		latency,
+		other,
+	})
+	require.ErrorIs(t, err, model.ErrBucketsMismatch)
+
+	_, err = s.ReadCounter("", "PollCount", nil)
+	assert.Error(t, err)
+	h, err := s.ReadHistogram("", "Latency", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), *h.Count)
+
+	// отклонённая пачка не попала и в журнал
+	crash(t, s)
+	restored := openFileStorage(t, path)
+	_, err = restored.ReadCounter("", "PollCount", nil)
+	assert.Error(t, err)
+}
+
+func TestUpdatesWALFailure(t *testing.T) {
+	s := openFileStorage(t, filepath.Join(t.TempDir(), "metrics.json"))
+	require.NoError(t, s.Add("", "PollCount", nil, 1))
+
+	// журнал, в который больше нельзя писать
+	require.NoError(t, s.wal.file.Close())
+
+	assert.Error(t, s.Add("", "PollCount", nil, 2))
+	assert.Equal(t, int64(1), counter(t, s, "PollCount"))
+}
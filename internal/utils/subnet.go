@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// RealIPHeader — заголовок, в котором агент передаёт адрес своего исходящего интерфейса.
+const RealIPHeader = "X-Real-IP"
+
+// ParseSubnets разбирает список CIDR через запятую, IPv4 и IPv6 вперемешку.
+func ParseSubnets(s string) ([]netip.Prefix, error) {
+	subnets := make([]netip.Prefix, 0)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(part)
+		if err != nil {
+			return nil, fmt.Errorf("bad trusted subnet %q: %w", part, err)
+		}
+		subnets = append(subnets, prefix.Masked())
+	}
+
+	return subnets, nil
+}
+
+// InSubnets сообщает, входит ли адрес ip хотя бы в одну из подсетей.
+// IPv4, записанный как IPv6 (::ffff:10.0.0.1), сверяется с IPv4-подсетями.
+func InSubnets(subnets []netip.Prefix, ip string) bool {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, subnet := range subnets {
+		if subnet.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
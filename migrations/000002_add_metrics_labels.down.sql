@@ -0,0 +1,6 @@
+DELETE FROM metrics WHERE labels <> '{}'::jsonb;
+
+DROP INDEX IF EXISTS metrics_id_labels_uindex;
+CREATE UNIQUE INDEX IF NOT EXISTS metrics_id_uindex ON metrics (id);
+
+ALTER TABLE metrics DROP COLUMN IF EXISTS labels;
@@ -0,0 +1,4 @@
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+DROP INDEX IF EXISTS metrics_id_uindex;
+CREATE UNIQUE INDEX IF NOT EXISTS metrics_id_labels_uindex ON metrics (id, labels);
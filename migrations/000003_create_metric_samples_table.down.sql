@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS metric_samples_series_ts_index;
+DROP TABLE IF EXISTS metric_samples;
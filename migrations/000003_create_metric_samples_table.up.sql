@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS metric_samples (
+  id TEXT NOT NULL,
+  labels JSONB NOT NULL DEFAULT '{}'::jsonb,
+  mType TEXT NOT NULL,
+  ts TIMESTAMPTZ NOT NULL DEFAULT now(),
+  value DOUBLE PRECISION NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS metric_samples_series_ts_index ON metric_samples (id, mType, labels, ts);
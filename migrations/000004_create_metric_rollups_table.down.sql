@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS metric_samples_ts_index;
+DROP INDEX IF EXISTS metric_rollups_series_ts_uindex;
+DROP TABLE IF EXISTS metric_rollups;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS metric_rollups (
+  id TEXT NOT NULL,
+  labels JSONB NOT NULL DEFAULT '{}'::jsonb,
+  mType TEXT NOT NULL,
+  resolution INTEGER NOT NULL,
+  ts TIMESTAMPTZ NOT NULL,
+  count BIGINT NOT NULL,
+  sum DOUBLE PRECISION NOT NULL,
+  min DOUBLE PRECISION NOT NULL,
+  max DOUBLE PRECISION NOT NULL,
+  last DOUBLE PRECISION NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS metric_rollups_series_ts_uindex ON metric_rollups (id, mType, labels, resolution, ts);
+CREATE INDEX IF NOT EXISTS metric_samples_ts_index ON metric_samples (ts);
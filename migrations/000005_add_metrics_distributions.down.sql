@@ -0,0 +1,6 @@
+DELETE FROM metrics WHERE mType IN ('histogram', 'summary');
+
+ALTER TABLE metrics DROP COLUMN IF EXISTS quantiles;
+ALTER TABLE metrics DROP COLUMN IF EXISTS buckets;
+ALTER TABLE metrics DROP COLUMN IF EXISTS sum;
+ALTER TABLE metrics DROP COLUMN IF EXISTS count;
@@ -0,0 +1,4 @@
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS count BIGINT;
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS sum DOUBLE PRECISION;
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS buckets JSONB;
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS quantiles JSONB;
@@ -0,0 +1,16 @@
+DROP TABLE IF EXISTS agent_keys;
+
+DELETE FROM metric_rollups WHERE tenant <> '';
+DROP INDEX IF EXISTS metric_rollups_tenant_series_ts_uindex;
+CREATE UNIQUE INDEX IF NOT EXISTS metric_rollups_series_ts_uindex ON metric_rollups (id, mType, labels, resolution, ts);
+ALTER TABLE metric_rollups DROP COLUMN IF EXISTS tenant;
+
+DELETE FROM metric_samples WHERE tenant <> '';
+DROP INDEX IF EXISTS metric_samples_tenant_series_ts_index;
+CREATE INDEX IF NOT EXISTS metric_samples_series_ts_index ON metric_samples (id, mType, labels, ts);
+ALTER TABLE metric_samples DROP COLUMN IF EXISTS tenant;
+
+DELETE FROM metrics WHERE tenant <> '';
+DROP INDEX IF EXISTS metrics_tenant_id_labels_uindex;
+CREATE UNIQUE INDEX IF NOT EXISTS metrics_id_labels_uindex ON metrics (id, labels);
+ALTER TABLE metrics DROP COLUMN IF EXISTS tenant;
@@ -0,0 +1,20 @@
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT '';
+
+DROP INDEX IF EXISTS metrics_id_labels_uindex;
+CREATE UNIQUE INDEX IF NOT EXISTS metrics_tenant_id_labels_uindex ON metrics (tenant, id, labels);
+
+ALTER TABLE metric_samples ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT '';
+
+DROP INDEX IF EXISTS metric_samples_series_ts_index;
+CREATE INDEX IF NOT EXISTS metric_samples_tenant_series_ts_index ON metric_samples (tenant, id, mType, labels, ts);
+
+ALTER TABLE metric_rollups ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT '';
+
+DROP INDEX IF EXISTS metric_rollups_series_ts_uindex;
+CREATE UNIQUE INDEX IF NOT EXISTS metric_rollups_tenant_series_ts_uindex ON metric_rollups (tenant, id, mType, labels, resolution, ts);
+
+CREATE TABLE IF NOT EXISTS agent_keys (
+  agent TEXT PRIMARY KEY,
+  key TEXT NOT NULL,
+  tenant TEXT NOT NULL DEFAULT ''
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS applied_batches (
+  tenant TEXT NOT NULL DEFAULT '',
+  batch_id TEXT NOT NULL,
+  applied_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (tenant, batch_id)
+);
+
+CREATE INDEX IF NOT EXISTS applied_batches_applied_at_index ON applied_batches (applied_at);
@@ -0,0 +1,5 @@
+DELETE FROM metrics a USING metrics b
+WHERE a.tenant = b.tenant AND a.id = b.id AND a.labels = b.labels AND a.mType > b.mType;
+
+DROP INDEX IF EXISTS metrics_tenant_id_mtype_labels_uindex;
+CREATE UNIQUE INDEX IF NOT EXISTS metrics_tenant_id_labels_uindex ON metrics (tenant, id, labels);
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS metrics_tenant_id_labels_uindex;
+CREATE UNIQUE INDEX IF NOT EXISTS metrics_tenant_id_mtype_labels_uindex ON metrics (tenant, id, mType, labels);
+
+INSERT INTO metrics (tenant, id, labels, mType, delta)
+SELECT tenant, id, labels, 'counter', delta FROM metrics WHERE mType <> 'counter' AND delta IS NOT NULL;
+INSERT INTO metrics (tenant, id, labels, mType, value)
+SELECT tenant, id, labels, 'gauge', value FROM metrics WHERE mType <> 'gauge' AND value IS NOT NULL;
+
+UPDATE metrics SET delta = NULL WHERE mType <> 'counter';
+UPDATE metrics SET value = NULL WHERE mType <> 'gauge';
+UPDATE metrics SET count = NULL, sum = NULL, buckets = NULL, quantiles = NULL WHERE mType IN ('counter', 'gauge');
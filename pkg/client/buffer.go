@@ -0,0 +1,228 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/model"
+)
+
+// flushTimeout ограничивает одну отправку из Run. Отмена ctx в Run её
+// не прерывает: пачка, уже дошедшая до сервера, не должна считаться неотправленной.
+const flushTimeout = 5 * time.Second
+
+// Buffer копит значения метрик в памяти приложения и отправляет их пачкой
+// раз в интервал: counter — сумму приращений с прошлой отправки,
+// gauge — последнее значение, если оно менялось.
+type Buffer struct {
+	client   *Client
+	interval time.Duration
+
+	// flushMu не даёт отправкам идти одновременно: неотправленная пачка одна
+	flushMu sync.Mutex
+	// unsent — пачка, которая не дошла до сервера. Следующая отправка повторяет её
+	// с тем же идентификатором, поэтому применённую пачку сервер не применит снова.
+	unsent *batch
+
+	mu       sync.Mutex
+	counters map[string]*counterSeries
+	gauges   map[string]*gaugeSeries
+}
+
+type batch struct {
+	id      string
+	metrics []Metric
+}
+
+type counterSeries struct {
+	id      string
+	labels  Labels
+	pending int64
+}
+
+type gaugeSeries struct {
+	id     string
+	labels Labels
+	value  float64
+	dirty  bool
+}
+
+// NewBuffer создаёт буфер, который отправляет метрики через client раз в interval.
+func NewBuffer(client *Client, interval time.Duration) *Buffer {
+	return &Buffer{
+		client:   client,
+		interval: interval,
+		counters: make(map[string]*counterSeries),
+		gauges:   make(map[string]*gaugeSeries),
+	}
+}
+
+// Counter — накопительная метрика буфера.
+type Counter struct {
+	b      *Buffer
+	series *counterSeries
+}
+
+// Gauge — метрика буфера с последним значением.
+type Gauge struct {
+	b      *Buffer
+	series *gaugeSeries
+}
+
+// Counter возвращает counter name с лейблами labels. Повторный вызов
+// с теми же именем и лейблами возвращает ту же серию.
+func (b *Buffer) Counter(name string, labels Labels) *Counter {
+	labels = labels.Normalize()
+	key := model.SeriesKey(name, labels)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.counters[key]
+	if !ok {
+		s = &counterSeries{id: name, labels: labels}
+		b.counters[key] = s
+	}
+
+	return &Counter{b: b, series: s}
+}
+
+// Gauge возвращает gauge name с лейблами labels.
+func (b *Buffer) Gauge(name string, labels Labels) *Gauge {
+	labels = labels.Normalize()
+	key := model.SeriesKey(name, labels)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.gauges[key]
+	if !ok {
+		s = &gaugeSeries{id: name, labels: labels}
+		b.gauges[key] = s
+	}
+
+	return &Gauge{b: b, series: s}
+}
+
+// Add прибавляет delta к counter.
+func (c *Counter) Add(delta int64) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+
+	c.series.pending += delta
+}
+
+// Inc прибавляет к counter единицу.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Set задаёт значение gauge.
+func (g *Gauge) Set(value float64) {
+	g.b.mu.Lock()
+	defer g.b.mu.Unlock()
+
+	g.series.value = value
+	g.series.dirty = true
+}
+
+// Run отправляет накопленное раз в интервал, пока не отменён ctx, а после
+// отмены — в последний раз. Ошибки отправки передаются в onError, если он задан:
+// неотправленная пачка повторяется при следующей отправке.
+func (b *Buffer) Run(ctx context.Context, onError func(error)) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	flush := func() {
+		flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), flushTimeout)
+		defer cancel()
+
+		if err := b.Flush(flushCtx); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			flush()
+			return
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Flush отправляет накопленное сейчас. Сначала повторяется пачка, которая
+// не ушла в прошлый раз, и пока она не доставлена, новые значения копятся в буфере.
+// Пачку, которую сервер отверг (4xx), повторять бессмысленно: она выбрасывается.
+func (b *Buffer) Flush(ctx context.Context) error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	if b.unsent != nil {
+		if err := b.send(ctx); err != nil {
+			return err
+		}
+	}
+
+	batchID, err := newBatchID()
+	if err != nil {
+		return err
+	}
+	metrics := b.take()
+	if len(metrics) == 0 {
+		return nil
+	}
+	b.unsent = &batch{id: batchID, metrics: metrics}
+
+	return b.send(ctx)
+}
+
+// send отправляет b.unsent и забывает её, если сервер её принял или отверг.
+// Вызывается под b.flushMu.
+func (b *Buffer) send(ctx context.Context) error {
+	err := b.client.updateBatch(ctx, b.unsent.id, b.unsent.metrics)
+	if err == nil || rejected(err) {
+		b.unsent = nil
+	}
+
+	return err
+}
+
+// take забирает из буфера то, что нужно отправить.
+func (b *Buffer) take() []Metric {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var metrics []Metric
+	for _, s := range b.counters {
+		if s.pending == 0 {
+			continue
+		}
+		delta := s.pending
+		s.pending = 0
+		metrics = append(metrics, Metric{ID: s.id, MType: TypeCounter, Delta: &delta, Labels: s.labels})
+	}
+	for _, s := range b.gauges {
+		if !s.dirty {
+			continue
+		}
+		value := s.value
+		s.dirty = false
+		metrics = append(metrics, Metric{ID: s.id, MType: TypeGauge, Value: &value, Labels: s.labels})
+	}
+
+	return metrics
+}
+
+// rejected сообщает, что сервер отверг запрос и повтор ответа не изменит.
+func rejected(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) &&
+		statusErr.Code >= http.StatusBadRequest && statusErr.Code < http.StatusInternalServerError &&
+		statusErr.Code != http.StatusTooManyRequests
+}
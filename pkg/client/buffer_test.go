@@ -0,0 +1,164 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// plainBody распаковывает тело запроса.
+func plainBody(t *testing.T, r request) []byte {
+	t.Helper()
+
+	zr, err := gzip.NewReader(bytes.NewReader(r.body))
+	require.NoError(t, err)
+	plain, err := io.ReadAll(zr)
+	require.NoError(t, err)
+
+	return plain
+}
+
+// decodeBatch распаковывает тело /updates/.
+func decodeBatch(t *testing.T, r request) []Metric {
+	t.Helper()
+
+	var metrics []Metric
+	require.NoError(t, json.Unmarshal(plainBody(t, r), &metrics))
+
+	return metrics
+}
+
+func TestBuffer(t *testing.T) {
+	srv := newTestServer(t, "secret", nil)
+	c := newTestClient(t, srv.URL, Options{Key: "secret"})
+	b := NewBuffer(c, time.Hour)
+	ctx := context.Background()
+
+	requests := b.Counter("requests", Labels{"route": "/a", "empty": ""})
+	requests.Add(2)
+	requests.Inc()
+	// та же серия: пустые лейблы отбрасываются
+	b.Counter("requests", Labels{"route": "/a"}).Inc()
+	temp := b.Gauge("temp", nil)
+	temp.Set(20)
+	temp.Set(21.5)
+	b.Counter("idle", nil)
+
+	require.NoError(t, b.Flush(ctx))
+	requests.Inc()
+	require.NoError(t, b.Flush(ctx))
+
+	m, err := c.Value(ctx, TypeCounter, "requests", Labels{"route": "/a"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *m.Delta)
+
+	m, err = c.Value(ctx, TypeGauge, "temp", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 21.5, *m.Value)
+
+	// counter без приращений не отправляется
+	_, err = c.Value(ctx, TypeCounter, "idle", nil)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestBufferKeepsUnsentBatch(t *testing.T) {
+	srv, requests := recordingServer(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	c := newTestClient(t, srv.URL, Options{Retries: -1})
+	b := NewBuffer(c, time.Hour)
+	ctx := context.Background()
+
+	jobs := b.Counter("jobs", nil)
+	jobs.Add(5)
+	b.Gauge("temp", nil).Set(1)
+	require.Error(t, b.Flush(ctx))
+
+	// пока пачка не доставлена, новые приращения ждут в буфере
+	jobs.Add(1)
+	require.Error(t, b.Flush(ctx))
+	require.NoError(t, b.Flush(ctx))
+	// после успешной отправки отправлять нечего
+	require.NoError(t, b.Flush(ctx))
+
+	got := requests()
+	require.Len(t, got, 4)
+
+	// неотправленная пачка повторяется как есть, с тем же идентификатором
+	for _, r := range got[1:3] {
+		assert.Equal(t, got[0].header.Get(model.BatchIDHeader), r.header.Get(model.BatchIDHeader))
+		assert.ElementsMatch(t, decodeBatch(t, got[0]), decodeBatch(t, r))
+	}
+	sent := decodeBatch(t, got[0])
+	require.Len(t, sent, 2)
+	for _, m := range sent {
+		switch m.ID {
+		case "jobs":
+			assert.Equal(t, int64(5), *m.Delta)
+		case "temp":
+			assert.Equal(t, 1.0, *m.Value)
+		default:
+			t.Errorf("unexpected metric %s", m.ID)
+		}
+	}
+
+	assert.NotEqual(t, got[0].header.Get(model.BatchIDHeader), got[3].header.Get(model.BatchIDHeader))
+	last := decodeBatch(t, got[3])
+	require.Len(t, last, 1)
+	assert.Equal(t, int64(1), *last[0].Delta)
+}
+
+func TestBufferDropsRejectedBatch(t *testing.T) {
+	srv, requests := recordingServer(t, http.StatusBadRequest)
+	c := newTestClient(t, srv.URL, Options{Retries: -1})
+	b := NewBuffer(c, time.Hour)
+	ctx := context.Background()
+
+	jobs := b.Counter("jobs", nil)
+	jobs.Add(5)
+	require.Error(t, b.Flush(ctx))
+
+	jobs.Add(1)
+	require.NoError(t, b.Flush(ctx))
+
+	got := requests()
+	require.Len(t, got, 2)
+	last := decodeBatch(t, got[1])
+	require.Len(t, last, 1)
+	assert.Equal(t, int64(1), *last[0].Delta)
+}
+
+func TestBufferRun(t *testing.T) {
+	srv, requests := recordingServer(t)
+	c := newTestClient(t, srv.URL, Options{})
+	b := NewBuffer(c, 10*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		b.Run(ctx, func(err error) { t.Error(err) })
+		close(done)
+	}()
+
+	jobs := b.Counter("jobs", nil)
+	jobs.Inc()
+	require.Eventually(t, func() bool { return len(requests()) == 1 }, time.Second, 5*time.Millisecond)
+
+	// после остановки накопленное отправляется в последний раз
+	jobs.Add(2)
+	cancel()
+	<-done
+
+	got := requests()
+	require.Len(t, got, 2)
+	last := decodeBatch(t, got[1])
+	require.Len(t, last, 1)
+	assert.Equal(t, int64(2), *last[0].Delta)
+}
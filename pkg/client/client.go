@@ -0,0 +1,284 @@
+// Package client — клиент сервера метрик для приложений на Go. Отправляет
+// метрики в JSON API сервера (/update/, /updates/, /value/), подписывая запросы
+// так же, как агент, сжимает тела gzip и повторяет запросы при сбоях сети
+// и ответах 5xx. Для накопления метрик внутри приложения есть Buffer.
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/auth"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/replay"
+	"resty.dev/v3"
+)
+
+// Типы метрик и модель сервера.
+type (
+	Metric = model.Metrics
+	Labels = model.Labels
+	Bucket = model.Bucket
+)
+
+const (
+	TypeCounter   = model.Counter
+	TypeGauge     = model.Gauge
+	TypeHistogram = model.Histogram
+	TypeSummary   = model.Summary
+)
+
+const (
+	defaultTimeout      = 10 * time.Second
+	defaultRetries      = 3
+	defaultRetryWait    = 1 * time.Second
+	defaultRetryMaxWait = 5 * time.Second
+)
+
+// ErrNotFound — на сервере нет такой метрики.
+var ErrNotFound = errors.New("metric not found")
+
+// StatusError — сервер ответил кодом не из 2xx.
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("server responded %d %s: %s", e.Code, http.StatusText(e.Code), strings.TrimSpace(e.Body))
+}
+
+// Is позволяет проверять ответ 404 через errors.Is(err, ErrNotFound).
+func (e *StatusError) Is(target error) bool {
+	return target == ErrNotFound && e.Code == http.StatusNotFound
+}
+
+// Options — настройки клиента. Нулевые значения заменяются значениями по умолчанию.
+type Options struct {
+	// Key — ключ подписи HashSHA256: общий ключ сервера или ключ агента AgentID.
+	Key string
+	// AgentID передаётся в заголовке X-Agent-ID, если сервер проверяет ключи агентов.
+	AgentID string
+	// Timeout ограничивает одну попытку запроса.
+	Timeout time.Duration
+	// Retries — число повторов после первой попытки; отрицательное значение отключает повторы.
+	Retries int
+	// RetryWait и RetryMaxWait — границы экспоненциальной паузы между повторами.
+	RetryWait    time.Duration
+	RetryMaxWait time.Duration
+	// TLS включает HTTPS для адреса без схемы.
+	TLS *tls.Config
+	// DisableGzip отключает сжатие тел запросов.
+	DisableGzip bool
+}
+
+// Client — клиент сервера метрик. Безопасен для использования из нескольких горутин.
+type Client struct {
+	http *resty.Client
+	key  string
+	gzip bool
+}
+
+// New создаёт клиент сервера address: host:port или URL со схемой http(s).
+func New(address string, opts Options) (*Client, error) {
+	if address == "" {
+		return nil, errors.New("server address is empty")
+	}
+	if !strings.Contains(address, "://") {
+		scheme := "http"
+		if opts.TLS != nil {
+			scheme = "https"
+		}
+		address = scheme + "://" + address
+	}
+
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultTimeout
+	}
+	switch {
+	case opts.Retries == 0:
+		opts.Retries = defaultRetries
+	case opts.Retries < 0:
+		opts.Retries = 0
+	}
+	if opts.RetryWait == 0 {
+		opts.RetryWait = defaultRetryWait
+	}
+	if opts.RetryMaxWait < opts.RetryWait {
+		opts.RetryMaxWait = max(defaultRetryMaxWait, opts.RetryWait)
+	}
+
+	client := resty.New().
+		SetBaseURL(strings.TrimSuffix(address, "/")).
+		SetTimeout(opts.Timeout).
+		SetRetryCount(opts.Retries).
+		SetRetryWaitTime(opts.RetryWait).
+		SetRetryMaxWaitTime(opts.RetryMaxWait).
+		// к условиям resty (5xx, 429) добавляются любые ошибки соединения
+		AddRetryConditions(func(_ *resty.Response, err error) bool {
+			return err != nil
+		}).
+		// повтор /updates/ безопасен: пачка помечена идентификатором
+		SetAllowNonIdempotentRetry(true)
+	if opts.TLS != nil {
+		client.SetTLSClientConfig(opts.TLS)
+	}
+	if opts.AgentID != "" {
+		client.SetHeader(auth.AgentHeader, opts.AgentID)
+	}
+
+	return &Client{http: client, key: opts.Key, gzip: !opts.DisableGzip}, nil
+}
+
+// Update отправляет одну метрику. Для counter сервер прибавляет Delta к значению.
+func (c *Client) Update(ctx context.Context, m Metric) error {
+	return c.post(ctx, "/update/", m, nil, "")
+}
+
+// UpdateBatch отправляет пачку метрик одним запросом. Пачка помечается
+// идентификатором, поэтому повтор после потерянного ответа сервер не применит дважды.
+func (c *Client) UpdateBatch(ctx context.Context, metrics []Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	batchID, err := newBatchID()
+	if err != nil {
+		return err
+	}
+
+	return c.updateBatch(ctx, batchID, metrics)
+}
+
+// updateBatch отправляет пачку с идентификатором batchID. Buffer повторяет
+// неотправленную пачку с прежним идентификатором.
+func (c *Client) updateBatch(ctx context.Context, batchID string, metrics []Metric) error {
+	return c.post(ctx, "/updates/", metrics, nil, batchID)
+}
+
+// Value возвращает текущее значение метрики. Если её нет, ошибка совпадает с ErrNotFound.
+func (c *Client) Value(ctx context.Context, mType, id string, labels Labels) (Metric, error) {
+	var m Metric
+	err := c.post(ctx, "/value/", Metric{ID: id, MType: mType, Labels: labels}, &m, "")
+
+	return m, err
+}
+
+// List возвращает все метрики сервера (для ключа агента — метрики его арендатора).
+func (c *Client) List(ctx context.Context) ([]Metric, error) {
+	const path = "/"
+
+	req := c.http.R().SetContext(ctx).SetHeader("Accept", "application/json")
+	// у запроса без тела подписывается путь
+	if err := c.sign(req, path); err != nil {
+		return nil, err
+	}
+
+	var metrics []Metric
+	res, err := req.SetResult(&metrics).Get(path)
+	if err := check(res, err); err != nil {
+		return nil, err
+	}
+
+	return metrics, nil
+}
+
+// Close закрывает соединения клиента.
+func (c *Client) Close() error {
+	return c.http.Close()
+}
+
+func (c *Client) post(ctx context.Context, path string, body any, result any, batchID string) error {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("cannot marshal metrics: %w", err)
+	}
+
+	req := c.http.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(jsonData)
+	if result != nil {
+		req.SetResult(result)
+	}
+	if batchID != "" {
+		req.SetHeader(model.BatchIDHeader, batchID)
+	}
+
+	// подписывается несжатое тело: сервер сверяет подпись после распаковки
+	if err := c.sign(req, string(jsonData)); err != nil {
+		return err
+	}
+
+	if c.gzip {
+		compressed, err := compress(jsonData)
+		if err != nil {
+			return err
+		}
+		req.SetBody(compressed).SetHeader("Content-Encoding", "gzip")
+	}
+
+	return check(req.Post(path))
+}
+
+// sign подписывает payload ключом клиента вместе со временем и nonce запроса.
+// Каждый повтор resty подписывается заново: попытку с уже виденным nonce
+// сервер отверг бы как воспроизведённую.
+func (c *Client) sign(req *resty.Request, payload string) error {
+	if c.key == "" {
+		return nil
+	}
+
+	if err := replay.Sign(req.Header, payload, c.key); err != nil {
+		return err
+	}
+	// если новый nonce получить не удалось, повтор уходит с прежней подписью
+	req.AddRetryHooks(func(*resty.Response, error) {
+		_ = replay.Sign(req.Header, payload, c.key)
+	})
+
+	return nil
+}
+
+// check превращает ответ не из 2xx в *StatusError.
+func check(res *resty.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	if res.IsError() {
+		return &StatusError{Code: res.StatusCode(), Body: res.String()}
+	}
+
+	return nil
+}
+
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("cannot compress body: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("cannot compress body: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func newBatchID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("cannot generate batch id: %w", err)
+	}
+
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,266 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/7StaSH7/gometrics/internal/auth"
+	"github.com/7StaSH7/gometrics/internal/config"
+	metricshandler "github.com/7StaSH7/gometrics/internal/handler/metrics"
+	"github.com/7StaSH7/gometrics/internal/middleware"
+	"github.com/7StaSH7/gometrics/internal/model"
+	"github.com/7StaSH7/gometrics/internal/replay"
+	storagerepository "github.com/7StaSH7/gometrics/internal/repository/storage"
+	metricsservice "github.com/7StaSH7/gometrics/internal/service/metrics"
+	"github.com/7StaSH7/gometrics/internal/storage"
+	"github.com/7StaSH7/gometrics/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer поднимает сервер метрик с хранилищем в памяти, как cmd/server.
+func newTestServer(t *testing.T, key string, keys auth.KeyStore) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	backend := storagerepository.NewMemStorageRepository(storage.NewStorage(&config.ServerConfig{}))
+	service := metricsservice.New(backend, model.RetentionPolicy{}, nil, model.DedupPolicy{TTL: time.Minute, Size: 100})
+	guard := replay.NewGuard(time.Minute, 100)
+
+	router := gin.New()
+	router.Use(middleware.GzipMiddleware)
+	router.Use(middleware.AgentAuthMiddleware(keys, guard))
+	metricshandler.New(service, key, guard).Register(router)
+
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func newTestClient(t *testing.T, address string, opts Options) *Client {
+	t.Helper()
+
+	c, err := New(address, opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestClient(t *testing.T) {
+	srv := newTestServer(t, "secret", nil)
+	c := newTestClient(t, srv.URL, Options{Key: "secret"})
+	ctx := context.Background()
+	labels := Labels{"route": "/a"}
+
+	require.NoError(t, c.Update(ctx, Metric{ID: "requests", MType: TypeCounter, Delta: ptr[int64](2), Labels: labels}))
+	require.NoError(t, c.UpdateBatch(ctx, []Metric{
+		{ID: "requests", MType: TypeCounter, Delta: ptr[int64](3), Labels: labels},
+		{ID: "temp", MType: TypeGauge, Value: ptr(21.5)},
+		{ID: "latency", MType: TypeHistogram, Count: ptr[int64](2), Sum: ptr(0.3), Buckets: []Bucket{{UpperBound: 0.1, Count: 1}}},
+	}))
+
+	m, err := c.Value(ctx, TypeCounter, "requests", labels)
+	require.NoError(t, err)
+	require.NotNil(t, m.Delta)
+	assert.Equal(t, int64(5), *m.Delta)
+
+	m, err = c.Value(ctx, TypeGauge, "temp", nil)
+	require.NoError(t, err)
+	require.NotNil(t, m.Value)
+	assert.Equal(t, 21.5, *m.Value)
+
+	_, err = c.Value(ctx, TypeGauge, "missing", nil)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	all, err := c.List(ctx)
+	require.NoError(t, err)
+	ids := make([]string, 0, len(all))
+	for _, m := range all {
+		ids = append(ids, m.ID)
+	}
+	assert.ElementsMatch(t, []string{"requests", "temp", "latency"}, ids)
+
+	var statusErr *StatusError
+	err = c.Update(ctx, Metric{ID: "requests", MType: TypeCounter})
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusBadRequest, statusErr.Code)
+	assert.Contains(t, statusErr.Body, "'Delta' is missing")
+}
+
+func TestClientWrongKey(t *testing.T) {
+	srv := newTestServer(t, "secret", nil)
+
+	for _, opts := range []Options{{Key: "other"}, {Key: "other", DisableGzip: true}} {
+		c := newTestClient(t, srv.URL, opts)
+		err := c.Update(context.Background(), Metric{ID: "temp", MType: TypeGauge, Value: ptr(1.0)})
+
+		var statusErr *StatusError
+		require.ErrorAs(t, err, &statusErr)
+		assert.Equal(t, http.StatusBadRequest, statusErr.Code)
+	}
+}
+
+func TestClientAgentKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"agent":"app-1","key":"k1","tenant":"team-a"}]`), 0600))
+	keys, err := auth.NewFileKeyStore(path)
+	require.NoError(t, err)
+	srv := newTestServer(t, "", keys)
+	ctx := context.Background()
+
+	c := newTestClient(t, srv.URL, Options{Key: "k1", AgentID: "app-1"})
+	require.NoError(t, c.UpdateBatch(ctx, []Metric{{ID: "jobs", MType: TypeCounter, Delta: ptr[int64](1)}}))
+	all, err := c.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, "jobs", all[0].ID)
+
+	var statusErr *StatusError
+	_, err = newTestClient(t, srv.URL, Options{Key: "wrong", AgentID: "app-1"}).List(ctx)
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusUnauthorized, statusErr.Code)
+}
+
+// request — запрос, который получил тестовый сервер.
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// recordingServer отвечает кодами из statuses по очереди, а дальше — 200.
+func recordingServer(t *testing.T, statuses ...int) (*httptest.Server, func() []request) {
+	t.Helper()
+
+	var (
+		mu       sync.Mutex
+		requests []request
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		mu.Lock()
+		requests = append(requests, request{header: r.Header.Clone(), body: body})
+		n := len(requests)
+		mu.Unlock()
+
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"success"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []request {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]request(nil), requests...)
+	}
+}
+
+func TestClientSignature(t *testing.T) {
+	srv, requests := recordingServer(t)
+	c := newTestClient(t, srv.URL, Options{Key: "secret", AgentID: "app-1"})
+
+	metrics := []Metric{{ID: "temp", MType: TypeGauge, Value: ptr(1.5), Labels: Labels{"host": "a"}}}
+	require.NoError(t, c.UpdateBatch(context.Background(), metrics))
+
+	got := requests()
+	require.Len(t, got, 1)
+	h := got[0].header
+	assert.Equal(t, "gzip", h.Get("Content-Encoding"))
+	assert.Equal(t, "app-1", h.Get(auth.AgentHeader))
+	assert.NotEmpty(t, h.Get(model.BatchIDHeader))
+
+	plain := plainBody(t, got[0])
+
+	want, err := json.Marshal(metrics)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(want), string(plain))
+
+	payload := replay.Payload(h.Get(replay.TimestampHeader), h.Get(replay.NonceHeader), string(plain))
+	assert.Equal(t, utils.GenerateSHA256(payload, "secret"), h.Get("HashSHA256"))
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		retries      int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "recovers after server errors", statuses: []int{503, 500}, wantAttempts: 3},
+		{name: "gives up", statuses: []int{503, 503, 503, 503}, wantAttempts: 4, wantErr: true},
+		{name: "bad request is not retried", statuses: []int{400}, wantAttempts: 1, wantErr: true},
+		{name: "retries disabled", statuses: []int{503}, retries: -1, wantAttempts: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := recordingServer(t, tt.statuses...)
+			c := newTestClient(t, srv.URL, Options{
+				Key:          "secret",
+				Retries:      tt.retries,
+				RetryWait:    time.Millisecond,
+				RetryMaxWait: 5 * time.Millisecond,
+			})
+
+			err := c.UpdateBatch(context.Background(), []Metric{{ID: "jobs", MType: TypeCounter, Delta: ptr[int64](1)}})
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			got := requests()
+			require.Len(t, got, tt.wantAttempts)
+			// все попытки — одна и та же пачка, но каждая подписана со своим nonce
+			nonces := make(map[string]bool)
+			for _, r := range got {
+				assert.Equal(t, got[0].header.Get(model.BatchIDHeader), r.header.Get(model.BatchIDHeader))
+
+				nonce := r.header.Get(replay.NonceHeader)
+				assert.False(t, nonces[nonce], "nonce %s is reused", nonce)
+				nonces[nonce] = true
+
+				payload := replay.Payload(r.header.Get(replay.TimestampHeader), nonce, string(plainBody(t, r)))
+				assert.Equal(t, utils.GenerateSHA256(payload, "secret"), r.header.Get("HashSHA256"))
+			}
+		})
+	}
+}
+
+func TestClientConnectionRefused(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	address := srv.Listener.Addr().String()
+	srv.Close()
+
+	c := newTestClient(t, address, Options{RetryWait: time.Millisecond, RetryMaxWait: time.Millisecond})
+	err := c.Update(context.Background(), Metric{ID: "temp", MType: TypeGauge, Value: ptr(1.0)})
+	require.Error(t, err)
+
+	var statusErr *StatusError
+	assert.False(t, errors.As(err, &statusErr))
+
+	_, err = New("", Options{})
+	assert.Error(t, err)
+}